@@ -0,0 +1,54 @@
+package mutex
+
+import "github.com/thetechpanda/mutex/internal"
+
+// Locks is the set of structures locked by Atomically, it gives access to them through LockedMapOf and LockedValueOf.
+// Locks must not be used once the Atomically function returns.
+type Locks = internal.Locks
+
+// LockedMap is the view of a Map locked by Atomically, its methods do not lock the map.
+// Changes are applied immediately and reported to the subscribers as Store and Delete events.
+type LockedMap[K comparable, V any] interface {
+	// Load returns the value for key.
+	Load(key K) (v V, ok bool)
+	// Store sets the value for key.
+	Store(key K, value V)
+	// Delete removes key.
+	Delete(key K)
+	// Has returns true if key is present.
+	Has(key K) bool
+}
+
+// LockedValue is the view of a Value or Numeric locked by Atomically, its methods do not lock the value.
+type LockedValue[V any] interface {
+	// Load returns the value stored, ok indicates whether value was set.
+	Load() (v V, ok bool)
+	// Store sets the value.
+	Store(value V)
+	// Clear sets the value to the zero value and marks it as not set.
+	Clear()
+}
+
+// Atomically locks every structure for writing and runs f, the structures are unlocked when f returns or panics.
+// structures may mix any number of Map, Value and Numeric instances returned by this package, duplicates are locked once.
+//
+// Structures are always locked in the same global order, regardless of the order they are passed in,
+// so concurrent calls to Atomically on overlapping structures never deadlock each other.
+//
+// Atomically panics if a structure was not created by this package, TTLMap is not supported.
+//
+// ! Do not invoke any method of the locked structures within 'f' to prevent a deadlock, use LockedMapOf and LockedValueOf instead.
+func Atomically(f func(l *Locks), structures ...any) {
+	internal.Atomically(f, structures...)
+}
+
+// LockedMapOf returns the lock-free view of m within Atomically, m must be one of the structures locked by l.
+func LockedMapOf[K comparable, V any](l *Locks, m Map[K, V]) LockedMap[K, V] {
+	return internal.LockedMapOf[K, V](l, m)
+}
+
+// LockedValueOf returns the lock-free view of v within Atomically, v must be one of the structures locked by l.
+// A Numeric can be passed as v.
+func LockedValueOf[V any](l *Locks, v Value[V]) LockedValue[V] {
+	return internal.LockedValueOf[V](l, v)
+}
@@ -0,0 +1,100 @@
+package mutex
+
+import (
+	"context"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+// EvictionPolicy decides which key a BoundedMap evicts when a new key is stored in a full map.
+//
+// The map serializes the calls to its policy, so implementations do not need to be safe for concurrent use,
+// but a policy must not be shared between maps.
+type EvictionPolicy[K comparable] interface {
+	// RecordAccess records a use of key, key is present in the map.
+	RecordAccess(key K)
+	// RecordInsert records key as added to the map.
+	RecordInsert(key K)
+	// Victim returns the key to evict, ok is false if the policy has no key to evict.
+	// Victim must not change the policy state, the map removes the returned key and then calls Remove.
+	Victim() (key K, ok bool)
+	// Remove forgets key, it is called when key is evicted or removed from the map.
+	Remove(key K)
+}
+
+// BoundedMap is a Map holding a bounded number of entries, when a new key is stored in a full map
+// the key chosen by its EvictionPolicy is evicted.
+//
+// Load, LoadOrStore, Store, Swap, CompareAndSwap and Update record a use of the key, while Has, Range,
+// Keys, Values, Entries and the iterators do not.
+// UpdateRange does not change the eviction order. Exclusive records the keys added by f as inserted, in unspecified
+// order, keys already present keep their position, and the entries over capacity are evicted once f returns.
+type BoundedMap[K comparable, V any] interface {
+	Map[K, V]
+	// OnEvict sets f as the function called for every entry evicted to make room for a new key.
+	// Entries removed by Delete, LoadAndDelete, CompareAndDelete or Clear are not reported.
+	// f is called once the map lock is released, so it may call any method on the map.
+	OnEvict(f func(key K, value V))
+	// Capacity returns the maximum number of entries held by the map.
+	Capacity() int
+}
+
+// NewBoundedMap returns an empty BoundedMap holding at most capacity entries and evicting the keys chosen by policy.
+// NewBoundedMap panics if capacity is less than 1 or policy is nil.
+func NewBoundedMap[K comparable, V any](capacity int, policy EvictionPolicy[K]) BoundedMap[K, V] {
+	return &boundedMap[K, V]{internal.NewBoundedMap[K, V](capacity, policy)}
+}
+
+// NewLRUMap returns an empty BoundedMap holding at most capacity entries and evicting the least recently used one.
+// NewLRUMap panics if capacity is less than 1.
+func NewLRUMap[K comparable, V any](capacity int) BoundedMap[K, V] {
+	return &boundedMap[K, V]{internal.NewLRUMap[K, V](capacity)}
+}
+
+// boundedMap implements BoundedMap on top of a BoundedMap of the internal package, see plainMap.
+type boundedMap[K comparable, V any] struct{ *internal.BoundedMap[K, V] }
+
+func (m *boundedMap[K, V]) Transaction(f func(tx Tx[K, V]) error) error {
+	return m.BoundedMap.Transaction(transaction(f))
+}
+
+func (m *boundedMap[K, V]) Watch(ctx context.Context, key K, opts ...WatchOption) <-chan Event[K, V] {
+	return watch(m.BoundedMap, ctx, key, false, opts)
+}
+
+func (m *boundedMap[K, V]) WatchAll(ctx context.Context, opts ...WatchOption) <-chan Event[K, V] {
+	var zero K
+	return watch(m.BoundedMap, ctx, zero, true, opts)
+}
+
+func (m *boundedMap[K, V]) Clone() Map[K, V] {
+	return clone[K, V](m.BoundedMap)
+}
+
+// NewLRUPolicy returns an EvictionPolicy evicting the least recently used key.
+func NewLRUPolicy[K comparable]() EvictionPolicy[K] {
+	return internal.NewLRUPolicy[K]()
+}
+
+// NewLFUPolicy returns an EvictionPolicy evicting the least frequently used key,
+// ties are broken evicting the least recently used key.
+func NewLFUPolicy[K comparable]() EvictionPolicy[K] {
+	return internal.NewLFUPolicy[K]()
+}
+
+// NewARCPolicy returns an EvictionPolicy implementing the Adaptive Replacement Cache, which balances recency and
+// frequency of use and is resistant to scans. capacity should match the capacity of the map using the policy.
+// NewARCPolicy panics if capacity is less than 1.
+func NewARCPolicy[K comparable](capacity int) EvictionPolicy[K] {
+	return internal.NewARCPolicy[K](capacity)
+}
+
+// NewFIFOPolicy returns an EvictionPolicy evicting the oldest inserted key.
+func NewFIFOPolicy[K comparable]() EvictionPolicy[K] {
+	return internal.NewFIFOPolicy[K]()
+}
+
+// NewRandomPolicy returns an EvictionPolicy evicting a random key.
+func NewRandomPolicy[K comparable]() EvictionPolicy[K] {
+	return internal.NewRandomPolicy[K]()
+}
@@ -0,0 +1,26 @@
+package mutex
+
+import "expvar"
+
+// PublishNumeric registers n as the expvar variable name and returns n, n is rendered as a JSON number.
+// It panics if name is already registered, as expvar.Publish does.
+//
+//	var requests = mutex.PublishNumeric("requests", mutex.NewNumeric[int64]())
+func PublishNumeric[V uint | uint8 | uint16 | uint32 | uint64 | int | int8 | int16 | int32 | int64 | float32 | float64 | complex64 | complex128](name string, n Numeric[V]) Numeric[V] {
+	expvar.Publish(name, n)
+	return n
+}
+
+// PublishValue registers v as the expvar variable name and returns v, v is rendered as JSON, null if it is not set.
+// It panics if name is already registered, as expvar.Publish does.
+func PublishValue[V any](name string, v Value[V]) Value[V] {
+	expvar.Publish(name, v)
+	return v
+}
+
+// PublishMap registers m as the expvar variable name and returns m, m is rendered as a JSON object.
+// It panics if name is already registered, as expvar.Publish does.
+func PublishMap[K comparable, V any](name string, m Map[K, V]) Map[K, V] {
+	expvar.Publish(name, m)
+	return m
+}
@@ -0,0 +1,34 @@
+package mutex
+
+import "github.com/thetechpanda/mutex/internal"
+
+// Filter returns a new, independent Map holding the entries of m for which pred returns true.
+// The new map uses the Equal and Copy options of m and records lock statistics if m does, as Map.Clone.
+//
+// The entries of m are copied under its read lock, a consistent snapshot for every Map including sharded ones,
+// and pred is called once m is unlocked, so pred may call methods of m.
+func Filter[K comparable, V any](m Map[K, V], pred func(K, V) bool) Map[K, V] {
+	return &plainMap[K, V]{internal.Filter(m, pred)}
+}
+
+// Transform returns a new, independent Map holding the keys of m with the values returned by f.
+// The snapshot of m is taken as in Filter, the new map uses the default options since the type of the values changes.
+func Transform[K comparable, V, W any](m Map[K, V], f func(K, V) W) Map[K, W] {
+	return &plainMap[K, W]{internal.Transform(m, f)}
+}
+
+// Reduce calls f for every entry of m, in unspecified order, with the value returned by the previous call,
+// starting from init, and returns the value returned by the last call or init if m is empty.
+// The snapshot of m is taken as in Filter.
+//
+//	total := mutex.Reduce(prices, 0.0, func(sum float64, _ string, price float64) float64 { return sum + price })
+func Reduce[K comparable, V, A any](m Map[K, V], init A, f func(acc A, key K, value V) A) A {
+	return internal.Reduce(m, init, f)
+}
+
+// Partition returns two new, independent Maps: matched holding the entries of m for which pred returns true
+// and rest holding the others. The snapshot of m is taken and the options of m are kept as in Filter.
+func Partition[K comparable, V any](m Map[K, V], pred func(K, V) bool) (matched, rest Map[K, V]) {
+	in, out := internal.Partition(m, pred)
+	return &plainMap[K, V]{in}, &plainMap[K, V]{out}
+}
@@ -0,0 +1,47 @@
+//go:build mutexdebug
+
+package mutex_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/thetechpanda/mutex"
+)
+
+// expectReentrant runs f and fails the test unless f panics reporting a call to called while held holds the lock,
+// both called at a position of this file.
+func expectReentrant(t *testing.T, called, held string, f func()) {
+	t.Helper()
+	defer func() {
+		t.Helper()
+		r := recover()
+		msg, _ := r.(string)
+		if !strings.Contains(msg, "mutex: "+called+" called at ") || !strings.Contains(msg, " while "+held+" called at ") {
+			t.Fatalf("Expected a re-entrant call to %s within %s, got %v", called, held, r)
+		}
+		if strings.Count(msg, "guard_test.go:") != 2 {
+			t.Errorf("Expected both call sites to be reported, got %s", msg)
+		}
+	}()
+	f()
+}
+
+func TestGuard(t *testing.T) {
+	m := mutex.NewMap[string, int]()
+	expectReentrant(t, "Map.Load", "Map.Transaction", func() {
+		m.Transaction(func(tx mutex.Tx[string, int]) error { m.Load("a"); return nil })
+	})
+	expectReentrant(t, "Map.Clone", "Map.Exclusive", func() {
+		m.Exclusive(func(map[string]int) { m.Clone() })
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	expectReentrant(t, "Map.Watch", "Map.Exclusive", func() {
+		m.Exclusive(func(map[string]int) { m.Watch(ctx, "a") })
+	})
+	expectReentrant(t, "Map.WatchAll", "Map.Exclusive", func() {
+		m.Exclusive(func(map[string]int) { m.WatchAll(ctx) })
+	})
+}
@@ -0,0 +1,216 @@
+package internal
+
+import (
+	"cmp"
+	"slices"
+	"sync/atomic"
+)
+
+// lockable is a structure that can be locked by Atomically.
+type lockable interface {
+	// lockID returns the identifier of the structure, structures are always locked in ascending lockID order.
+	lockID() uint64
+	// lockAll locks the structure for writing.
+	lockAll()
+	// unlockAll unlocks the structure locked by lockAll.
+	unlockAll()
+}
+
+// lockIDs is the last identifier assigned to a lockable structure.
+var lockIDs atomic.Uint64
+
+// lazyID returns the identifier stored in id, assigning a new one on first use.
+func lazyID(id *atomic.Uint64) uint64 {
+	if v := id.Load(); v != 0 {
+		return v
+	}
+	id.CompareAndSwap(0, lockIDs.Add(1))
+	return id.Load()
+}
+
+// Locks is the set of structures locked by Atomically, it is used to access them with LockedMapOf and LockedValueOf.
+// Locks must not be used once the Atomically function returns.
+type Locks struct {
+	held   map[uint64]bool
+	closed bool
+}
+
+// check panics if the structure identified by id is not locked by l.
+func (l *Locks) check(id uint64) {
+	if l.closed {
+		panic("mutex: Locks used after Atomically returned")
+	}
+	if !l.held[id] {
+		panic("mutex: structure not locked by Atomically")
+	}
+}
+
+// Atomically locks structures for writing, in a global order that does not depend on the order of the arguments,
+// and runs f. The structures are unlocked when f returns or panics.
+// Atomically panics if a structure is not a Map, ShardedMap, BoundedMap, Value or Numeric.
+func Atomically(f func(l *Locks), structures ...any) {
+	locked := make([]lockable, 0, len(structures))
+	l := &Locks{held: make(map[uint64]bool, len(structures))}
+	for _, s := range structures {
+		lk, ok := s.(lockable)
+		if !ok {
+			panic("mutex: Atomically called with an unsupported structure")
+		}
+		if id := lk.lockID(); !l.held[id] {
+			l.held[id] = true
+			locked = append(locked, lk)
+		}
+	}
+	slices.SortFunc(locked, func(a, b lockable) int {
+		return cmp.Compare(a.lockID(), b.lockID())
+	})
+	for _, lk := range locked {
+		lk.lockAll()
+	}
+	defer func() {
+		l.closed = true
+		for i := len(locked) - 1; i >= 0; i-- {
+			locked[i].unlockAll()
+		}
+	}()
+	f(l)
+}
+
+// LockedMap is the view of a map locked by Atomically, its methods do not lock the map.
+// Changes are applied immediately and reported to the subscribers as Store and Delete events.
+type LockedMap[K comparable, V any] interface {
+	// Load returns the value for key.
+	Load(key K) (v V, ok bool)
+	// Store sets the value for key.
+	Store(key K, value V)
+	// Delete removes key.
+	Delete(key K)
+	// Has returns true if key is present.
+	Has(key K) bool
+}
+
+// mapViewer is a map that can be accessed through a LockedMap.
+type mapViewer[K comparable, V any] interface {
+	lockable
+	view() *lockedMap[K, V]
+}
+
+// lockedMap implements LockedMap on top of one or more locked maps.
+type lockedMap[K comparable, V any] struct {
+	shard func(K) *Map[K, V] // returns the map owning key.
+	id    uint64
+	locks *Locks
+}
+
+// LockedMapOf returns the view of m locked by l.
+// LockedMapOf panics if m is not a map locked by l.
+func LockedMapOf[K comparable, V any](l *Locks, m any) LockedMap[K, V] {
+	v, ok := m.(mapViewer[K, V])
+	if !ok {
+		panic("mutex: LockedMapOf called with an unsupported structure")
+	}
+	l.check(v.lockID())
+	lm := v.view()
+	lm.locks = l
+	return lm
+}
+
+// Load returns the value for key.
+func (m *lockedMap[K, V]) Load(key K) (v V, ok bool) {
+	m.locks.check(m.id)
+	return m.shard(key).get(key)
+}
+
+// Store sets the value for key.
+func (m *lockedMap[K, V]) Store(key K, value V) {
+	m.locks.check(m.id)
+	m.shard(key).set(OpStore, key, value)
+}
+
+// Delete removes key.
+func (m *lockedMap[K, V]) Delete(key K) {
+	m.locks.check(m.id)
+	m.shard(key).del(OpDelete, key)
+}
+
+// Has returns true if key is present.
+func (m *lockedMap[K, V]) Has(key K) bool {
+	m.locks.check(m.id)
+	_, ok := m.shard(key).data[key]
+	return ok
+}
+
+// LockedValue is the view of a value locked by Atomically, its methods do not lock the value.
+type LockedValue[V any] interface {
+	// Load returns the value stored, ok indicates whether value was set.
+	Load() (v V, ok bool)
+	// Store sets the value.
+	Store(value V)
+	// Clear sets the value to the zero value and marks it as not set.
+	Clear()
+}
+
+// lockedValue implements LockedValue on top of a locked Value.
+type lockedValue[V any] struct {
+	value *Value[V]
+	locks *Locks
+}
+
+// valueViewer is a value that can be accessed through a LockedValue.
+type valueViewer[V any] interface {
+	lockable
+	view() *Value[V]
+}
+
+// LockedValueOf returns the view of v locked by l.
+// LockedValueOf panics if v is not a value locked by l.
+func LockedValueOf[V any](l *Locks, v any) LockedValue[V] {
+	vv, ok := v.(valueViewer[V])
+	if !ok {
+		panic("mutex: LockedValueOf called with an unsupported structure")
+	}
+	l.check(vv.lockID())
+	return &lockedValue[V]{value: vv.view(), locks: l}
+}
+
+// Load returns the value stored, ok indicates whether value was set.
+func (v *lockedValue[V]) Load() (value V, ok bool) {
+	v.locks.check(v.value.lockID())
+	return v.value.data, v.value.set
+}
+
+// Store sets the value.
+func (v *lockedValue[V]) Store(value V) {
+	v.locks.check(v.value.lockID())
+	v.value.data = value
+	v.value.set = true
+}
+
+// Clear sets the value to the zero value and marks it as not set.
+func (v *lockedValue[V]) Clear() {
+	v.locks.check(v.value.lockID())
+	var zero V
+	v.value.data = zero
+	v.value.set = false
+}
+
+func (m *Map[K, V]) lockID() uint64 { return lazyID(&m.id) }
+func (m *Map[K, V]) lockAll()       { m.lock() }
+func (m *Map[K, V]) unlockAll()     { m.unlock() }
+
+func (m *Map[K, V]) view() *lockedMap[K, V] {
+	return &lockedMap[K, V]{shard: func(K) *Map[K, V] { return m }, id: m.lockID()}
+}
+
+func (s *ShardedMap[K, V]) lockID() uint64 { return lazyID(&s.id) }
+func (s *ShardedMap[K, V]) lockAll()       { s.lock() }
+func (s *ShardedMap[K, V]) unlockAll()     { s.unlock() }
+
+func (s *ShardedMap[K, V]) view() *lockedMap[K, V] {
+	return &lockedMap[K, V]{shard: s.shard, id: s.lockID()}
+}
+
+func (m *Value[V]) lockID() uint64  { return lazyID(&m.id) }
+func (m *Value[V]) lockAll()        { m.lock() }
+func (m *Value[V]) unlockAll()      { m.unlock() }
+func (m *Value[V]) view() *Value[V] { return m }
@@ -0,0 +1,138 @@
+package internal_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+func TestAtomically(t *testing.T) {
+	from := internal.NewMap(map[string]int{"a": 1})
+	to := internal.NewShardedMap[string, int](4, func(k string) uint64 { return uint64(len(k)) })
+	moved := internal.NewNumeric[int]()
+	internal.Atomically(func(l *internal.Locks) {
+		src := internal.LockedMapOf[string, int](l, from)
+		dst := internal.LockedMapOf[string, int](l, to)
+		count := internal.LockedValueOf[int](l, moved)
+		v, ok := src.Load("a")
+		if !ok {
+			t.Errorf("Load(): Expected key a to be present")
+		}
+		src.Delete("a")
+		dst.Store("a", v)
+		if src.Has("a") || !dst.Has("a") {
+			t.Errorf("Has(): Expected key a to be moved")
+		}
+		n, _ := count.Load()
+		count.Store(n + 1)
+	}, to, moved, from, from)
+	if from.Has("a") {
+		t.Errorf("Atomically(): Expected key a to be removed from the source map")
+	}
+	if v, ok := to.Load("a"); !ok || v != 1 {
+		t.Errorf("Atomically(): Expected key a to be stored in the destination map, got %d", v)
+	}
+	if v, _ := moved.Load(); v != 1 {
+		t.Errorf("Atomically(): Expected counter to be 1, got %d", v)
+	}
+	internal.Atomically(func(l *internal.Locks) {
+		internal.LockedValueOf[int](l, moved).Clear()
+	}, moved)
+	if !moved.IsZero() {
+		t.Errorf("Clear(): Expected value to be cleared")
+	}
+}
+
+func TestAtomicallyNoDeadlock(t *testing.T) {
+	a := internal.NewMap[int, int](nil)
+	b := internal.NewMap[int, int](nil)
+	v := internal.NewValue[int]()
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			internal.Atomically(func(l *internal.Locks) {
+				internal.LockedMapOf[int, int](l, a).Store(i, i)
+				internal.LockedMapOf[int, int](l, b).Delete(i)
+			}, a, b, v)
+		}()
+		go func() {
+			defer wg.Done()
+			internal.Atomically(func(l *internal.Locks) {
+				internal.LockedMapOf[int, int](l, b).Store(i, i)
+				internal.LockedValueOf[int](l, v).Store(i)
+			}, v, b, a)
+		}()
+	}
+	wg.Wait()
+	if a.Len() != 100 {
+		t.Errorf("Len(): Expected 100 keys, got %d", a.Len())
+	}
+}
+
+func TestAtomicallyPanics(t *testing.T) {
+	m := internal.NewMap[string, int](nil)
+	other := internal.NewMap[string, int](nil)
+	expectPanic := func(name string, f func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s: Expected panic", name)
+			}
+		}()
+		f()
+	}
+	expectPanic("unsupported structure", func() {
+		internal.Atomically(func(l *internal.Locks) {}, m, 42)
+	})
+	expectPanic("structure not locked", func() {
+		internal.Atomically(func(l *internal.Locks) {
+			internal.LockedMapOf[string, int](l, other)
+		}, m)
+	})
+	expectPanic("wrong type", func() {
+		internal.Atomically(func(l *internal.Locks) {
+			internal.LockedValueOf[int](l, m)
+		}, m)
+	})
+	var leaked internal.LockedMap[string, int]
+	internal.Atomically(func(l *internal.Locks) {
+		leaked = internal.LockedMapOf[string, int](l, m)
+	}, m)
+	expectPanic("used after return", func() {
+		leaked.Store("a", 1)
+	})
+	expectPanic("panic in f", func() {
+		internal.Atomically(func(l *internal.Locks) {
+			panic("boom")
+		}, m, other)
+	})
+	// the locks are released after a panic.
+	m.Store("a", 1)
+	other.Store("a", 1)
+}
+
+func TestAtomicallyObservers(t *testing.T) {
+	m := internal.NewLRUMap[int, int](1)
+	var evicted []int
+	m.OnEvict(func(key, value int) {
+		evicted = append(evicted, key)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := m.WatchAll(ctx)
+	internal.Atomically(func(l *internal.Locks) {
+		lm := internal.LockedMapOf[int, int](l, m)
+		lm.Store(1, 1)
+		lm.Store(2, 2)
+	}, m)
+	if len(evicted) != 1 || evicted[0] != 1 {
+		t.Errorf("Atomically(): Expected key 1 to be evicted, got %v", evicted)
+	}
+	if e := receive(t, ch); e.Op != internal.OpStore || e.Key != 1 {
+		t.Errorf("Watch(): Expected Store event for key 1, got %+v", e)
+	}
+}
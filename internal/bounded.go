@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"sync"
+)
+
+// EvictionPolicy decides which key a BoundedMap evicts when it grows over its capacity.
+// Calls are serialized by the map, so implementations do not need to be safe for concurrent use,
+// but a policy must not be shared between maps.
+type EvictionPolicy[K comparable] interface {
+	// RecordAccess records a use of key, key is present in the map.
+	RecordAccess(key K)
+	// RecordInsert records key as added to the map.
+	RecordInsert(key K)
+	// Victim returns the key to evict, ok is false if the policy has no key to evict.
+	// Victim must not change the policy state, the returned key is removed with Remove once evicted.
+	Victim() (key K, ok bool)
+	// Remove forgets key, it is called when key is evicted or removed from the map.
+	Remove(key K)
+}
+
+// BoundedMap implements a thread-safe map holding at most capacity entries, when a new key is stored
+// in a full map the entry chosen by the eviction policy is evicted.
+//
+// Load, LoadOrStore, Store, Swap, CompareAndSwap and Update record a use of the key, Has, Range and
+// the other read-only methods do not. UpdateRange does not record any use. Exclusive records the keys
+// added by f as inserted, in unspecified order, and evicts the entries over capacity once f returns.
+type BoundedMap[K comparable, V any] struct {
+	*Map[K, V]
+	capacity int
+	mu       sync.Mutex // guards the fields below, the map lock is always acquired first.
+	policy   EvictionPolicy[K]
+	onEvict  func(K, V)
+	evicted  []entry[K, V] // evictions to report once the map lock is released.
+}
+
+// entry is a key-value pair.
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// NewBoundedMap returns a new BoundedMap holding at most capacity entries and evicting the keys chosen by policy.
+// NewBoundedMap panics if capacity is less than 1 or policy is nil.
+func NewBoundedMap[K comparable, V any](capacity int, policy EvictionPolicy[K]) *BoundedMap[K, V] {
+	if capacity < 1 {
+		panic("mutex: NewBoundedMap called with capacity less than 1")
+	}
+	if policy == nil {
+		panic("mutex: NewBoundedMap called with nil policy")
+	}
+	m := &BoundedMap[K, V]{
+		Map:      NewMap[K, V](nil),
+		capacity: capacity,
+		policy:   policy,
+	}
+	m.Map.obs = m
+	return m
+}
+
+// NewLRUMap returns a new BoundedMap holding at most capacity entries and evicting the least recently used one.
+// NewLRUMap panics if capacity is less than 1.
+func NewLRUMap[K comparable, V any](capacity int) *BoundedMap[K, V] {
+	return NewBoundedMap[K, V](capacity, NewLRUPolicy[K]())
+}
+
+// OnEvict sets f as the function called for every entry evicted to make room for a new key.
+// Entries removed by Delete, LoadAndDelete, CompareAndDelete or Clear are not reported.
+// f is called once the map lock is released, so it may call any method on m.
+func (m *BoundedMap[K, V]) OnEvict(f func(key K, value V)) {
+	m.Map.lock()
+	defer m.Map.unlock()
+	m.onEvict = f
+}
+
+// Capacity returns the maximum number of entries held by the map.
+func (m *BoundedMap[K, V]) Capacity() int {
+	return m.capacity
+}
+
+func (m *BoundedMap[K, V]) accessed(key K) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.policy.RecordAccess(key)
+}
+
+func (m *BoundedMap[K, V]) changed(e Event[K, V]) {
+	switch {
+	case e.Deleted:
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.policy.Remove(e.Key)
+	case !e.Loaded:
+		m.inserted(e.Key)
+	case e.Op != OpUpdateRange && e.Op != OpExclusive:
+		m.accessed(e.Key)
+	}
+}
+
+// inserted records key as inserted, evicting the entries over capacity. The map is write locked.
+func (m *BoundedMap[K, V]) inserted(key K) {
+	// evicts before recording the insert, so that the new key is never the victim.
+	for len(m.Map.data) > m.capacity {
+		m.mu.Lock()
+		victim, ok := m.policy.Victim()
+		m.mu.Unlock()
+		if !ok {
+			break
+		}
+		value, loaded := m.Map.del(OpEvict, victim)
+		if !loaded {
+			// the policy returned a key that is not in the map.
+			m.mu.Lock()
+			m.policy.Remove(victim)
+			m.mu.Unlock()
+			continue
+		}
+		if m.onEvict != nil {
+			m.evicted = append(m.evicted, entry[K, V]{key: victim, value: value})
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.policy.RecordInsert(key)
+}
+
+func (m *BoundedMap[K, V]) unlocking() func() {
+	if len(m.evicted) == 0 {
+		return nil
+	}
+	f, evicted := m.onEvict, m.evicted
+	m.evicted = nil
+	return func() {
+		for _, e := range evicted {
+			f(e.key, e.value)
+		}
+	}
+}
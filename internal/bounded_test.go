@@ -0,0 +1,201 @@
+package internal_test
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+func TestNewBoundedMap(t *testing.T) {
+	m := internal.NewLRUMap[int, int](2)
+	if m.Capacity() != 2 {
+		t.Errorf("Capacity(): Expected capacity 2, got %d", m.Capacity())
+	}
+	expectPanic := func(name string, f func()) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s: Expected panic", name)
+			}
+		}()
+		f()
+	}
+	expectPanic("NewLRUMap(0)", func() { internal.NewLRUMap[int, int](0) })
+	expectPanic("NewBoundedMap(nil)", func() { internal.NewBoundedMap[int, int](1, nil) })
+}
+
+// stalePolicy returns a victim that is not in the map before the real one.
+type stalePolicy struct {
+	*internal.FIFOPolicy[int]
+	stale []int
+}
+
+func (p *stalePolicy) Victim() (int, bool) {
+	if len(p.stale) > 0 {
+		key := p.stale[0]
+		p.stale = p.stale[1:]
+		return key, true
+	}
+	return p.FIFOPolicy.Victim()
+}
+
+func TestBoundedMapStaleVictim(t *testing.T) {
+	m := internal.NewBoundedMap[int, int](1, &stalePolicy{FIFOPolicy: internal.NewFIFOPolicy[int](), stale: []int{42}})
+	m.Store(1, 1)
+	m.Store(2, 2)
+	if m.Has(1) || !m.Has(2) || m.Len() != 1 {
+		t.Errorf("Store(): Expected key 1 to be evicted, got keys %v", m.Keys())
+	}
+}
+
+func TestBoundedMapEviction(t *testing.T) {
+	m := internal.NewLRUMap[string, int](3)
+	var evicted []string
+	m.OnEvict(func(key string, value int) {
+		evicted = append(evicted, key)
+		// the callback runs without the lock held.
+		m.Len()
+	})
+
+	m.Store("a", 1)
+	m.Store("b", 2)
+	m.Store("c", 3)
+	// a becomes the most recently used, b is now the least recently used.
+	if _, ok := m.Load("a"); !ok {
+		t.Errorf("Load(): Expected key %q to be present", "a")
+	}
+	// Has does not count as a use.
+	if !m.Has("b") {
+		t.Errorf("Has(): Expected key %q to be present", "b")
+	}
+	m.Store("d", 4)
+	if !reflect.DeepEqual(evicted, []string{"b"}) {
+		t.Errorf("Store(): Expected %q to be evicted, got %v", "b", evicted)
+	}
+
+	// storing an existing key does not evict and counts as a use, c is the least recently used.
+	m.Store("a", 10)
+	if _, loaded := m.LoadOrStore("e", 5); loaded {
+		t.Errorf("LoadOrStore(): Expected key %q to be stored", "e")
+	}
+	if !reflect.DeepEqual(evicted, []string{"b", "c"}) {
+		t.Errorf("LoadOrStore(): Expected %q to be evicted, got %v", "c", evicted)
+	}
+
+	// LoadOrStore of an existing key counts as a use, d is the least recently used.
+	m.LoadOrStore("a", 0)
+	m.Update("f", func(v int, ok bool) int { return 6 })
+	if !reflect.DeepEqual(evicted, []string{"b", "c", "d"}) {
+		t.Errorf("Update(): Expected %q to be evicted, got %v", "d", evicted)
+	}
+	if m.Len() != 3 {
+		t.Errorf("Len(): Expected length 3, got %d", m.Len())
+	}
+
+	// deleted keys are not reported and free a slot.
+	m.Delete("e")
+	m.Store("g", 7)
+	if len(evicted) != 3 {
+		t.Errorf("Delete(): Expected no eviction, got %v", evicted)
+	}
+	m.Clear()
+	for i := 0; i < 3; i++ {
+		m.Store(string(rune('h'+i)), i)
+	}
+	if len(evicted) != 3 || m.Len() != 3 {
+		t.Errorf("Clear(): Expected no eviction, got %v", evicted)
+	}
+}
+
+func TestBoundedMapUpdateRange(t *testing.T) {
+	m := internal.NewLRUMap[int, int](3)
+	for i := 0; i < 3; i++ {
+		m.Store(i, i)
+	}
+	m.UpdateRange(func(k, v int) (int, bool) {
+		return v + 1, true
+	})
+	// UpdateRange does not change the eviction order, 0 is still the least recently used.
+	m.Store(3, 3)
+	if m.Has(0) {
+		t.Errorf("UpdateRange(): Expected key 0 to be evicted")
+	}
+	if v, _ := m.Load(2); v != 3 {
+		t.Errorf("Load(): Expected value 3, got %d", v)
+	}
+}
+
+func TestBoundedMapExclusive(t *testing.T) {
+	m := internal.NewLRUMap[int, int](3)
+	var evicted []int
+	m.OnEvict(func(key, value int) {
+		evicted = append(evicted, key)
+	})
+	m.Store(0, 0)
+	m.Store(1, 1)
+	m.Exclusive(func(data map[int]int) {
+		delete(data, 0)
+		data[2] = 2
+		data[3] = 3
+		data[4] = 4
+	})
+	// 1 is the least recently used and one of the added keys is evicted too.
+	if m.Len() != 3 {
+		t.Errorf("Len(): Expected length 3, got %d", m.Len())
+	}
+	if len(evicted) != 1 || evicted[0] != 1 {
+		t.Errorf("Exclusive(): Expected key 1 to be evicted, got %v", evicted)
+	}
+	keys := m.Keys()
+	sort.Ints(keys)
+	if !reflect.DeepEqual(keys, []int{2, 3, 4}) {
+		t.Errorf("Keys(): Expected keys [2 3 4], got %v", keys)
+	}
+
+	// a panic in f still keeps the eviction order in sync with the map.
+	func() {
+		defer func() { recover() }()
+		m.Exclusive(func(data map[int]int) {
+			data[5] = 5
+			panic("exclusive")
+		})
+	}()
+	m.Store(6, 6)
+	m.Store(7, 7)
+	if m.Len() != 3 {
+		t.Errorf("Len(): Expected length 3, got %d", m.Len())
+	}
+}
+
+func TestBoundedMapConcurrentAccess(t *testing.T) {
+	m := internal.NewLRUMap[int, int](10)
+	var evictions sync.Map
+	m.OnEvict(func(key, value int) {
+		evictions.Store(key, value)
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				m.Store(i*100+j, j)
+				m.Load(i*100 + j/2)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if m.Len() != 10 {
+		t.Errorf("Len(): Expected length 10, got %d", m.Len())
+	}
+	count := 0
+	evictions.Range(func(key, value any) bool {
+		count++
+		return true
+	})
+	if count != 990 {
+		t.Errorf("OnEvict(): Expected 990 evictions, got %d", count)
+	}
+}
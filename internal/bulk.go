@@ -0,0 +1,130 @@
+package internal
+
+import "maps"
+
+// StoreMany sets the values of all the keys in entries, the map is locked once.
+func (m *Map[K, V]) StoreMany(entries map[K]V) {
+	m.lock()
+	defer m.unlock()
+	for key, value := range entries {
+		m.set(OpStore, key, value)
+	}
+}
+
+// LoadMany returns the values of the keys present in the map, keys not present are omitted.
+// The map is read locked once.
+func (m *Map[K, V]) LoadMany(keys []K) map[K]V {
+	defer m.runlock(m.rlock())
+	values := make(map[K]V, len(keys))
+	for _, key := range keys {
+		if value, ok := m.get(key); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// DeleteMany removes keys from the map and returns the number of keys removed, the map is locked once.
+func (m *Map[K, V]) DeleteMany(keys []K) (n int) {
+	m.lock()
+	defer m.unlock()
+	for _, key := range keys {
+		if _, loaded := m.del(OpDelete, key); loaded {
+			n++
+		}
+	}
+	return n
+}
+
+// Replace replaces the content of the map with a copy of data and returns the previous content.
+// Replaced keys are reported to the subscribers as Store events, removed keys as Delete events.
+func (m *Map[K, V]) Replace(data map[K]V) (old map[K]V) {
+	m.lock()
+	defer m.unlock()
+	if !m.observed() || m.bulk() {
+		old, m.data = m.data, make(map[K]V, len(data))
+		maps.Copy(m.data, data)
+		return old
+	}
+	old = maps.Clone(m.data)
+	m.replace(data)
+	return old
+}
+
+// Drain removes all items from the map and returns them, as Clear does the removed keys are reported
+// to the subscribers as Clear events.
+func (m *Map[K, V]) Drain() map[K]V {
+	m.lock()
+	defer m.unlock()
+	data := m.data
+	m.clear()
+	return data
+}
+
+// StoreMany sets the values of all the keys in entries, every shard is locked once and the values are stored atomically.
+func (s *ShardedMap[K, V]) StoreMany(entries map[K]V) {
+	s.lock()
+	defer s.unlock()
+	for key, value := range entries {
+		s.shard(key).set(OpStore, key, value)
+	}
+}
+
+// LoadMany returns the values of the keys present in the map, keys not present are omitted.
+// Every shard is read locked once.
+func (s *ShardedMap[K, V]) LoadMany(keys []K) map[K]V {
+	defer s.runlock(s.rlock())
+	values := make(map[K]V, len(keys))
+	for _, key := range keys {
+		if value, ok := s.shard(key).get(key); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// DeleteMany removes keys from the map and returns the number of keys removed, every shard is locked once.
+func (s *ShardedMap[K, V]) DeleteMany(keys []K) (n int) {
+	s.lock()
+	defer s.unlock()
+	for _, key := range keys {
+		if _, loaded := s.shard(key).del(OpDelete, key); loaded {
+			n++
+		}
+	}
+	return n
+}
+
+// Replace replaces the content of the map with a copy of data and returns the previous content,
+// all the shards are replaced atomically.
+func (s *ShardedMap[K, V]) Replace(data map[K]V) (old map[K]V) {
+	s.lock()
+	defer s.unlock()
+	old = s.merged()
+	s.replace(data)
+	return old
+}
+
+// Drain removes all items from the map and returns them, all the shards are drained atomically.
+func (s *ShardedMap[K, V]) Drain() map[K]V {
+	s.lock()
+	defer s.unlock()
+	data := s.merged()
+	for _, shard := range s.shards {
+		shard.clear()
+	}
+	return data
+}
+
+// LoadMany returns the values of the keys present in the map, keys not present are omitted.
+// It reads the published copy of the map without locking.
+func (c *COWMap[K, V]) LoadMany(keys []K) map[K]V {
+	data := c.data()
+	values := make(map[K]V, len(keys))
+	for _, key := range keys {
+		if value, ok := data[key]; ok {
+			values[key] = value
+		}
+	}
+	return values
+}
@@ -0,0 +1,117 @@
+package internal_test
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+func TestMapBulk(t *testing.T) {
+	m := internal.NewMap[string, int](nil, internal.WithStats[int]())
+	m.StoreMany(map[string]int{"a": 1, "b": 2, "c": 3})
+	if st := m.Stats(); st.Writes != 1 || m.Len() != 3 {
+		t.Errorf("StoreMany(): Expected 3 keys stored with a single lock, got %d keys and %+v", m.Len(), st)
+	}
+	if v := m.LoadMany([]string{"a", "c", "x"}); !maps.Equal(v, map[string]int{"a": 1, "c": 3}) {
+		t.Errorf("LoadMany(): Expected the present keys, got %v", v)
+	}
+	if n := m.DeleteMany([]string{"a", "x", "a"}); n != 1 {
+		t.Errorf("DeleteMany(): Expected 1 key removed, got %d", n)
+	}
+	data := map[string]int{"x": 10, "y": 20}
+	if old := m.Replace(data); !maps.Equal(old, map[string]int{"b": 2, "c": 3}) {
+		t.Errorf("Replace(): Expected the previous content, got %v", old)
+	}
+	data["z"] = 30 // data is copied.
+	if old := m.Drain(); !maps.Equal(old, map[string]int{"x": 10, "y": 20}) || m.Len() != 0 {
+		t.Errorf("Drain(): Expected the content and an empty map, got %v and %d keys", old, m.Len())
+	}
+	// StoreMany, DeleteMany, Replace and Drain lock for writing, LoadMany and the Len calls for reading.
+	if st := m.Stats(); st.Writes != 4 || st.Reads != 3 {
+		t.Errorf("Stats(): Expected every call to lock once, got %+v", st)
+	}
+	m.Store("a", 1)
+	if m.Len() != 1 {
+		t.Errorf("Store(): Expected the drained map to be usable, got %d keys", m.Len())
+	}
+}
+
+func TestMapBulkEvents(t *testing.T) {
+	m := internal.NewMap(map[string]int{"a": 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := m.WatchAll(ctx, internal.WithWatchBuffer(32))
+
+	m.StoreMany(map[string]int{"b": 2})
+	m.DeleteMany([]string{"a"})
+	if old := m.Replace(map[string]int{"c": 3}); !maps.Equal(old, map[string]int{"b": 2}) {
+		t.Errorf("Replace(): Expected the previous content, got %v", old)
+	}
+	if old := m.Drain(); !maps.Equal(old, map[string]int{"c": 3}) {
+		t.Errorf("Drain(): Expected the content, got %v", old)
+	}
+	expected := []internal.Event[string, int]{
+		{Op: internal.OpStore, Key: "b", New: 2},
+		{Op: internal.OpDelete, Key: "a", Old: 1, Loaded: true, Deleted: true},
+		{Op: internal.OpDelete, Key: "b", Old: 2, Loaded: true, Deleted: true},
+		{Op: internal.OpStore, Key: "c", New: 3},
+		{Op: internal.OpClear, Key: "c", Old: 3, Loaded: true, Deleted: true},
+	}
+	for i, want := range expected {
+		if got := receive(t, ch); got != want {
+			t.Errorf("WatchAll(): Expected event %d to be %+v, got %+v", i, want, got)
+		}
+	}
+}
+
+func TestBulkVariants(t *testing.T) {
+	s := internal.NewShardedMap(4, intHash, internal.WithStats[int]())
+	s.StoreMany(map[int]int{1: 1, 2: 2, 3: 3, 5: 5})
+	if st := s.Stats(); st.Writes != 4 || s.Len() != 4 {
+		t.Errorf("StoreMany(): Expected every shard to be locked once, got %+v", st)
+	}
+	if v := s.LoadMany([]int{1, 5, 7}); !maps.Equal(v, map[int]int{1: 1, 5: 5}) {
+		t.Errorf("LoadMany(): Expected the present keys, got %v", v)
+	}
+	if n := s.DeleteMany([]int{1, 5, 7}); n != 2 {
+		t.Errorf("DeleteMany(): Expected 2 keys removed, got %d", n)
+	}
+	if old := s.Replace(map[int]int{4: 4}); !maps.Equal(old, map[int]int{2: 2, 3: 3}) {
+		t.Errorf("Replace(): Expected the previous content, got %v", old)
+	}
+	if old := s.Drain(); !maps.Equal(old, map[int]int{4: 4}) || s.Len() != 0 {
+		t.Errorf("Drain(): Expected the content and an empty map, got %v", old)
+	}
+
+	c := internal.NewCOWMap(map[string]int{"a": 1})
+	c.StoreMany(map[string]int{"b": 2})
+	if v := c.LoadMany([]string{"a", "b"}); len(v) != 2 {
+		t.Errorf("LoadMany(): Expected the published keys, got %v", v)
+	}
+	if old := c.Drain(); len(old) != 2 || c.Len() != 0 {
+		t.Errorf("Drain(): Expected the content and an empty map, got %v", old)
+	}
+	if keys, _ := c.Entries(); len(keys) != 0 {
+		t.Errorf("Entries(): Expected the drain to be published, got %v", keys)
+	}
+
+	dir := t.TempDir()
+	p := openPersistent(t, dir, internal.PersistentOptions[string, int]{})
+	p.StoreMany(map[string]int{"a": 1, "b": 2, "c": 3})
+	p.DeleteMany([]string{"a"})
+	p.Replace(map[string]int{"b": 20, "d": 4})
+	p.Close()
+	p = openPersistent(t, dir, internal.PersistentOptions[string, int]{})
+	if v := p.LoadMany([]string{"a", "b", "c", "d"}); !maps.Equal(v, map[string]int{"b": 20, "d": 4}) {
+		t.Errorf("OpenPersistentMap(): Expected the bulk changes to be logged, got %v", v)
+	}
+	p.Drain()
+	p.Close()
+	p = openPersistent(t, dir, internal.PersistentOptions[string, int]{})
+	defer p.Close()
+	if p.Len() != 0 {
+		t.Errorf("OpenPersistentMap(): Expected the drain to be logged, got %v", p.Keys())
+	}
+}
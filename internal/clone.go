@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"container/list"
+	"maps"
+)
+
+// WithCopy sets the function used by Snapshot and Clone to copy values, so that the copies do not share memory
+// with the values stored in the map. It is needed when V is or holds a pointer, a slice or a map that is
+// modified in place, for instance within Exclusive. By default values are copied by assignment.
+func WithCopy[V any](copyValue func(V) V) Option[V] {
+	return func(o *Options[V]) {
+		o.Copy = copyValue
+	}
+}
+
+// cloner is implemented by the maps that can be cloned with their options.
+type cloner[K comparable, V any] interface {
+	clone() *Map[K, V]
+}
+
+// deriver is implemented by the maps that can create a Map holding other data with their options.
+type deriver[K comparable, V any] interface {
+	derive(data map[K]V) *Map[K, V]
+}
+
+// derive returns a Map holding data with the Equal, Copy and Stats options of m, if m has options, see newMap.
+func derive[K comparable, V any](m any, data map[K]V) *Map[K, V] {
+	if d, ok := m.(deriver[K, V]); ok {
+		return d.derive(data)
+	}
+	return newMap(data)
+}
+
+// snapshotter is implemented by the maps that can return a copy of their content.
+type snapshotter[K comparable, V any] interface {
+	Snapshot() map[K]V
+}
+
+// Clone returns a new Map holding a snapshot of m, see Snapshot. The new map uses the Equal and Copy
+// options of m and records lock statistics if m does. The clone of a sharded, copy-on-write, bounded, persistent
+// or ordered map is a plain Map, see OrderedMap.Clone to keep the order.
+func Clone[K comparable, V any](m snapshotter[K, V]) *Map[K, V] {
+	if c, ok := m.(cloner[K, V]); ok {
+		return c.clone()
+	}
+	return newMap(m.Snapshot())
+}
+
+// Snapshot returns a copy of the content of the map taken under a single read lock.
+// Values are copied with the function set by WithCopy, if any.
+func (m *Map[K, V]) Snapshot() map[K]V {
+	defer m.runlock(m.rlock())
+	return copyValues(m.data, m.copy)
+}
+
+// clone implements Clone.
+func (m *Map[K, V]) clone() *Map[K, V] {
+	return m.derive(m.Snapshot())
+}
+
+// derive returns a Map holding data with the options of m, data is not copied.
+func (m *Map[K, V]) derive(data map[K]V) *Map[K, V] {
+	return &Map[K, V]{data: data, eq: m.eq, copy: m.copy, stats: newLockStats(m.stats != nil)}
+}
+
+// Snapshot returns a copy of the content of the map taken while all the shards are read locked.
+// Values are copied with the function set by WithCopy, if any.
+func (s *ShardedMap[K, V]) Snapshot() map[K]V {
+	defer s.runlock(s.rlock())
+	data := s.merged()
+	if copyValue := s.shards[0].copy; copyValue != nil {
+		for key, value := range data {
+			data[key] = copyValue(value)
+		}
+	}
+	return data
+}
+
+// clone implements Clone.
+func (s *ShardedMap[K, V]) clone() *Map[K, V] {
+	return s.derive(s.Snapshot())
+}
+
+// derive returns a Map holding data with the options of the shards, data is not copied.
+func (s *ShardedMap[K, V]) derive(data map[K]V) *Map[K, V] {
+	return s.shards[0].derive(data)
+}
+
+// Snapshot returns a copy of the published copy of the map, without locking.
+func (c *COWMap[K, V]) Snapshot() map[K]V {
+	return maps.Clone(c.data())
+}
+
+// Clone returns a new OrderedMap holding a copy of the map, with its keys in the same order, taken under a single
+// read lock. Values are copied with the function set by WithCopy, if any. The new map uses the Equal and Copy
+// options of m and records lock statistics if m does.
+func (m *OrderedMap[K, V]) Clone() *OrderedMap[K, V] {
+	defer m.Map.runlock(m.Map.rlock())
+	c := &OrderedMap[K, V]{
+		Map:   &Map[K, V]{data: make(map[K]V, len(m.Map.data)), eq: m.Map.eq, copy: m.Map.copy, stats: newLockStats(m.Map.stats != nil)},
+		order: list.New(),
+		elems: make(map[K]*list.Element, len(m.elems)),
+	}
+	c.Map.obs = c
+	m.keys(func(key K) bool {
+		value := m.Map.data[key]
+		if m.Map.copy != nil {
+			value = m.Map.copy(value)
+		}
+		c.Map.data[key] = value
+		c.elems[key] = c.order.PushBack(key)
+		return true
+	})
+	return c
+}
+
+// copyValues returns a copy of data with its values copied by copyValue, or assigned if copyValue is nil.
+func copyValues[K comparable, V any](data map[K]V, copyValue func(V) V) map[K]V {
+	if copyValue == nil {
+		return maps.Clone(data)
+	}
+	values := make(map[K]V, len(data))
+	for key, value := range data {
+		values[key] = copyValue(value)
+	}
+	return values
+}
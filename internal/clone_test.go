@@ -0,0 +1,109 @@
+package internal_test
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+func TestSnapshotIndependent(t *testing.T) {
+	m := internal.NewMap(map[string]int{"a": 1, "b": 2})
+	snap := m.Snapshot()
+	snap["c"] = 3
+	if m.Has("c") || !maps.Equal(m.Snapshot(), map[string]int{"a": 1, "b": 2}) {
+		t.Errorf("Snapshot(): Expected an independent copy, got %v", m.Keys())
+	}
+}
+
+func TestSnapshotCopy(t *testing.T) {
+	m := internal.NewMap(map[string][]int{"a": {1, 2}}, internal.WithCopy(slices.Clone[[]int]))
+	snap := m.Snapshot()
+	clone := internal.Clone(m)
+	m.Exclusive(func(data map[string][]int) { data["a"][0] = 100 })
+	if snap["a"][0] != 1 {
+		t.Errorf("Snapshot(): Expected the values to be copied, got %v", snap["a"])
+	}
+	if v, _ := clone.Load("a"); v[0] != 1 {
+		t.Errorf("Clone(): Expected the values to be copied, got %v", v)
+	}
+	// the clone keeps the copy function.
+	snap = clone.Snapshot()
+	snap["a"][1] = 200
+	if v, _ := clone.Load("a"); v[1] != 2 {
+		t.Errorf("Snapshot(): Expected the clone values to be copied, got %v", v)
+	}
+}
+
+func TestClone(t *testing.T) {
+	m := internal.NewMap(map[string]int{"a": 1}, internal.WithEqual(func(a, b int) bool { return a%10 == b%10 }), internal.WithStats[int]())
+	c := internal.Clone(m)
+	c.Store("b", 2)
+	if m.Has("b") {
+		t.Errorf("Clone(): Expected an independent map")
+	}
+	if !c.CompareAndSwap("a", 11, 3) {
+		t.Errorf("Clone(): Expected the clone to keep the Equal option")
+	}
+	if st := c.Stats(); st.Writes != 2 {
+		t.Errorf("Clone(): Expected the clone to record its own stats, got %+v", st)
+	}
+
+	s := internal.NewShardedMap[int, int](4, intHash)
+	s.StoreMany(map[int]int{1: 1, 2: 2, 3: 3})
+	if c := internal.Clone(s); !maps.Equal(maps.Collect(c.All()), map[int]int{1: 1, 2: 2, 3: 3}) {
+		t.Errorf("Clone(): Expected the content of every shard, got %v", c.Keys())
+	}
+
+	cow := internal.NewCOWMap(map[string]int{"a": 1})
+	snap := cow.Snapshot()
+	snap["b"] = 2
+	if cow.Has("b") || internal.Clone(cow).Len() != 1 {
+		t.Errorf("Snapshot(): Expected an independent copy")
+	}
+
+	b := internal.NewBoundedMap[string, int](1, internal.NewLRUPolicy[string]())
+	b.Store("a", 1)
+	bc := internal.Clone(b)
+	bc.Store("b", 2)
+	if bc.Len() != 2 || b.Len() != 1 {
+		t.Errorf("Clone(): Expected the clone of a bounded map to be unbounded, got %d keys", bc.Len())
+	}
+}
+
+func TestSnapshotConsistent(t *testing.T) {
+	// transfers between two keys keep the total constant, a consistent snapshot always sees the same total.
+	for name, m := range map[string]interface {
+		Update(int, func(int, bool) int)
+		Snapshot() map[int]int
+		Exclusive(func(map[int]int))
+	}{
+		"map":     internal.NewMap(map[int]int{0: 1000, 1: 1000}),
+		"sharded": internal.NewShardedMap[int, int](2, intHash),
+	} {
+		m.Exclusive(func(data map[int]int) { data[0], data[1] = 1000, 1000 })
+		var wg sync.WaitGroup
+		done := make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				m.Exclusive(func(data map[int]int) { data[i%2]--; data[(i+1)%2]++ })
+			}
+		}()
+		for range 1000 {
+			if snap := m.Snapshot(); snap[0]+snap[1] != 2000 {
+				t.Fatalf("%s: Snapshot(): Expected a total of 2000, got %v", name, snap)
+			}
+		}
+		close(done)
+		wg.Wait()
+	}
+}
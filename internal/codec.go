@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Codec converts keys or values to and from bytes, it is used by PersistentMap to write its log.
+// Implementations must be safe for concurrent use.
+type Codec[T any] interface {
+	// Marshal returns the encoding of v.
+	Marshal(v T) ([]byte, error)
+	// Unmarshal decodes a value encoded by Marshal.
+	Unmarshal(data []byte) (T, error)
+}
+
+// GobCodec encodes values with encoding/gob, it supports any type supported by gob.
+type GobCodec[T any] struct{}
+
+// Marshal returns the gob encoding of v.
+func (GobCodec[T]) Marshal(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes a value encoded by Marshal.
+func (GobCodec[T]) Unmarshal(data []byte) (v T, err error) {
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
+
+// JSONCodec encodes values with encoding/json, it produces a readable log for types with a JSON encoding.
+type JSONCodec[T any] struct{}
+
+// Marshal returns the JSON encoding of v.
+func (JSONCodec[T]) Marshal(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes a value encoded by Marshal.
+func (JSONCodec[T]) Unmarshal(data []byte) (v T, err error) {
+	err = json.Unmarshal(data, &v)
+	return v, err
+}
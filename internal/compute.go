@@ -0,0 +1,126 @@
+package internal
+
+// ComputeOp is the action taken by Compute on the key once its function returns.
+type ComputeOp uint8
+
+const (
+	ComputeKeep   ComputeOp = iota // the entry is left unchanged, the returned value is ignored.
+	ComputeStore                   // the returned value is stored.
+	ComputeDelete                  // the key is removed, the returned value is ignored.
+)
+
+// ComputeIfAbsent returns the value for key if present, otherwise it stores and returns the value returned by f.
+// f is called only if the key is not present. The loaded result is true if the value was loaded, false if computed.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (m *Map[K, V]) ComputeIfAbsent(key K, f func() V) (actual V, loaded bool) {
+	m.lock()
+	defer m.unlock()
+	return m.computeIfAbsent(key, f)
+}
+
+// computeIfAbsent implements ComputeIfAbsent, the caller must hold the write lock.
+func (m *Map[K, V]) computeIfAbsent(key K, f func() V) (actual V, loaded bool) {
+	if actual, loaded = m.get(key); loaded {
+		return actual, true
+	}
+	actual = f()
+	m.set(OpCompute, key, actual)
+	return actual, false
+}
+
+// ComputeIfPresent calls f with the value for key if present, and stores the value returned by f if keep is true
+// or removes the key otherwise. f is not called if the key is not present.
+// It returns the value for key once f returns, ok is false if the key is not present.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (m *Map[K, V]) ComputeIfPresent(key K, f func(V) (value V, keep bool)) (value V, ok bool) {
+	m.lock()
+	defer m.unlock()
+	old, ok := m.data[key]
+	if !ok {
+		return value, false
+	}
+	value, keep := f(old)
+	if !keep {
+		m.del(OpCompute, key)
+		var zero V
+		return zero, false
+	}
+	m.set(OpCompute, key, value)
+	return value, true
+}
+
+// Compute calls f with the value for key, loaded reporting whether the key is present, and keeps the entry
+// unchanged, stores the value returned by f or removes the key depending on the ComputeOp returned by f.
+// It returns the value for key once f returns, ok is false if the key is not present.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (m *Map[K, V]) Compute(key K, f func(value V, loaded bool) (V, ComputeOp)) (value V, ok bool) {
+	m.lock()
+	defer m.unlock()
+	old, loaded := m.data[key]
+	value, op := f(old, loaded)
+	switch op {
+	case ComputeStore:
+		m.set(OpCompute, key, value)
+		return value, true
+	case ComputeDelete:
+		m.del(OpCompute, key)
+		var zero V
+		return zero, false
+	}
+	return old, loaded
+}
+
+// Merge stores value for key if the key is not present, otherwise it stores the value returned by f called
+// with the current value and value. It returns the value stored.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (m *Map[K, V]) Merge(key K, value V, f func(old, new V) V) V {
+	m.lock()
+	defer m.unlock()
+	if old, ok := m.data[key]; ok {
+		value = f(old, value)
+	}
+	m.set(OpMerge, key, value)
+	return value
+}
+
+// ComputeIfAbsent is the same as Map.ComputeIfAbsent, only the shard owning key is locked.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (s *ShardedMap[K, V]) ComputeIfAbsent(key K, f func() V) (actual V, loaded bool) {
+	return s.shard(key).ComputeIfAbsent(key, f)
+}
+
+// ComputeIfPresent is the same as Map.ComputeIfPresent, only the shard owning key is locked.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (s *ShardedMap[K, V]) ComputeIfPresent(key K, f func(V) (value V, keep bool)) (value V, ok bool) {
+	return s.shard(key).ComputeIfPresent(key, f)
+}
+
+// Compute is the same as Map.Compute, only the shard owning key is locked.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (s *ShardedMap[K, V]) Compute(key K, f func(value V, loaded bool) (V, ComputeOp)) (value V, ok bool) {
+	return s.shard(key).Compute(key, f)
+}
+
+// Merge is the same as Map.Merge, only the shard owning key is locked.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (s *ShardedMap[K, V]) Merge(key K, value V, f func(old, new V) V) V {
+	return s.shard(key).Merge(key, value, f)
+}
+
+// ComputeIfAbsent is the same as Map.ComputeIfAbsent, the map is locked only if the key is not present.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (c *COWMap[K, V]) ComputeIfAbsent(key K, f func() V) (actual V, loaded bool) {
+	if actual, ok := c.data()[key]; ok {
+		return actual, true
+	}
+	return c.Map.ComputeIfAbsent(key, f)
+}
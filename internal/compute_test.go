@@ -0,0 +1,145 @@
+package internal_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+func TestMapComputeIfAbsent(t *testing.T) {
+	m := internal.NewMap(map[string]int{"a": 1})
+	if v, loaded := m.ComputeIfAbsent("a", func() int { t.Errorf("Expected f not to be called"); return 0 }); !loaded || v != 1 {
+		t.Errorf("ComputeIfAbsent(): Expected to load 1, got %d, %v", v, loaded)
+	}
+	if v, loaded := m.ComputeIfAbsent("b", func() int { return 2 }); loaded || v != 2 {
+		t.Errorf("ComputeIfAbsent(): Expected to compute 2, got %d, %v", v, loaded)
+	}
+	if v, ok := m.Load("b"); !ok || v != 2 {
+		t.Errorf("Load(): Expected 2, got %d", v)
+	}
+}
+
+func TestMapComputeIfPresent(t *testing.T) {
+	m := internal.NewMap(map[string]int{"a": 1, "b": 2})
+	if v, ok := m.ComputeIfPresent("c", func(int) (int, bool) { t.Errorf("Expected f not to be called"); return 0, true }); ok || v != 0 || m.Has("c") {
+		t.Errorf("ComputeIfPresent(): Expected absent key to stay absent, got %d, %v", v, ok)
+	}
+	if v, ok := m.ComputeIfPresent("a", func(v int) (int, bool) { return v + 10, true }); !ok || v != 11 {
+		t.Errorf("ComputeIfPresent(): Expected 11, got %d, %v", v, ok)
+	}
+	if v, ok := m.ComputeIfPresent("b", func(v int) (int, bool) { return v, false }); ok || v != 0 || m.Has("b") {
+		t.Errorf("ComputeIfPresent(): Expected b to be deleted, got %d, %v", v, ok)
+	}
+	if v, _ := m.Load("a"); v != 11 {
+		t.Errorf("Load(): Expected 11, got %d", v)
+	}
+}
+
+func TestMapCompute(t *testing.T) {
+	m := internal.NewMap(map[string]int{"a": 1})
+	if v, ok := m.Compute("a", func(v int, loaded bool) (int, internal.ComputeOp) { return 100, internal.ComputeKeep }); !ok || v != 1 {
+		t.Errorf("Compute(): Expected keep to return 1, got %d, %v", v, ok)
+	}
+	if v, ok := m.Compute("b", func(v int, loaded bool) (int, internal.ComputeOp) { return 100, internal.ComputeKeep }); ok || v != 0 || m.Has("b") {
+		t.Errorf("Compute(): Expected keep on an absent key not to store, got %d, %v", v, ok)
+	}
+	if v, ok := m.Compute("b", func(v int, loaded bool) (int, internal.ComputeOp) {
+		if loaded {
+			t.Errorf("Compute(): Expected b to be absent")
+		}
+		return 2, internal.ComputeStore
+	}); !ok || v != 2 {
+		t.Errorf("Compute(): Expected store to return 2, got %d, %v", v, ok)
+	}
+	if v, ok := m.Compute("a", func(v int, loaded bool) (int, internal.ComputeOp) { return v, internal.ComputeDelete }); ok || v != 0 || m.Has("a") {
+		t.Errorf("Compute(): Expected a to be deleted, got %d, %v", v, ok)
+	}
+	if m.Len() != 1 {
+		t.Errorf("Len(): Expected 1, got %d", m.Len())
+	}
+}
+
+func TestMapMerge(t *testing.T) {
+	m := internal.NewMap[string, []string](nil)
+	appendAll := func(old, new []string) []string { return append(old, new...) }
+	m.Merge("a", []string{"x"}, appendAll)
+	if v := m.Merge("a", []string{"y", "z"}, appendAll); len(v) != 3 {
+		t.Errorf("Merge(): Expected 3 values, got %v", v)
+	}
+
+	counts := internal.NewMap[string, int](nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				counts.Merge("n", 1, func(old, new int) int { return old + new })
+			}
+		}()
+	}
+	wg.Wait()
+	if v, _ := counts.Load("n"); v != 800 {
+		t.Errorf("Merge(): Expected 800, got %d", v)
+	}
+}
+
+func TestMapComputeEvents(t *testing.T) {
+	m := internal.NewMap[string, int](nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := m.WatchAll(ctx, internal.WithWatchBuffer(32))
+
+	m.ComputeIfAbsent("a", func() int { return 1 })
+	m.ComputeIfAbsent("a", func() int { return 2 }) // loaded, no event.
+	m.ComputeIfPresent("a", func(v int) (int, bool) { return v + 1, true })
+	m.Compute("a", func(v int, loaded bool) (int, internal.ComputeOp) { return 0, internal.ComputeKeep }) // no event.
+	m.Compute("a", func(v int, loaded bool) (int, internal.ComputeOp) { return 0, internal.ComputeDelete })
+	m.Merge("b", 1, func(old, new int) int { return old + new })
+	m.Merge("b", 1, func(old, new int) int { return old + new })
+
+	expected := []internal.Event[string, int]{
+		{Op: internal.OpCompute, Key: "a", New: 1},
+		{Op: internal.OpCompute, Key: "a", Old: 1, Loaded: true, New: 2},
+		{Op: internal.OpCompute, Key: "a", Old: 2, Loaded: true, Deleted: true},
+		{Op: internal.OpMerge, Key: "b", New: 1},
+		{Op: internal.OpMerge, Key: "b", Old: 1, Loaded: true, New: 2},
+	}
+	for i, want := range expected {
+		if got := receive(t, ch); got != want {
+			t.Errorf("WatchAll(): Expected event %d to be %+v, got %+v", i, want, got)
+		}
+	}
+	if internal.OpCompute.String() != "Compute" || internal.OpMerge.String() != "Merge" {
+		t.Errorf("String(): Expected Compute and Merge, got %s and %s", internal.OpCompute, internal.OpMerge)
+	}
+}
+
+func TestComputeVariants(t *testing.T) {
+	s := internal.NewShardedMap[int, int](4, intHash)
+	s.ComputeIfAbsent(1, func() int { return 1 })
+	s.Merge(1, 2, func(old, new int) int { return old + new })
+	s.ComputeIfPresent(1, func(v int) (int, bool) { return v * 2, true })
+	if v, ok := s.Compute(1, func(v int, loaded bool) (int, internal.ComputeOp) { return v + 1, internal.ComputeStore }); !ok || v != 7 {
+		t.Errorf("Compute(): Expected 7, got %d", v)
+	}
+
+	c := internal.NewCOWMap(map[string]int{"a": 1})
+	if v, loaded := c.ComputeIfAbsent("a", func() int { t.Errorf("Expected f not to be called"); return 0 }); !loaded || v != 1 {
+		t.Errorf("ComputeIfAbsent(): Expected to load 1, got %d", v)
+	}
+	c.ComputeIfAbsent("b", func() int { return 2 })
+	c.Compute("a", func(v int, loaded bool) (int, internal.ComputeOp) { return 0, internal.ComputeDelete })
+	if keys := c.Keys(); len(keys) != 1 || keys[0] != "b" {
+		t.Errorf("Keys(): Expected the changes to be published, got %v", keys)
+	}
+
+	b := internal.NewBoundedMap[string, int](1, internal.NewLRUPolicy[string]())
+	b.ComputeIfAbsent("a", func() int { return 1 })
+	b.Merge("b", 2, func(old, new int) int { return old + new })
+	if keys := b.Keys(); len(keys) != 1 || keys[0] != "b" {
+		t.Errorf("Keys(): Expected a to be evicted, got %v", keys)
+	}
+}
@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// waitQueue queues the callers of lockContext waiting for a busy lock. A single goroutine per lock waits for the
+// lock on behalf of the queue and hands it over to the first caller still waiting, so a caller giving up leaves
+// nothing behind: at most one goroutine waits for a busy lock whatever the number of cancelled callers, and it
+// returns once the lock is released and nobody waits.
+type waitQueue struct {
+	mu      sync.Mutex
+	waiters []*waiter
+	serving bool // true while the goroutine serving the queue runs.
+}
+
+// waiter is a caller of lockContext waiting in a waitQueue.
+type waiter struct {
+	ready   chan struct{} // closed once the lock is handed over.
+	granted bool          // guarded by waitQueue.mu.
+}
+
+// lockContext acquires a lock, giving up and returning ctx.Err() if ctx is done before the lock is acquired.
+//
+// tryLock is attempted first. If the lock is busy the caller joins the queue, the goroutine serving the queue
+// waits for the lock with lock, so that the callers queue with the other writers and block new readers as Lock
+// does, and hands it over to them in order. If ctx is done first the caller leaves the queue.
+func (q *waitQueue) lockContext(ctx context.Context, tryLock func() bool, lock, unlock func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if tryLock() {
+		return nil
+	}
+	w := &waiter{ready: make(chan struct{})}
+	q.mu.Lock()
+	q.waiters = append(q.waiters, w)
+	if !q.serving {
+		q.serving = true
+		go q.serve(lock, unlock)
+	}
+	q.mu.Unlock()
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if w.granted {
+		// the lock was handed over while ctx was done, it is acquired.
+		return nil
+	}
+	q.waiters = slices.DeleteFunc(q.waiters, func(other *waiter) bool { return other == w })
+	return ctx.Err()
+}
+
+// serve acquires the lock for the waiters of the queue, one at a time, until the queue is empty.
+func (q *waitQueue) serve(lock, unlock func()) {
+	for {
+		q.mu.Lock()
+		if len(q.waiters) == 0 {
+			q.serving = false
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Unlock()
+		lock()
+		q.mu.Lock()
+		if len(q.waiters) == 0 {
+			// every waiter gave up while the lock was busy.
+			q.mu.Unlock()
+			unlock()
+			continue
+		}
+		w := q.waiters[0]
+		q.waiters = slices.Delete(q.waiters, 0, 1)
+		w.granted = true
+		close(w.ready)
+		q.mu.Unlock()
+	}
+}
+
+// StoreContext is the same as Store but gives up and returns ctx.Err() if ctx is done before the lock is acquired.
+func (m *Map[K, V]) StoreContext(ctx context.Context, key K, value V) error {
+	if err := m.lockContext(ctx); err != nil {
+		return err
+	}
+	defer m.unlock()
+	m.set(OpStore, key, value)
+	return nil
+}
+
+// LoadOrStoreContext is the same as LoadOrStore but gives up and returns ctx.Err() if ctx is done before the lock is acquired.
+func (m *Map[K, V]) LoadOrStoreContext(ctx context.Context, key K, value V) (actual V, loaded bool, err error) {
+	if err := m.lockContext(ctx); err != nil {
+		return actual, false, err
+	}
+	defer m.unlock()
+	actual, loaded = m.loadOrStore(key, value)
+	return actual, loaded, nil
+}
+
+// UpdateContext is the same as Update but gives up and returns ctx.Err() if ctx is done before the lock is acquired.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (m *Map[K, V]) UpdateContext(ctx context.Context, key K, f func(V, bool) V) error {
+	if err := m.lockContext(ctx); err != nil {
+		return err
+	}
+	defer m.unlock()
+	m.update(key, f)
+	return nil
+}
+
+// ExclusiveContext is the same as Exclusive but gives up and returns ctx.Err() if ctx is done before the lock is acquired.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (m *Map[K, V]) ExclusiveContext(ctx context.Context, f func(m map[K]V)) error {
+	if err := m.lockContext(ctx); err != nil {
+		return err
+	}
+	defer m.unlock()
+	m.exclusive(f)
+	return nil
+}
+
+// StoreContext is the same as Store but gives up and returns ctx.Err() if ctx is done before the shard lock is acquired.
+func (s *ShardedMap[K, V]) StoreContext(ctx context.Context, key K, value V) error {
+	return s.shard(key).StoreContext(ctx, key, value)
+}
+
+// LoadOrStoreContext is the same as LoadOrStore but gives up and returns ctx.Err() if ctx is done before the shard lock is acquired.
+func (s *ShardedMap[K, V]) LoadOrStoreContext(ctx context.Context, key K, value V) (actual V, loaded bool, err error) {
+	return s.shard(key).LoadOrStoreContext(ctx, key, value)
+}
+
+// UpdateContext is the same as Update but gives up and returns ctx.Err() if ctx is done before the shard lock is acquired.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (s *ShardedMap[K, V]) UpdateContext(ctx context.Context, key K, f func(V, bool) V) error {
+	return s.shard(key).UpdateContext(ctx, key, f)
+}
+
+// ExclusiveContext is the same as Exclusive but gives up and returns ctx.Err() if ctx is done before every shard is locked.
+// The shards locked before ctx is done are released.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (s *ShardedMap[K, V]) ExclusiveContext(ctx context.Context, f func(m map[K]V)) error {
+	if err := s.lockContext(ctx); err != nil {
+		return err
+	}
+	defer s.unlock()
+	s.exclusive(f)
+	return nil
+}
+
+// LoadOrStoreContext is the same as LoadOrStore, the map is locked only if the key is not present.
+func (c *COWMap[K, V]) LoadOrStoreContext(ctx context.Context, key K, value V) (actual V, loaded bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return actual, false, err
+	}
+	if actual, ok := c.data()[key]; ok {
+		return actual, true, nil
+	}
+	return c.Map.LoadOrStoreContext(ctx, key, value)
+}
+
+// StoreContext is the same as Store but gives up and returns ctx.Err() if ctx is done before the lock is acquired.
+func (m *Value[V]) StoreContext(ctx context.Context, value V) error {
+	if err := m.lockContext(ctx); err != nil {
+		return err
+	}
+	defer m.unlock()
+	m.store(value)
+	return nil
+}
+
+// LoadOrStoreContext is the same as LoadOrStore but gives up and returns ctx.Err() if ctx is done before the lock is acquired.
+func (m *Value[V]) LoadOrStoreContext(ctx context.Context, value V) (actual V, loaded bool, err error) {
+	if err := m.lockContext(ctx); err != nil {
+		return actual, false, err
+	}
+	defer m.unlock()
+	actual, loaded = m.loadOrStore(value)
+	return actual, loaded, nil
+}
+
+// ExclusiveContext is the same as Exclusive but gives up and returns ctx.Err() if ctx is done before the lock is acquired.
+//
+// ! Do not invoke any Value or Numeric functions within 'f' to prevent a deadlock.
+func (m *Value[V]) ExclusiveContext(ctx context.Context, update func(actual V, loaded bool) V) (updated V, err error) {
+	if err := m.lockContext(ctx); err != nil {
+		return updated, err
+	}
+	defer m.unlock()
+	return m.exclusive(update), nil
+}
@@ -0,0 +1,262 @@
+package internal_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+// holdLock runs lock in a goroutine and returns once lock is blocking, release makes lock return.
+func holdLock(lock func(wait func())) (release func()) {
+	held := make(chan struct{})
+	done := make(chan struct{})
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		lock(func() {
+			close(held)
+			<-done
+		})
+	}()
+	<-held
+	return func() {
+		close(done)
+		<-released
+	}
+}
+
+func TestMapContextDone(t *testing.T) {
+	m := internal.NewMap[string, int](nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	if err := m.StoreContext(ctx, "a", 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("StoreContext(): Expected context.Canceled, got %v", err)
+	}
+	if _, _, err := m.LoadOrStoreContext(ctx, "a", 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("LoadOrStoreContext(): Expected context.Canceled, got %v", err)
+	}
+	if err := m.UpdateContext(ctx, "a", func(v int, ok bool) int { called = true; return 1 }); !errors.Is(err, context.Canceled) {
+		t.Errorf("UpdateContext(): Expected context.Canceled, got %v", err)
+	}
+	if err := m.ExclusiveContext(ctx, func(data map[string]int) { called = true }); !errors.Is(err, context.Canceled) {
+		t.Errorf("ExclusiveContext(): Expected context.Canceled, got %v", err)
+	}
+	if called || m.Len() != 0 {
+		t.Errorf("Context(): Expected map to be unchanged once the context is done")
+	}
+
+	ctx = context.Background()
+	if err := m.StoreContext(ctx, "a", 1); err != nil {
+		t.Errorf("StoreContext(): Expected no error, got %v", err)
+	}
+	if v, loaded, err := m.LoadOrStoreContext(ctx, "a", 2); err != nil || !loaded || v != 1 {
+		t.Errorf("LoadOrStoreContext(): Expected loaded value 1, got %d, %v", v, err)
+	}
+	m.UpdateContext(ctx, "a", func(v int, ok bool) int { return v + 1 })
+	m.ExclusiveContext(ctx, func(data map[string]int) { data["a"] *= 10 })
+	if v, _ := m.Load("a"); v != 20 {
+		t.Errorf("ExclusiveContext(): Expected value 20, got %d", v)
+	}
+}
+
+func TestMapContextTimeout(t *testing.T) {
+	m := internal.NewMap[string, int](nil)
+	before := runtime.NumGoroutine()
+	release := holdLock(func(wait func()) {
+		m.Exclusive(func(map[string]int) { wait() })
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := m.UpdateContext(ctx, "a", func(v int, ok bool) int { return 1 })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("UpdateContext(): Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("UpdateContext(): Expected to give up at the deadline, took %v", elapsed)
+	}
+	release()
+	if m.Has("a") {
+		t.Errorf("UpdateContext(): Expected map to be unchanged")
+	}
+	// the goroutine waiting for the lock releases it and exits once the lock is released.
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("UpdateContext(): Expected no goroutine to be leaked, got %d goroutines, had %d", n, before)
+	}
+
+	// the lock is acquired once it is released before the deadline.
+	release = holdLock(func(wait func()) {
+		m.Exclusive(func(map[string]int) { wait() })
+	})
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		release()
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.StoreContext(ctx, "a", 1); err != nil || !m.Has("a") {
+		t.Errorf("StoreContext(): Expected the lock to be acquired once released, got %v", err)
+	}
+}
+
+func TestMapContextCancelled(t *testing.T) {
+	for name, stats := range map[string]bool{"Map": false, "stats": true} {
+		t.Run(name, func(t *testing.T) {
+			var opts []internal.Option[int]
+			if stats {
+				opts = append(opts, internal.WithStats[int]())
+			}
+			m := internal.NewMap[string, int](nil, opts...)
+			release := holdLock(func(wait func()) {
+				m.Exclusive(func(map[string]int) { wait() })
+			})
+			before := runtime.NumGoroutine()
+			var wg sync.WaitGroup
+			for range 100 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+					defer cancel()
+					if err := m.StoreContext(ctx, "a", 1); !errors.Is(err, context.DeadlineExceeded) {
+						t.Errorf("StoreContext(): Expected context.DeadlineExceeded, got %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+			// while the lock is held a single goroutine waits for it, whatever the number of cancelled calls.
+			if n := runtime.NumGoroutine(); n > before+1 {
+				t.Errorf("StoreContext(): Expected at most one waiting goroutine, got %d goroutines, had %d", n, before)
+			}
+			release()
+			for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() >= before && time.Now().Before(deadline); {
+				time.Sleep(time.Millisecond)
+			}
+			if n := runtime.NumGoroutine(); n >= before {
+				t.Errorf("StoreContext(): Expected the waiting goroutine to exit, got %d goroutines, had %d", n, before)
+			}
+			if err := m.StoreContext(context.Background(), "a", 1); err != nil || !m.Has("a") {
+				t.Errorf("StoreContext(): Expected the lock to be acquired, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMapContextReadLoad(t *testing.T) {
+	data := make(map[int]int)
+	for i := range 100 {
+		data[i] = i
+	}
+	m := internal.NewMap(data)
+	stop := make(chan struct{})
+	var started, wg sync.WaitGroup
+	for range 8 {
+		started.Add(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			first := true
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// the readers hold the read lock long enough to overlap each other, the lock is never free.
+				for range m.All() {
+					if first {
+						started.Done()
+						first = false
+					}
+					time.Sleep(10 * time.Microsecond)
+				}
+			}
+		}()
+	}
+	started.Wait()
+	defer wg.Wait()
+	defer close(stop)
+	// writers queue for the lock and block new readers, they are not starved by the overlapping readers.
+	for i := range 5 {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		err := m.StoreContext(ctx, -1, i)
+		cancel()
+		if err != nil {
+			t.Fatalf("StoreContext(): Expected the lock to be acquired under read load, got %v", err)
+		}
+	}
+}
+
+func TestShardedMapContext(t *testing.T) {
+	m := internal.NewShardedMap[int, int](4, intHash)
+	release := holdLock(func(wait func()) {
+		m.Update(2, func(v int, ok bool) int { wait(); return v })
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.ExclusiveContext(ctx, func(map[int]int) {}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ExclusiveContext(): Expected context.DeadlineExceeded, got %v", err)
+	}
+	// the shards locked before the deadline are released.
+	if err := m.StoreContext(context.Background(), 1, 1); err != nil {
+		t.Errorf("StoreContext(): Expected no error, got %v", err)
+	}
+	if err := m.UpdateContext(ctx, 2, func(v int, ok bool) int { return 1 }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("UpdateContext(): Expected context.DeadlineExceeded, got %v", err)
+	}
+	release()
+	if err := m.ExclusiveContext(context.Background(), func(data map[int]int) { data[3] = 3 }); err != nil || m.Len() != 3 {
+		t.Errorf("ExclusiveContext(): Expected no error and 3 keys, got %v, %v", err, m.Keys())
+	}
+	if v, loaded, err := m.LoadOrStoreContext(context.Background(), 3, 0); err != nil || !loaded || v != 3 {
+		t.Errorf("LoadOrStoreContext(): Expected loaded value 3, got %d", v)
+	}
+}
+
+func TestValueContext(t *testing.T) {
+	v := internal.NewValue[int]()
+	release := holdLock(func(wait func()) {
+		v.Exclusive(func(actual int, loaded bool) int { wait(); return actual })
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := v.StoreContext(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("StoreContext(): Expected context.DeadlineExceeded, got %v", err)
+	}
+	if _, _, err := v.LoadOrStoreContext(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("LoadOrStoreContext(): Expected context.DeadlineExceeded, got %v", err)
+	}
+	release()
+	if err := v.StoreContext(context.Background(), 1); err != nil {
+		t.Errorf("StoreContext(): Expected no error, got %v", err)
+	}
+	if actual, loaded, _ := v.LoadOrStoreContext(context.Background(), 2); !loaded || actual != 1 {
+		t.Errorf("LoadOrStoreContext(): Expected loaded value 1, got %d", actual)
+	}
+	n := internal.NewNumeric[int]()
+	updated, err := n.ExclusiveContext(context.Background(), func(actual int, loaded bool) int { return actual + 5 })
+	if err != nil || updated != 5 {
+		t.Errorf("ExclusiveContext(): Expected 5, got %d, %v", updated, err)
+	}
+}
+
+func TestCOWMapContext(t *testing.T) {
+	m := internal.NewCOWMap(map[string]int{"a": 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := m.LoadOrStoreContext(ctx, "a", 2); !errors.Is(err, context.Canceled) {
+		t.Errorf("LoadOrStoreContext(): Expected context.Canceled, got %v", err)
+	}
+	if v, loaded, err := m.LoadOrStoreContext(context.Background(), "b", 2); err != nil || loaded || v != 2 || !m.Has("b") {
+		t.Errorf("LoadOrStoreContext(): Expected stored value 2, got %d, %v", v, err)
+	}
+}
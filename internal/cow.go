@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"iter"
+	"maps"
+	"sync/atomic"
+)
+
+// COWMap implements a thread-safe copy-on-write map optimized for read-mostly workloads.
+//
+// Readers load an immutable copy of the map through an atomic pointer and never lock, writers lock the map,
+// change a private copy of the published map and publish it once the lock is released. Every write locking
+// the map copies the whole map, so COWMap should only be used when writes are rare.
+//
+// Load, Has, Len, Keys, Values, Entries, Range and the iterators read the published copy without locking,
+// the other methods behave as the methods of Map.
+type COWMap[K comparable, V any] struct {
+	*Map[K, V]
+	snap   atomic.Pointer[map[K]V] // published copy, never modified.
+	shared bool                    // true if Map.data is the published copy, the map is write locked.
+	dirty  bool                    // true if Map.data changed since it was published, the map is write locked.
+}
+
+// NewCOWMap returns a new COWMap, initialized with the given map. if m is nil, an empty map is created.
+// m key, values are copied, so that the caller can safely modify the map after creating a COWMap.
+func NewCOWMap[K comparable, V any](m map[K]V) *COWMap[K, V] {
+	c := &COWMap[K, V]{Map: NewMap(m), shared: true}
+	data := c.Map.data
+	c.snap.Store(&data)
+	c.Map.obs = c
+	return c
+}
+
+// data returns the published copy of the map.
+func (c *COWMap[K, V]) data() map[K]V {
+	return *c.snap.Load()
+}
+
+// locked copies the published map before it is changed by the writer holding the lock.
+func (c *COWMap[K, V]) locked() {
+	if c.shared {
+		c.Map.data = maps.Clone(c.Map.data)
+		c.shared = false
+	}
+}
+
+func (c *COWMap[K, V]) accessed(key K) {}
+
+func (c *COWMap[K, V]) changed(e Event[K, V]) {
+	c.dirty = true
+}
+
+// changedAll marks the map as changed, Exclusive and Replace do not need to diff the map when nobody watches it.
+func (c *COWMap[K, V]) changedAll() {
+	c.dirty = true
+}
+
+// unlocking publishes the changes made while the lock was held.
+func (c *COWMap[K, V]) unlocking() func() {
+	if c.dirty {
+		data := c.Map.data
+		c.snap.Store(&data)
+		c.shared, c.dirty = true, false
+	}
+	return nil
+}
+
+// Load returns the value stored in the map for a key, or nil if no
+// value is present.
+// The ok result indicates whether value was found in the map.
+func (c *COWMap[K, V]) Load(key K) (v V, ok bool) {
+	v, ok = c.data()[key]
+	return v, ok
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+// The map is locked only if the key is not present.
+func (c *COWMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	if actual, ok := c.data()[key]; ok {
+		return actual, true
+	}
+	return c.Map.LoadOrStore(key, value)
+}
+
+// Has returns true if the map contains the key.
+func (c *COWMap[K, V]) Has(key K) bool {
+	_, ok := c.data()[key]
+	return ok
+}
+
+// Len returns the number of items in the map.
+func (c *COWMap[K, V]) Len() int {
+	return len(c.data())
+}
+
+// Keys returns a slice of all the keys present in the map, an empty slice is returned if the map is empty.
+func (c *COWMap[K, V]) Keys() []K {
+	data := c.data()
+	keys := make([]K, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Values returns a slice of all the values present in the map, an empty slice is returned if the map is empty.
+func (c *COWMap[K, V]) Values() []V {
+	data := c.data()
+	values := make([]V, 0, len(data))
+	for _, value := range data {
+		values = append(values, value)
+	}
+	return values
+}
+
+// Entries returns two slices, one containing all the keys and the other containing all the values present in the map.
+func (c *COWMap[K, V]) Entries() (keys []K, values []V) {
+	data := c.data()
+	keys = make([]K, 0, len(data))
+	values = make([]V, 0, len(data))
+	for key, value := range data {
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	return keys, values
+}
+
+// Range calls f sequentially for each key and value of the published copy of the map.
+// If f returns false, Range stops the iteration. f may call any method on the map.
+func (c *COWMap[K, V]) Range(f func(K, V) bool) {
+	for key, value := range c.data() {
+		if !f(key, value) {
+			return
+		}
+	}
+}
+
+// All returns an iterator over the key-value pairs of the copy of the map published when the loop starts.
+// The map is not locked, the loop body may call any method on the map.
+func (c *COWMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for key, value := range c.data() {
+			if !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// KeysSeq returns an iterator over the keys of the copy of the map published when the loop starts.
+// The map is not locked, the loop body may call any method on the map.
+func (c *COWMap[K, V]) KeysSeq() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for key := range c.data() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// ValuesSeq returns an iterator over the values of the copy of the map published when the loop starts.
+// The map is not locked, the loop body may call any method on the map.
+func (c *COWMap[K, V]) ValuesSeq() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, value := range c.data() {
+			if !yield(value) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package internal_test
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+func TestCOWMap(t *testing.T) {
+	m := internal.NewCOWMap(map[string]int{"a": 1})
+	if v, ok := m.Load("a"); !ok || v != 1 {
+		t.Errorf("Load(): Expected value 1, got %d", v)
+	}
+	m.Store("b", 2)
+	if v, loaded := m.LoadOrStore("b", 20); !loaded || v != 2 {
+		t.Errorf("LoadOrStore(): Expected loaded value 2, got %d", v)
+	}
+	if v, loaded := m.LoadOrStore("c", 3); loaded || v != 3 {
+		t.Errorf("LoadOrStore(): Expected stored value 3, got %d", v)
+	}
+	if !m.CompareAndSwap("a", 1, 10) || m.CompareAndSwap("a", 1, 100) {
+		t.Errorf("CompareAndSwap(): Expected only the first swap to succeed")
+	}
+	m.Update("a", func(v int, ok bool) int { return v + 1 })
+	m.Delete("c")
+	keys := m.Keys()
+	sort.Strings(keys)
+	if m.Len() != 2 || len(keys) != 2 || keys[0] != "a" || keys[1] != "b" || m.Has("c") {
+		t.Errorf("Keys(): Expected keys [a b], got %v", keys)
+	}
+	if v, _ := m.Load("a"); v != 11 {
+		t.Errorf("Load(): Expected value 11, got %d", v)
+	}
+	m.Exclusive(func(data map[string]int) {
+		data["d"] = 4
+		delete(data, "b")
+	})
+	m.Transaction(func(tx internal.Tx[string, int]) error {
+		tx.Store("e", 5)
+		return nil
+	})
+	keys, values := m.Entries()
+	sum := 0
+	for _, v := range values {
+		sum += v
+	}
+	if len(keys) != 3 || sum != 20 || len(m.Values()) != 3 {
+		t.Errorf("Entries(): Expected 3 entries summing to 20, got %v %v", keys, values)
+	}
+	m.Clear()
+	if m.Len() != 0 {
+		t.Errorf("Clear(): Expected empty map, got %v", m.Keys())
+	}
+}
+
+func TestCOWMapExclusive(t *testing.T) {
+	data := make(map[int]int, 1000)
+	for i := range 1000 {
+		data[i] = i
+	}
+	m := internal.NewCOWMap(data)
+	// without subscribers Exclusive only pays the copy made by the copy-on-write, not a second one to diff the map.
+	clones := testing.AllocsPerRun(10, func() { _ = maps.Clone(data) })
+	n := 0
+	allocs := testing.AllocsPerRun(10, func() {
+		n++
+		m.Exclusive(func(data map[int]int) { data[0] = n })
+	})
+	if allocs > clones+2 {
+		t.Errorf("Exclusive(): Expected at most %v allocations, got %v", clones+2, allocs)
+	}
+	m.Exclusive(func(data map[int]int) { data[1000] = 1000 })
+	if v, ok := m.Load(1000); !ok || v != 1000 {
+		t.Errorf("Exclusive(): Expected the change to be published, got %v %v", v, ok)
+	}
+	if old := m.Replace(map[int]int{1: 1}); len(old) != 1001 || m.Len() != 1 {
+		t.Errorf("Replace(): Expected 1001 old entries and 1 entry, got %d and %d", len(old), m.Len())
+	}
+
+	// subscribers still receive the changes key by key.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := m.WatchAll(ctx, internal.WithWatchBuffer(4))
+	m.Exclusive(func(data map[int]int) { data[2] = 2 })
+	if e := <-ch; e.Op != internal.OpExclusive || e.Key != 2 || e.New != 2 || e.Loaded {
+		t.Errorf("WatchAll(): Expected an Exclusive event for key 2, got %+v", e)
+	}
+	if v, ok := m.Load(2); !ok || v != 2 {
+		t.Errorf("Exclusive(): Expected the change to be published, got %v %v", v, ok)
+	}
+}
+
+func TestCOWMapSnapshotIsolation(t *testing.T) {
+	m := internal.NewCOWMap(map[int]int{1: 1, 2: 2, 3: 3})
+	// the loop body may change the map, the iteration is not affected.
+	n := 0
+	for key := range m.All() {
+		m.Store(key+10, key)
+		m.Delete(key)
+		n++
+	}
+	if n != 3 {
+		t.Errorf("All(): Expected 3 iterations, got %d", n)
+	}
+	n = 0
+	m.Range(func(key, value int) bool {
+		m.Delete(key)
+		n++
+		return true
+	})
+	if n != 3 || m.Len() != 0 {
+		t.Errorf("Range(): Expected 3 iterations and an empty map, got %d and %d keys", n, m.Len())
+	}
+	for range m.KeysSeq() {
+		t.Errorf("KeysSeq(): Expected no keys")
+	}
+	for range m.ValuesSeq() {
+		t.Errorf("ValuesSeq(): Expected no values")
+	}
+}
+
+func TestCOWMapConcurrent(t *testing.T) {
+	m := internal.NewCOWMap[int, int](nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				m.Store(i*100+j, j)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				m.Load(j % 400)
+				m.Len()
+			}
+		}()
+	}
+	wg.Wait()
+	if m.Len() != 400 {
+		t.Errorf("Len(): Expected 400 keys, got %d", m.Len())
+	}
+}
+
+func TestCOWMapIntegration(t *testing.T) {
+	m := internal.NewCOWMap[string, int](nil)
+	v := internal.NewValue[int]()
+	internal.Atomically(func(l *internal.Locks) {
+		internal.LockedMapOf[string, int](l, m).Store("a", 1)
+		internal.LockedValueOf[int](l, v).Store(1)
+	}, m, v)
+	if !m.Has("a") {
+		t.Errorf("Atomically(): Expected key a to be published")
+	}
+	if err := json.Unmarshal([]byte(`{"b":2}`), m); err != nil {
+		t.Fatalf("Unmarshal(): Expected no error, got %v", err)
+	}
+	if m.Has("a") || !m.Has("b") {
+		t.Errorf("Unmarshal(): Expected content to be replaced and published, got %v", m.Keys())
+	}
+}
+
+// benchMap is the subset of the map methods used by the benchmarks, it is implemented by sync.Map too.
+type benchMap interface {
+	Load(key int) (int, bool)
+	Store(key int, value int)
+}
+
+type syncMap struct{ sync.Map }
+
+func (m *syncMap) Load(key int) (int, bool) {
+	v, ok := m.Map.Load(key)
+	if !ok {
+		return 0, false
+	}
+	return v.(int), true
+}
+
+func (m *syncMap) Store(key, value int) { m.Map.Store(key, value) }
+
+func benchMaps() []struct {
+	name string
+	m    benchMap
+} {
+	return []struct {
+		name string
+		m    benchMap
+	}{
+		{"Map", internal.NewMap[int, int](nil)},
+		{"COWMap", internal.NewCOWMap[int, int](nil)},
+		{"sync.Map", &syncMap{}},
+	}
+}
+
+const benchKeys = 1024
+
+func BenchmarkLoad(b *testing.B) {
+	for _, bm := range benchMaps() {
+		for i := 0; i < benchKeys; i++ {
+			bm.m.Store(i, i)
+		}
+		b.Run(bm.name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					bm.m.Load(i % benchKeys)
+					i++
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkLoadMostly(b *testing.B) {
+	for _, ratio := range []int{1000, 100} {
+		for _, bm := range benchMaps() {
+			for i := 0; i < benchKeys; i++ {
+				bm.m.Store(i, i)
+			}
+			b.Run(bm.name+"/1:"+strconv.Itoa(ratio), func(b *testing.B) {
+				b.RunParallel(func(pb *testing.PB) {
+					i := 0
+					for pb.Next() {
+						if i%ratio == 0 {
+							bm.m.Store(i%benchKeys, i)
+						} else {
+							bm.m.Load(i % benchKeys)
+						}
+						i++
+					}
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// String returns the JSON encoding of the map, see MarshalJSON. It implements expvar.Var.
+func (m *Map[K, V]) String() string {
+	return jsonString(m.MarshalJSON())
+}
+
+// String returns the JSON encoding of the map, see MarshalJSON. It implements expvar.Var.
+func (s *ShardedMap[K, V]) String() string {
+	return jsonString(s.MarshalJSON())
+}
+
+// String returns the JSON encoding of the map in insertion order, see MarshalJSON. It implements expvar.Var.
+func (m *OrderedMap[K, V]) String() string {
+	return jsonString(m.MarshalJSON())
+}
+
+// String returns the JSON encoding of the value, null if the value is not set. It implements expvar.Var.
+func (m *Value[V]) String() string {
+	return jsonString(m.MarshalJSON())
+}
+
+// String returns the value as a JSON number, 0 if the value is not set, so that a Numeric can replace
+// expvar.Int and expvar.Float. Complex values, which JSON cannot represent as numbers, are returned as JSON strings.
+// It implements expvar.Var.
+func (m *Numeric[V]) String() string {
+	v, _ := m.Load()
+	switch v := any(v).(type) {
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case complex64:
+		return strconv.Quote(strconv.FormatComplex(complex128(v), 'g', -1, 64))
+	case complex128:
+		return strconv.Quote(strconv.FormatComplex(v, 'g', -1, 128))
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// jsonString returns b as a string, or the error message encoded as a JSON string if err is not nil,
+// so that String always returns valid JSON.
+func jsonString(b []byte, err error) string {
+	if err != nil {
+		b, _ = json.Marshal(err.Error())
+	}
+	return string(b)
+}
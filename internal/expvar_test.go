@@ -0,0 +1,85 @@
+package internal_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+// implements expvar.Var
+var (
+	_ expvar.Var = (*internal.Map[string, int])(nil)
+	_ expvar.Var = (*internal.ShardedMap[string, int])(nil)
+	_ expvar.Var = (*internal.Value[int])(nil)
+	_ expvar.Var = (*internal.Numeric[int])(nil)
+)
+
+func TestMapString(t *testing.T) {
+	m := internal.NewMap(map[string]int{"a": 1, "b": 2})
+	if s := m.String(); s != `{"a":1,"b":2}` {
+		t.Errorf("String(): Expected a JSON object, got %s", s)
+	}
+	s := internal.NewShardedMap[int, int](4, intHash)
+	s.Store(1, 1)
+	if str := s.String(); str != `{"1":1}` {
+		t.Errorf("String(): Expected a JSON object, got %s", str)
+	}
+	// values JSON cannot encode are reported as a JSON string.
+	f := internal.NewMap(map[string]func(){"a": func() {}})
+	var msg string
+	if err := json.Unmarshal([]byte(f.String()), &msg); err != nil || msg == "" {
+		t.Errorf("String(): Expected the error as a JSON string, got %s", f.String())
+	}
+}
+
+func TestValueString(t *testing.T) {
+	v := internal.NewValue[string]()
+	if s := v.String(); s != "null" {
+		t.Errorf("String(): Expected null for an unset value, got %s", s)
+	}
+	v.Store("a")
+	if s := v.String(); s != `"a"` {
+		t.Errorf("String(): Expected a JSON string, got %s", s)
+	}
+}
+
+func TestNumericString(t *testing.T) {
+	i := internal.NewNumeric[int64]()
+	if s := i.String(); s != "0" {
+		t.Errorf("String(): Expected 0 for an unset value, got %s", s)
+	}
+	i.Add(42)
+	if s := i.String(); s != "42" {
+		t.Errorf("String(): Expected 42, got %s", s)
+	}
+	if s := internal.NewNumericWithValue(float32(0.1)).String(); s != "0.1" {
+		t.Errorf("String(): Expected 0.1, got %s", s)
+	}
+	if s := internal.NewNumericWithValue(1.5).String(); s != "1.5" {
+		t.Errorf("String(): Expected 1.5, got %s", s)
+	}
+	if s := internal.NewNumericWithValue(complex(1, 2)).String(); s != `"(1+2i)"` {
+		t.Errorf("String(): Expected a JSON string, got %s", s)
+	}
+	if s := internal.NewNumericWithValue(complex64(complex(1, -2))).String(); s != `"(1-2i)"` {
+		t.Errorf("String(): Expected a JSON string, got %s", s)
+	}
+}
+
+// published counts the variables published by the tests, expvar panics if a name is published twice
+// and the tests may run more than once in the same process.
+var published atomic.Int64
+
+func TestExpvar(t *testing.T) {
+	n := internal.NewNumeric[int64]()
+	name := fmt.Sprintf("%s.%d", t.Name(), published.Add(1))
+	expvar.Publish(name, n)
+	n.Add(3)
+	if s := expvar.Get(name).String(); s != "3" {
+		t.Errorf("expvar.Get(): Expected 3, got %s", s)
+	}
+}
@@ -0,0 +1,116 @@
+package internal
+
+// newMap returns a Map holding data, data is not copied and must not be used by the caller afterwards.
+func newMap[K comparable, V any](data map[K]V) *Map[K, V] {
+	return &Map[K, V]{data: data, eq: options[V](nil).Equal}
+}
+
+// Filter returns a new Map holding the entries of m for which pred returns true, with the options of m.
+// The entries of m are copied with Entries, a consistent snapshot, and pred is called once m is unlocked.
+func Filter[K comparable, V any](m entries[K, V], pred func(K, V) bool) *Map[K, V] {
+	keys, values := m.Entries()
+	data := make(map[K]V)
+	for i, key := range keys {
+		if pred(key, values[i]) {
+			data[key] = values[i]
+		}
+	}
+	return derive(m, data)
+}
+
+// Transform returns a new Map holding the keys of m with the values returned by f, with the default options
+// as the type of the values changes.
+// The entries of m are copied with Entries, a consistent snapshot, and f is called once m is unlocked.
+func Transform[K comparable, V, W any](m entries[K, V], f func(K, V) W) *Map[K, W] {
+	keys, values := m.Entries()
+	data := make(map[K]W, len(keys))
+	for i, key := range keys {
+		data[key] = f(key, values[i])
+	}
+	return newMap(data)
+}
+
+// Reduce calls f for every entry of m, in unspecified order, with the value returned by the previous call,
+// starting from init, and returns the value returned by the last call or init if m is empty.
+// The entries of m are copied with Entries, a consistent snapshot, and f is called once m is unlocked.
+func Reduce[K comparable, V, A any](m entries[K, V], init A, f func(acc A, key K, value V) A) A {
+	keys, values := m.Entries()
+	acc := init
+	for i, key := range keys {
+		acc = f(acc, key, values[i])
+	}
+	return acc
+}
+
+// Partition returns two new Maps with the options of m, matched holding the entries of m for which pred returns true
+// and rest the others.
+// The entries of m are copied with Entries, a consistent snapshot, and pred is called once m is unlocked.
+func Partition[K comparable, V any](m entries[K, V], pred func(K, V) bool) (matched, rest *Map[K, V]) {
+	keys, values := m.Entries()
+	in, out := make(map[K]V), make(map[K]V)
+	for i, key := range keys {
+		if pred(key, values[i]) {
+			in[key] = values[i]
+		} else {
+			out[key] = values[i]
+		}
+	}
+	return derive(m, in), derive(m, out)
+}
+
+// DeleteIf removes the entries for which pred returns true and returns the number of entries removed.
+// The map is locked while pred is called, removed keys are reported to the subscribers as Delete events.
+//
+// ! Do not invoke any Map functions within 'pred' to prevent a deadlock.
+func (m *Map[K, V]) DeleteIf(pred func(K, V) bool) (n int) {
+	m.lock()
+	defer m.unlock()
+	return m.deleteIf(pred, true)
+}
+
+// RetainIf removes the entries for which pred returns false and returns the number of entries removed.
+// The map is locked while pred is called, removed keys are reported to the subscribers as Delete events.
+//
+// ! Do not invoke any Map functions within 'pred' to prevent a deadlock.
+func (m *Map[K, V]) RetainIf(pred func(K, V) bool) (n int) {
+	m.lock()
+	defer m.unlock()
+	return m.deleteIf(pred, false)
+}
+
+// deleteIf removes the entries for which pred returns match, the caller must hold the write lock.
+func (m *Map[K, V]) deleteIf(pred func(K, V) bool, match bool) (n int) {
+	for key, value := range m.data {
+		if pred(key, value) == match {
+			m.del(OpDelete, key)
+			n++
+		}
+	}
+	return n
+}
+
+// DeleteIf removes the entries for which pred returns true and returns the number of entries removed.
+// All the shards are locked while pred is called.
+//
+// ! Do not invoke any Map functions within 'pred' to prevent a deadlock.
+func (s *ShardedMap[K, V]) DeleteIf(pred func(K, V) bool) (n int) {
+	s.lock()
+	defer s.unlock()
+	for _, shard := range s.shards {
+		n += shard.deleteIf(pred, true)
+	}
+	return n
+}
+
+// RetainIf removes the entries for which pred returns false and returns the number of entries removed.
+// All the shards are locked while pred is called.
+//
+// ! Do not invoke any Map functions within 'pred' to prevent a deadlock.
+func (s *ShardedMap[K, V]) RetainIf(pred func(K, V) bool) (n int) {
+	s.lock()
+	defer s.unlock()
+	for _, shard := range s.shards {
+		n += shard.deleteIf(pred, false)
+	}
+	return n
+}
@@ -0,0 +1,117 @@
+package internal_test
+
+import (
+	"maps"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+func even(_ string, v int) bool { return v%2 == 0 }
+
+func TestFilter(t *testing.T) {
+	m := internal.NewMap(map[string]int{"a": 1, "b": 2, "c": 3, "d": 4})
+	f := internal.Filter(m, even)
+	if !maps.Equal(maps.Collect(f.All()), map[string]int{"b": 2, "d": 4}) {
+		t.Errorf("Filter(): Expected the even values, got %v", f.Keys())
+	}
+	// the new map is independent.
+	f.Store("e", 6)
+	if m.Has("e") {
+		t.Errorf("Filter(): Expected an independent map")
+	}
+	// pred is called without holding the lock.
+	internal.Filter(m, func(k string, v int) bool { return m.Has(k) })
+
+	s := internal.NewShardedMap[int, int](4, intHash)
+	s.StoreMany(map[int]int{1: 1, 2: 2, 3: 3})
+	if f := internal.Filter(s, func(k, v int) bool { return k > 1 }); f.Len() != 2 {
+		t.Errorf("Filter(): Expected 2 entries, got %v", f.Keys())
+	}
+}
+
+func TestFilterOptions(t *testing.T) {
+	fold := internal.WithEqual(strings.EqualFold)
+	m := internal.NewMap(map[string]string{"a": "x", "b": "y"}, fold)
+	s := internal.NewShardedMap[string, string](4, func(k string) uint64 { return uint64(len(k)) }, fold)
+	s.StoreMany(map[string]string{"a": "x", "b": "y"})
+	for name, src := range map[string]interface {
+		Entries() ([]string, []string)
+	}{"Map": m, "ShardedMap": s} {
+		keep := func(string, string) bool { return true }
+		matched, _ := internal.Partition(src, keep)
+		_, rest := internal.Partition(src, func(string, string) bool { return false })
+		for fn, dst := range map[string]*internal.Map[string, string]{
+			"Filter":    internal.Filter(src, keep),
+			"Partition": matched,
+			"rest":      rest,
+		} {
+			if !dst.CompareAndSwap("a", "X", "z") {
+				t.Errorf("%s(%s): Expected CompareAndSwap to use the Equal option of the source map", fn, name)
+			}
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	m := internal.NewCOWMap(map[string]int{"a": 1, "b": 2})
+	w := internal.Transform(m, func(k string, v int) string { return k + strconv.Itoa(v) })
+	if !maps.Equal(maps.Collect(w.All()), map[string]string{"a": "a1", "b": "b2"}) {
+		t.Errorf("Transform(): Expected the transformed values, got %v", w.Values())
+	}
+	if !w.CompareAndSwap("a", "a1", "x") {
+		t.Errorf("CompareAndSwap(): Expected the new map to compare values")
+	}
+}
+
+func TestReduce(t *testing.T) {
+	m := internal.NewMap(map[string]int{"a": 1, "b": 2, "c": 3})
+	if sum := internal.Reduce(m, 10, func(acc int, _ string, v int) int { return acc + v }); sum != 16 {
+		t.Errorf("Reduce(): Expected 16, got %d", sum)
+	}
+	empty := internal.NewMap[string, int](nil)
+	if v := internal.Reduce(empty, "init", func(acc string, _ string, _ int) string { return "called" }); v != "init" {
+		t.Errorf("Reduce(): Expected init for an empty map, got %s", v)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	m := internal.NewMap(map[string]int{"a": 1, "b": 2, "c": 3})
+	matched, rest := internal.Partition(m, even)
+	if !maps.Equal(maps.Collect(matched.All()), map[string]int{"b": 2}) || !maps.Equal(maps.Collect(rest.All()), map[string]int{"a": 1, "c": 3}) {
+		t.Errorf("Partition(): Expected the even and odd values, got %v and %v", matched.Keys(), rest.Keys())
+	}
+	if m.Len() != 3 {
+		t.Errorf("Partition(): Expected m to be unchanged")
+	}
+}
+
+func TestDeleteIf(t *testing.T) {
+	m := internal.NewMap(map[string]int{"a": 1, "b": 2, "c": 3, "d": 4})
+	if n := m.DeleteIf(even); n != 2 || m.Len() != 2 || m.Has("b") {
+		t.Errorf("DeleteIf(): Expected the even values to be removed, got %d and %v", n, m.Keys())
+	}
+	if n := m.RetainIf(func(k string, _ int) bool { return k == "a" }); n != 1 || !m.Has("a") || m.Len() != 1 {
+		t.Errorf("RetainIf(): Expected only a to be kept, got %d and %v", n, m.Keys())
+	}
+	if n := m.DeleteIf(even); n != 0 {
+		t.Errorf("DeleteIf(): Expected nothing to be removed, got %d", n)
+	}
+
+	s := internal.NewShardedMap[int, int](4, intHash)
+	s.StoreMany(map[int]int{1: 1, 2: 2, 3: 3, 4: 4, 5: 5})
+	if n := s.DeleteIf(func(k, v int) bool { return v%2 == 0 }); n != 2 || s.Len() != 3 {
+		t.Errorf("DeleteIf(): Expected 2 entries removed, got %d", n)
+	}
+	if n := s.RetainIf(func(k, v int) bool { return v > 4 }); n != 2 || s.Len() != 1 {
+		t.Errorf("RetainIf(): Expected 2 entries removed, got %d", n)
+	}
+
+	c := internal.NewCOWMap(map[string]int{"a": 1, "b": 2})
+	c.DeleteIf(even)
+	if keys := c.Keys(); len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("DeleteIf(): Expected the change to be published, got %v", keys)
+	}
+}
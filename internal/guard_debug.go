@@ -0,0 +1,109 @@
+//go:build mutexdebug
+
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// pkgPrefix is the prefix of the functions of this package in a call stack, wrapperPrefix the prefix of the
+// functions of the mutex package wrapping the structures of this package.
+const (
+	pkgPrefix     = "github.com/thetechpanda/mutex/internal."
+	wrapperPrefix = "github.com/thetechpanda/mutex."
+)
+
+// wrapped names the structure of this package embedded by each wrapper of the mutex package.
+var wrapped = strings.NewReplacer(
+	"plainMap.", "Map.",
+	"shardedMap.", "ShardedMap.",
+	"cowMap.", "COWMap.",
+	"boundedMap.", "BoundedMap.",
+	"orderedMap.", "OrderedMap.",
+	"persistentMap.", "PersistentMap.",
+)
+
+// methodName returns the name of the method or function of a frame, without its package and type parameters.
+func methodName(name string) string {
+	name, _, _ = strings.Cut(name, ".func")
+	return strings.NewReplacer("(*", "", ")", "", "[...]", "").Replace(name)
+}
+
+// guard records the goroutine holding the write lock of a structure, so that a call made by the same goroutine
+// to a method locking the structure again, typically from the function passed to Update, UpdateRange or Exclusive,
+// panics instead of deadlocking.
+//
+// guard is enabled by the mutexdebug build tag, every lock then reads the current goroutine identifier
+// from runtime.Stack and records the call stack of the caller, which makes locking an order of magnitude slower.
+type guard struct {
+	owner atomic.Int64 // identifier of the goroutine holding the write lock, 0 if none.
+	pcs   [32]uintptr  // call stack of the owner when the lock was acquired, only accessed with the write lock held.
+	n     int
+}
+
+// check panics if the current goroutine holds the write lock, it is called before waiting for a lock.
+func (g *guard) check() {
+	if owner := g.owner.Load(); owner == 0 || owner != goid() {
+		return
+	}
+	var pcs [32]uintptr
+	n := runtime.Callers(2, pcs[:])
+	called, calledAt := caller(pcs[:n])
+	held, heldAt := caller(g.pcs[:g.n])
+	panic(fmt.Sprintf("mutex: %s called at %s while %s called at %s holds the lock on the same goroutine, the call would deadlock",
+		called, calledAt, held, heldAt))
+}
+
+// acquire records the current goroutine as the owner of the write lock, the caller must hold the write lock.
+func (g *guard) acquire() {
+	g.n = runtime.Callers(2, g.pcs[:])
+	g.owner.Store(goid())
+}
+
+// release forgets the owner of the write lock, it is called before the write lock is released.
+func (g *guard) release() {
+	g.owner.Store(0)
+}
+
+// goid returns the identifier of the current goroutine, parsed from the first line of its stack trace.
+func goid() int64 {
+	var buf [64]byte
+	b := bytes.TrimPrefix(buf[:runtime.Stack(buf[:], false)], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
+
+// caller returns the outermost method of this package in pcs and the position of its caller.
+// The frames of the mutex package are skipped, so that the position is the one of the call made by the user
+// when the method is called through a wrapper.
+func caller(pcs []uintptr) (method, at string) {
+	method, at = "unknown method", "unknown position"
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if name, ok := strings.CutPrefix(frame.Function, pkgPrefix); ok {
+			method = methodName(name)
+		} else if name, ok := strings.CutPrefix(frame.Function, wrapperPrefix); ok {
+			// the wrappers methods are named after the structure they wrap, other functions are helpers.
+			if name = methodName(name); strings.Contains(name, ".") {
+				method = wrapped.Replace(name)
+			}
+		} else {
+			if frame.Function != "" {
+				at = frame.File + ":" + strconv.Itoa(frame.Line)
+			}
+			return method, at
+		}
+		if !more {
+			return method, at
+		}
+	}
+}
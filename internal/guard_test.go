@@ -0,0 +1,108 @@
+//go:build mutexdebug
+
+package internal_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+// expectReentrant runs f and fails the test unless f panics reporting a call to called while held holds the lock.
+func expectReentrant(t *testing.T, called, held string, f func()) {
+	t.Helper()
+	defer func() {
+		t.Helper()
+		r := recover()
+		msg, _ := r.(string)
+		if !strings.Contains(msg, "mutex: "+called+" called at ") || !strings.Contains(msg, " while "+held+" called at ") {
+			t.Fatalf("Expected a re-entrant call to %s within %s, got %v", called, held, r)
+		}
+		if strings.Count(msg, "guard_test.go:") != 2 {
+			t.Errorf("Expected both call sites to be reported, got %s", msg)
+		}
+	}()
+	f()
+}
+
+func TestGuard(t *testing.T) {
+	m := internal.NewMap(map[string]int{"a": 1})
+	expectReentrant(t, "Map.Load", "Map.Update", func() {
+		m.Update("a", func(v int, ok bool) int { m.Load("a"); return v })
+	})
+	expectReentrant(t, "Map.Store", "Map.Exclusive", func() {
+		m.Exclusive(func(map[string]int) { m.Store("b", 2) })
+	})
+	expectReentrant(t, "Map.Len", "Map.UpdateRange", func() {
+		m.UpdateRange(func(k string, v int) (int, bool) { m.Len(); return v, true })
+	})
+	expectReentrant(t, "Map.Store", "Map.TryUpdate", func() {
+		m.TryUpdate("a", func(v int, ok bool) int { m.Store("b", 2); return v })
+	})
+
+	// the lock is released by the panic and the map is still usable.
+	m.Store("b", 2)
+	if v, ok := m.Load("b"); !ok || v != 2 {
+		t.Errorf("Load(): Expected value 2, got %d", v)
+	}
+	// calls that do not wait for the lock are allowed.
+	m.Exclusive(func(map[string]int) {
+		if m.TryStore("c", 3) {
+			t.Errorf("TryStore(): Expected not to run while the map is locked")
+		}
+	})
+}
+
+func TestGuardVariants(t *testing.T) {
+	s := internal.NewShardedMap[int, int](4, intHash)
+	expectReentrant(t, "ShardedMap.Store", "ShardedMap.Update", func() {
+		s.Update(1, func(v int, ok bool) int { s.Store(1, 1); return v })
+	})
+	expectReentrant(t, "ShardedMap.Len", "ShardedMap.Exclusive", func() {
+		s.Exclusive(func(map[int]int) { s.Len() })
+	})
+	// other shards are not locked by Update.
+	s.Update(1, func(v int, ok bool) int { s.Store(2, 2); return v })
+
+	c := internal.NewCOWMap[string, int](nil)
+	expectReentrant(t, "Map.Store", "Map.Exclusive", func() {
+		c.Exclusive(func(map[string]int) { c.Store("a", 1) })
+	})
+	// lock-free reads are allowed.
+	c.Exclusive(func(map[string]int) { c.Load("a") })
+
+	v := internal.NewValue[int]()
+	expectReentrant(t, "Value.Load", "Value.Exclusive", func() {
+		v.Exclusive(func(actual int, loaded bool) int { v.Load(); return actual })
+	})
+	n := internal.NewNumeric[int]()
+	expectReentrant(t, "Numeric.Add", "Value.Exclusive", func() {
+		n.Exclusive(func(actual int, loaded bool) int { n.Add(1); return actual })
+	})
+
+	expectReentrant(t, "Value.Store", "Atomically", func() {
+		internal.Atomically(func(*internal.Locks) { v.Store(1) }, v)
+	})
+}
+
+func TestGuardConcurrent(t *testing.T) {
+	// calls from other goroutines wait for the lock as usual.
+	m := internal.NewMap[int, int](nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				m.Update(j, func(v int, ok bool) int { return v + 1 })
+				m.Load(j)
+			}
+		}()
+	}
+	wg.Wait()
+	if m.Len() != 100 {
+		t.Errorf("Len(): Expected 100 keys, got %d", m.Len())
+	}
+}
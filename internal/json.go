@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// MarshalJSON encodes the map as a JSON object, keys are encoded following the encoding/json rules
+// for map keys: strings, integers and encoding.TextMarshaler implementations are supported.
+// The map is read locked while it is encoded.
+func (m *Map[K, V]) MarshalJSON() ([]byte, error) {
+	defer m.runlock(m.rlock())
+	return json.Marshal(m.data)
+}
+
+// UnmarshalJSON replaces the content of the map with the JSON object in data.
+// The map is left unchanged if data is not a valid JSON object for the map types, JSON null empties the map.
+// Replaced keys are reported to the subscribers as Store events, removed keys as Delete events.
+func (m *Map[K, V]) UnmarshalJSON(data []byte) error {
+	var v map[K]V
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	m.lock()
+	defer m.unlock()
+	m.replace(v)
+	return nil
+}
+
+// MarshalJSON encodes the map as a JSON object, keys are encoded following the encoding/json rules
+// for map keys: strings, integers and encoding.TextMarshaler implementations are supported.
+// All the shards are read locked while the map is encoded.
+func (s *ShardedMap[K, V]) MarshalJSON() ([]byte, error) {
+	defer s.runlock(s.rlock())
+	return json.Marshal(s.merged())
+}
+
+// UnmarshalJSON replaces the content of the map with the JSON object in data, all the shards are replaced atomically.
+// The map is left unchanged if data is not a valid JSON object for the map types, JSON null empties the map.
+func (s *ShardedMap[K, V]) UnmarshalJSON(data []byte) error {
+	var v map[K]V
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	s.lock()
+	defer s.unlock()
+	s.replace(v)
+	return nil
+}
+
+// MarshalJSON encodes the map as a JSON object whose members follow the insertion order of the keys,
+// keys are encoded as in Map.MarshalJSON. The map is read locked while it is encoded.
+func (m *OrderedMap[K, V]) MarshalJSON() ([]byte, error) {
+	defer m.Map.runlock(m.Map.rlock())
+	buf := []byte{'{'}
+	for el := m.order.Front(); el != nil; el = el.Next() {
+		key := el.Value.(K)
+		// a single entry map encodes the key following the encoding/json rules for map keys.
+		member, err := json.Marshal(map[K]V{key: m.Map.data[key]})
+		if err != nil {
+			return nil, err
+		}
+		if len(buf) > 1 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, member[1:len(member)-1]...)
+	}
+	return append(buf, '}'), nil
+}
+
+// UnmarshalJSON replaces the content of the map with the JSON object in data, the keys follow the order of the
+// members of the object. The map is left unchanged if data is not a valid JSON object for the map types,
+// JSON null empties the map. Replaced keys are reported to the subscribers as Store events, removed keys as Delete events.
+func (m *OrderedMap[K, V]) UnmarshalJSON(data []byte) error {
+	var v map[K]V
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	keys, err := jsonKeys[K, V](data)
+	if err != nil {
+		return err
+	}
+	values := make([]V, len(keys))
+	for i, key := range keys {
+		values[i] = v[key]
+	}
+	m.Map.lock()
+	defer m.Map.unlock()
+	m.replaceOrdered(keys, values)
+	return nil
+}
+
+// jsonKeys returns the keys of the JSON object in data in the order of its members, data must be valid.
+func jsonKeys[K comparable, V any](data []byte) ([]K, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok == nil {
+		return nil, err
+	}
+	var keys []K
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		// the key is decoded as in Map.UnmarshalJSON, from a single member object.
+		name, _ := json.Marshal(tok)
+		var member map[K]V
+		if err := json.Unmarshal(append(append([]byte{'{'}, name...), ":null}"...), &member); err != nil {
+			return nil, err
+		}
+		for key := range member {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// MarshalJSON encodes the value as JSON, an unset value is encoded as null.
+func (m *Value[V]) MarshalJSON() ([]byte, error) {
+	defer m.runlock(m.rlock())
+	if !m.set {
+		return []byte("null"), nil
+	}
+	return json.Marshal(m.data)
+}
+
+// UnmarshalJSON sets the value decoded from data, JSON null clears the value.
+// The value is left unchanged if data is not valid JSON for the value type.
+func (m *Value[V]) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		m.Clear()
+		return nil
+	}
+	var v V
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	m.Store(v)
+	return nil
+}
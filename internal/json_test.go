@@ -0,0 +1,118 @@
+package internal_test
+
+import (
+	"encoding/json"
+	"net/netip"
+	"testing"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+func TestMapJSON(t *testing.T) {
+	m := internal.NewMap(map[string]int{"a": 1, "b": 2})
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("Marshal(): Expected no error, got %v", err)
+	}
+	if string(data) != `{"a":1,"b":2}` {
+		t.Errorf("Marshal(): Expected {\"a\":1,\"b\":2}, got %s", data)
+	}
+	n := internal.NewMap(map[string]int{"c": 3})
+	if err := json.Unmarshal(data, n); err != nil {
+		t.Fatalf("Unmarshal(): Expected no error, got %v", err)
+	}
+	if n.Len() != 2 || n.Has("c") {
+		t.Errorf("Unmarshal(): Expected content to be replaced, got %v", n.Keys())
+	}
+	if v, _ := n.Load("b"); v != 2 {
+		t.Errorf("Unmarshal(): Expected value 2, got %d", v)
+	}
+	if err := json.Unmarshal([]byte(`{"a":"x"}`), n); err == nil {
+		t.Errorf("Unmarshal(): Expected error for invalid value")
+	}
+	if n.Len() != 2 {
+		t.Errorf("Unmarshal(): Expected map to be unchanged on error")
+	}
+	if err := json.Unmarshal([]byte(`null`), n); err != nil || n.Len() != 0 {
+		t.Errorf("Unmarshal(): Expected null to empty the map, got %v", err)
+	}
+}
+
+func TestMapJSONKeys(t *testing.T) {
+	ints := internal.NewMap(map[int]bool{-1: true, 2: false})
+	data, _ := json.Marshal(ints)
+	if string(data) != `{"-1":true,"2":false}` {
+		t.Errorf("Marshal(): Expected integer keys to be quoted, got %s", data)
+	}
+	addrs := internal.NewMap[netip.Addr, int](nil)
+	if err := json.Unmarshal([]byte(`{"10.0.0.1":1}`), addrs); err != nil {
+		t.Fatalf("Unmarshal(): Expected no error, got %v", err)
+	}
+	if v, ok := addrs.Load(netip.MustParseAddr("10.0.0.1")); !ok || v != 1 {
+		t.Errorf("Unmarshal(): Expected TextUnmarshaler key to be decoded")
+	}
+	data, _ = json.Marshal(addrs)
+	if string(data) != `{"10.0.0.1":1}` {
+		t.Errorf("Marshal(): Expected TextMarshaler key, got %s", data)
+	}
+}
+
+func TestShardedMapJSON(t *testing.T) {
+	m := internal.NewShardedMap[int, string](4, intHash)
+	m.Store(1, "a")
+	m.Store(6, "b")
+	data, _ := json.Marshal(m)
+	if string(data) != `{"1":"a","6":"b"}` {
+		t.Errorf("Marshal(): Expected {\"1\":\"a\",\"6\":\"b\"}, got %s", data)
+	}
+	if err := json.Unmarshal([]byte(`{"2":"c","6":"d"}`), m); err != nil {
+		t.Fatalf("Unmarshal(): Expected no error, got %v", err)
+	}
+	if v, _ := m.Load(6); m.Len() != 2 || m.Has(1) || v != "d" {
+		t.Errorf("Unmarshal(): Expected content to be replaced, got %v", m.Keys())
+	}
+}
+
+func TestBoundedMapJSON(t *testing.T) {
+	m := internal.NewLRUMap[string, int](2)
+	if err := json.Unmarshal([]byte(`{"a":1,"b":2,"c":3}`), m); err != nil {
+		t.Fatalf("Unmarshal(): Expected no error, got %v", err)
+	}
+	if m.Len() != 2 {
+		t.Errorf("Unmarshal(): Expected capacity to be enforced, got %d keys", m.Len())
+	}
+}
+
+func TestValueJSON(t *testing.T) {
+	v := internal.NewValue[string]()
+	data, _ := json.Marshal(v)
+	if string(data) != `null` {
+		t.Errorf("Marshal(): Expected unset value to encode as null, got %s", data)
+	}
+	v.Store("42")
+	data, _ = json.Marshal(v)
+	if string(data) != `"42"` {
+		t.Errorf("Marshal(): Expected \"42\", got %s", data)
+	}
+	u := internal.NewWithValue("x")
+	if err := json.Unmarshal([]byte(`null`), u); err != nil || !u.IsZero() {
+		t.Errorf("Unmarshal(): Expected null to unset the value")
+	}
+	if err := json.Unmarshal(data, u); err != nil {
+		t.Fatalf("Unmarshal(): Expected no error, got %v", err)
+	}
+	if s, ok := u.Load(); !ok || s != "42" {
+		t.Errorf("Unmarshal(): Expected value 42, got %q", s)
+	}
+	n := internal.NewNumeric[float64]()
+	if err := json.Unmarshal([]byte(`1.5`), n); err != nil {
+		t.Fatalf("Unmarshal(): Expected no error, got %v", err)
+	}
+	if n.Add(1) != 2.5 {
+		t.Errorf("Unmarshal(): Expected numeric value to be 1.5")
+	}
+	data, _ = json.Marshal(n)
+	if string(data) != `2.5` {
+		t.Errorf("Marshal(): Expected 2.5, got %s", data)
+	}
+}
@@ -1,66 +1,266 @@
 package internal
 
 import (
-	"reflect"
+	"context"
+	"iter"
+	"maps"
 	"sync"
+	"sync/atomic"
 )
 
 // Map implements a simple thread-safe map that uses generics.
 type Map[K comparable, V any] struct {
-	_    noCopy // go vet to alert when copying by value.
-	mu   sync.RWMutex
-	data map[K]V
+	_       noCopy // go vet to alert when copying by value.
+	mu      sync.RWMutex
+	data    map[K]V
+	obs     observer[K, V]    // optional, used by the map variants built on top of Map.
+	watch   *watchHub[K, V]   // created by the first call to Watch or WatchAll.
+	guard   guard             // detects re-entrant calls with the mutexdebug build tag.
+	waiters waitQueue         // callers of the Context methods waiting for the lock.
+	stats   *lockStats        // nil unless created with WithStats.
+	id      atomic.Uint64     // assigned by the first call to Atomically.
+	eq      func(a, b V) bool // compares values, see Options.
+	copy    func(V) V         // copies values for Snapshot, nil to assign them.
+}
+
+// observer is notified by Map of the accesses and changes to its keys.
+// It allows map variants to embed Map and track its keys, for instance to implement an eviction policy.
+type observer[K comparable, V any] interface {
+	// accessed is called when the value of key is read by Load or LoadOrStore, the map may only be read locked.
+	accessed(key K)
+	// changed is called after a key is set or removed. The map is write locked.
+	changed(e Event[K, V])
+	// unlocking is called before the write lock is released, the returned function, if any, is called once the lock is released.
+	unlocking() func()
+}
+
+// lockObserver is implemented by the observers that must be notified once the write lock is acquired,
+// before the map is changed.
+type lockObserver interface {
+	locked()
+}
+
+// bulkObserver is implemented by the observers that only need to know that the map changed, not which keys.
+// When the map has no subscriber, Exclusive and Replace call changedAll instead of diffing the map against a copy.
+type bulkObserver interface {
+	changedAll()
+}
+
+// lock locks the map for writing.
+func (m *Map[K, V]) lock() {
+	m.guard.check()
+	if m.stats == nil {
+		m.mu.Lock()
+	} else {
+		m.stats.lock(&m.mu)
+	}
+	m.acquired()
+}
+
+// lockContext locks the map for writing, giving up once ctx is done. See waitQueue.lockContext.
+func (m *Map[K, V]) lockContext(ctx context.Context) error {
+	m.guard.check()
+	if m.stats == nil {
+		if err := m.waiters.lockContext(ctx, m.mu.TryLock, m.mu.Lock, m.mu.Unlock); err != nil {
+			return err
+		}
+	} else if err := m.stats.lockContext(ctx, &m.mu, &m.waiters); err != nil {
+		return err
+	}
+	m.acquired()
+	return nil
+}
+
+// acquired records the lock owner for the re-entrancy guard and notifies the observer, if it needs to,
+// that the write lock was acquired.
+func (m *Map[K, V]) acquired() {
+	m.guard.acquire()
+	if l, ok := m.obs.(lockObserver); ok {
+		l.locked()
+	}
+}
+
+// unlock unlocks the map locked by lock.
+func (m *Map[K, V]) unlock() {
+	m.guard.release()
+	var done func()
+	if m.obs != nil {
+		done = m.obs.unlocking()
+	}
+	if m.stats != nil {
+		m.stats.unlock()
+	}
+	m.mu.Unlock()
+	if done != nil {
+		done()
+	}
+}
+
+// rlock locks the map for reading, the returned time must be passed to runlock.
+func (m *Map[K, V]) rlock() (held int64) {
+	m.guard.check()
+	if m.stats == nil {
+		m.mu.RLock()
+		return 0
+	}
+	return m.stats.rlock(&m.mu)
+}
+
+// runlock unlocks the map locked by rlock at held.
+func (m *Map[K, V]) runlock(held int64) {
+	if m.stats != nil {
+		m.stats.runlock(held)
+	}
+	m.mu.RUnlock()
+}
+
+// observed returns true if changes to the map must be reported with emit, the caller must hold the lock.
+func (m *Map[K, V]) observed() bool {
+	return m.obs != nil || (m.watch != nil && m.watch.active())
+}
+
+// bulk notifies the observer that the map changed and returns true if nobody needs the changes key by key,
+// the caller must hold the write lock and call bulk before changing the map.
+func (m *Map[K, V]) bulk() bool {
+	b, ok := m.obs.(bulkObserver)
+	if !ok || (m.watch != nil && m.watch.active()) {
+		return false
+	}
+	b.changedAll()
+	return true
+}
+
+// emit reports e to the subscribers and to the observer, the caller must hold the write lock.
+func (m *Map[K, V]) emit(e Event[K, V]) {
+	if m.watch != nil && m.watch.active() {
+		m.watch.notify(e)
+	}
+	if m.obs != nil {
+		m.obs.changed(e)
+	}
+}
+
+// get returns the value for key and notifies the observer of the access, the caller must hold the lock.
+func (m *Map[K, V]) get(key K) (value V, ok bool) {
+	value, ok = m.data[key]
+	if ok && m.obs != nil {
+		m.obs.accessed(key)
+	}
+	return value, ok
+}
+
+// set sets the value for key and emits the change, the caller must hold the write lock.
+func (m *Map[K, V]) set(op Op, key K, value V) (previous V, loaded bool) {
+	previous, loaded = m.data[key]
+	m.data[key] = value
+	if m.observed() {
+		m.emit(Event[K, V]{Op: op, Key: key, Old: previous, Loaded: loaded, New: value})
+	}
+	return previous, loaded
+}
+
+// del removes key and emits the change, the caller must hold the write lock.
+func (m *Map[K, V]) del(op Op, key K) (previous V, loaded bool) {
+	previous, loaded = m.data[key]
+	if loaded {
+		delete(m.data, key)
+		if m.observed() {
+			m.emit(Event[K, V]{Op: op, Key: key, Old: previous, Loaded: true, Deleted: true})
+		}
+	}
+	return previous, loaded
+}
+
+// replace replaces the content of the map with data and emits the changes, the caller must hold the write lock.
+func (m *Map[K, V]) replace(data map[K]V) {
+	if m.data == nil {
+		m.data = make(map[K]V, len(data))
+	}
+	for key := range m.data {
+		if _, ok := data[key]; !ok {
+			m.del(OpDelete, key)
+		}
+	}
+	for key, value := range data {
+		m.set(OpStore, key, value)
+	}
 }
 
 // New returns a new Map, initialized with the given map. if m is nil, an empty map is created.
 // m key, values are copied, so that the caller can safely modify the map after creating a Map.
-func NewMap[K comparable, V any](m map[K]V) *Map[K, V] {
+func NewMap[K comparable, V any](m map[K]V, opts ...Option[V]) *Map[K, V] {
 	var v map[K]V = make(map[K]V, len(m))
 	for key, value := range m {
 		v[key] = value
 	}
-	return &Map[K, V]{data: v}
+	o := options(opts)
+	return &Map[K, V]{data: v, eq: o.Equal, copy: o.Copy, stats: newLockStats(o.Stats)}
+}
+
+// NewMapFromSeq returns a new Map, initialized with the key-value pairs yielded by seq.
+// If a key is yielded more than once the last value is kept.
+func NewMapFromSeq[K comparable, V any](seq iter.Seq2[K, V], opts ...Option[V]) *Map[K, V] {
+	v := make(map[K]V)
+	for key, value := range seq {
+		v[key] = value
+	}
+	o := options(opts)
+	return &Map[K, V]{data: v, eq: o.Equal, copy: o.Copy, stats: newLockStats(o.Stats)}
+}
+
+// NewComparableMap returns a new Map, initialized with the given map, whose values are compared with ==.
+func NewComparableMap[K comparable, V comparable](m map[K]V) *Map[K, V] {
+	return NewMap(m, WithEqual(comparableEqual[V]))
+}
+
+// equal reports whether a and b are equal, using the function set by the constructor.
+func (m *Map[K, V]) equal(a, b V) bool {
+	if m.eq == nil {
+		return deepEqual(a, b)
+	}
+	return m.eq(a, b)
 }
 
 // Store sets the value for a key.
 func (m *Map[K, V]) Store(key K, value V) {
-	m.Swap(key, value)
+	m.lock()
+	defer m.unlock()
+	m.set(OpStore, key, value)
 }
 
 // Load returns the value stored in the map for a key, or nil if no
 // value is present.
 // The ok result indicates whether value was found in the map.
 func (m *Map[K, V]) Load(key K) (v V, ok bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	v, ok = m.data[key]
-	return v, ok
+	defer m.runlock(m.rlock())
+	return m.get(key)
 }
 
 // LoadOrStore returns the existing value for the key if present.
 // Otherwise, it stores and returns the given value.
 // The loaded result is true if the value was loaded, false if stored.
 func (m *Map[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	actual, loaded = m.data[key]
+	m.lock()
+	defer m.unlock()
+	return m.loadOrStore(key, value)
+}
+
+// loadOrStore implements LoadOrStore, the caller must hold the write lock.
+func (m *Map[K, V]) loadOrStore(key K, value V) (actual V, loaded bool) {
+	actual, loaded = m.get(key)
 	if loaded {
 		return actual, true
 	}
-	m.data[key] = value
+	m.set(OpStore, key, value)
 	return value, false
 }
 
 // LoadAndDelete deletes the value for a key, returning the previous value if any.
 // The loaded result reports whether the key was present.
 func (m *Map[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	value, loaded = m.data[key]
-	if loaded {
-		delete(m.data, key)
-	}
-	return value, loaded
+	m.lock()
+	defer m.unlock()
+	return m.del(OpDelete, key)
 }
 
 // Delete removes the key from the map.
@@ -72,11 +272,9 @@ func (m *Map[K, V]) Delete(key K) {
 // Swap swaps the value for a key and returns the previous value if any.
 // The loaded result reports whether the key was present.
 func (m *Map[K, V]) Swap(key K, value V) (previous V, loaded bool) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	previous, loaded = m.data[key]
-	m.data[key] = value
-	return previous, loaded
+	m.lock()
+	defer m.unlock()
+	return m.set(OpSwap, key, value)
 }
 
 // CompareAndSwap swaps the old and new values for key
@@ -84,15 +282,15 @@ func (m *Map[K, V]) Swap(key K, value V) (previous V, loaded bool) {
 //
 // Returns true if the swap was performed.
 //
-// ! this function uses reflect.DeepEqual to compare the values.
+// Values are compared with the Equal option, see Options.
 func (m *Map[K, V]) CompareAndSwap(key K, old, new V) bool {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.lock()
+	defer m.unlock()
 	v, ok := m.data[key]
-	if !ok || !reflect.DeepEqual(v, old) {
+	if !ok || !m.equal(v, old) {
 		return false
 	}
-	m.data[key] = new
+	m.set(OpCompareAndSwap, key, new)
 	return true
 }
 
@@ -101,26 +299,27 @@ func (m *Map[K, V]) CompareAndSwap(key K, old, new V) bool {
 // If there is no current value for key in the map, CompareAndDelete
 // returns false (even if the old value is the nil interface value).
 //
-// ! this function uses reflect.DeepEqual to compare the values.
+// Values are compared with the Equal option, see Options.
 func (m *Map[K, V]) CompareAndDelete(key K, old V) (deleted bool) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.lock()
+	defer m.unlock()
 	v, ok := m.data[key]
-	if !ok || !reflect.DeepEqual(v, old) {
+	if !ok || !m.equal(v, old) {
 		return false
 	}
-	delete(m.data, key)
+	m.del(OpDelete, key)
 	return true
 }
 
 // Range calls f sequentially for each key and value present in the map.
 // If f returns false, Range stops the iteration.
-// Avoid invoking any map functions within 'f' to prevent a deadlock.
+//
+// Range iterates over a snapshot of the map taken under the read lock, the lock is released before f is called
+// so f may call any method on m, changes made during the iteration are not visible to Range.
 func (m *Map[K, V]) Range(f func(K, V) bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	for key, value := range m.data {
-		if !f(key, value) {
+	keys, values := m.Entries()
+	for i := range keys {
+		if !f(keys[i], values[i]) {
 			break
 		}
 	}
@@ -129,14 +328,26 @@ func (m *Map[K, V]) Range(f func(K, V) bool) {
 // Clear removes all items from the map.
 // This is a locking operation.
 func (m *Map[K, V]) Clear() {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.lock()
+	defer m.unlock()
+	m.clear()
+}
+
+// clear removes all items from the map and emits a change for each of them, the caller must hold the write lock.
+func (m *Map[K, V]) clear() {
+	data := m.data
 	m.data = make(map[K]V)
+	if m.observed() {
+		for key, value := range data {
+			m.emit(Event[K, V]{Op: OpClear, Key: key, Old: value, Loaded: true, Deleted: true})
+		}
+	}
 }
 
 // Has returns true if the map contains the key.
 func (m *Map[K, V]) Has(key K) bool {
-	_, ok := m.Load(key)
+	defer m.runlock(m.rlock())
+	_, ok := m.data[key]
 	return ok
 }
 
@@ -144,10 +355,15 @@ func (m *Map[K, V]) Has(key K) bool {
 //
 // ! Do not invoke any Map functions within 'f' to prevent a deadlock.
 func (m *Map[K, V]) Update(key K, f func(V, bool) V) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.lock()
+	defer m.unlock()
+	m.update(key, f)
+}
+
+// update implements Update, the caller must hold the write lock.
+func (m *Map[K, V]) update(key K, f func(V, bool) V) {
 	v, ok := m.data[key]
-	m.data[key] = f(v, ok)
+	m.set(OpUpdate, key, f(v, ok))
 }
 
 // UpdateRange is a thread-safe version of Range that locks the map for the duration of the iteration and allows for the modification of the values.
@@ -155,14 +371,14 @@ func (m *Map[K, V]) Update(key K, f func(V, bool) V) {
 //
 // ! Do not invoke any Map functions within 'f' to prevent a deadlock.
 func (m *Map[K, V]) UpdateRange(f func(K, V) (V, bool)) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.lock()
+	defer m.unlock()
 	for key, value := range m.data {
 		newValue, ok := f(key, value)
 		if !ok {
 			return
 		}
-		m.data[key] = newValue
+		m.set(OpUpdateRange, key, newValue)
 	}
 }
 
@@ -170,22 +386,58 @@ func (m *Map[K, V]) UpdateRange(f func(K, V) (V, bool)) {
 //
 // ! Do not invoke any Map functions within 'f' to prevent a deadlock.
 func (m *Map[K, V]) Exclusive(f func(m map[K]V)) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.lock()
+	defer m.unlock()
+	m.exclusive(f)
+}
+
+// exclusive implements Exclusive, the caller must hold the write lock.
+func (m *Map[K, V]) exclusive(f func(m map[K]V)) {
+	if !m.observed() || m.bulk() {
+		f(m.data)
+		return
+	}
+	before := maps.Clone(m.data)
+	defer m.reconcile(before)
 	f(m.data)
 }
 
+// reconcile emits the changes made to the map since before was taken, the caller must hold the write lock.
+// Values are compared with the Equal option, only the keys whose value changed are reported.
+func (m *Map[K, V]) reconcile(before map[K]V) {
+	for key, old := range before {
+		if _, ok := m.data[key]; !ok {
+			m.emit(Event[K, V]{Op: OpExclusive, Key: key, Old: old, Loaded: true, Deleted: true})
+		}
+	}
+	for key, value := range m.data {
+		old, loaded := before[key]
+		if !loaded || !m.equal(old, value) {
+			m.emit(Event[K, V]{Op: OpExclusive, Key: key, Old: old, Loaded: loaded, New: value})
+		}
+	}
+}
+
+// Transaction runs f with a Tx buffering its changes, the changes are applied atomically if f returns nil
+// and discarded if f returns an error or panics. The map is write locked for the duration of the transaction.
+// Committed changes are reported to the subscribers as Store and Delete events.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock, use tx instead.
+func (m *Map[K, V]) Transaction(f func(tx Tx[K, V]) error) error {
+	m.lock()
+	defer m.unlock()
+	return transaction(func(K) *Map[K, V] { return m }, f)
+}
+
 // Len returns the number of items in the map.
 func (m *Map[K, V]) Len() (n int) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	defer m.runlock(m.rlock())
 	return len(m.data)
 }
 
 // Keys returns a slice of all the keys present in the map, an empty slice is returned if the map is empty.
 func (m *Map[K, V]) Keys() (keys []K) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	defer m.runlock(m.rlock())
 	max := len(m.data)
 	if max == 0 {
 		return make([]K, 0)
@@ -202,8 +454,7 @@ func (m *Map[K, V]) Keys() (keys []K) {
 
 // Values returns a slice of all the values present in the map, an empty slice is returned if the map is empty.
 func (m *Map[K, V]) Values() (values []V) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	defer m.runlock(m.rlock())
 	max := len(m.data)
 	if max == 0 {
 		return make([]V, 0)
@@ -220,8 +471,7 @@ func (m *Map[K, V]) Values() (values []V) {
 
 // Entries returns two slices, one containing all the keys and the other containing all the values present in the map.
 func (m *Map[K, V]) Entries() (keys []K, values []V) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	defer m.runlock(m.rlock())
 	max := len(m.data)
 	if max == 0 {
 		return make([]K, 0), make([]V, 0)
@@ -237,3 +487,72 @@ func (m *Map[K, V]) Entries() (keys []K, values []V) {
 	}
 	return keys, values
 }
+
+// All returns an iterator over the key-value pairs in the map.
+// The map is read locked for the whole iteration, the lock is released when the loop ends or is broken out of.
+//
+// ! Do not invoke any Map functions within the loop body to prevent a deadlock.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		defer m.runlock(m.rlock())
+		for key, value := range m.data {
+			if !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// KeysSeq returns an iterator over the keys in the map.
+// The map is read locked for the whole iteration, the lock is released when the loop ends or is broken out of.
+//
+// ! Do not invoke any Map functions within the loop body to prevent a deadlock.
+func (m *Map[K, V]) KeysSeq() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		defer m.runlock(m.rlock())
+		for key := range m.data {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// ValuesSeq returns an iterator over the values in the map.
+// The map is read locked for the whole iteration, the lock is released when the loop ends or is broken out of.
+//
+// ! Do not invoke any Map functions within the loop body to prevent a deadlock.
+func (m *Map[K, V]) ValuesSeq() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		defer m.runlock(m.rlock())
+		for _, value := range m.data {
+			if !yield(value) {
+				return
+			}
+		}
+	}
+}
+
+// Watch returns a channel receiving an Event every time key is changed.
+// The subscription is removed and the channel closed once ctx is done, ctx must be cancelled to release it.
+// Changes made within Exclusive are reported once f returns, comparing the values with the Equal option.
+func (m *Map[K, V]) Watch(ctx context.Context, key K, opts ...WatchOption) <-chan Event[K, V] {
+	return watch(m.hub(), ctx, key, false, event[K, V], opts)
+}
+
+// WatchAll returns a channel receiving an Event every time any key is changed.
+// The subscription is removed and the channel closed once ctx is done, ctx must be cancelled to release it.
+func (m *Map[K, V]) WatchAll(ctx context.Context, opts ...WatchOption) <-chan Event[K, V] {
+	var zero K
+	return watch(m.hub(), ctx, zero, true, event[K, V], opts)
+}
+
+// hub returns the watch hub of the map, creating it if needed.
+func (m *Map[K, V]) hub() *watchHub[K, V] {
+	m.lock()
+	defer m.unlock()
+	if m.watch == nil {
+		m.watch = newWatchHub[K, V]()
+	}
+	return m.watch
+}
@@ -3,8 +3,10 @@ package internal_test
 import (
 	"context"
 	"fmt"
+	"maps"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/thetechpanda/mutex/internal"
 )
@@ -35,6 +37,21 @@ func TestNewWithMap(t *testing.T) {
 	}
 }
 
+func TestNewMapFromSeq(t *testing.T) {
+	data := map[string]int{
+		"key1": 42,
+		"key2": 43,
+	}
+	m := internal.NewMapFromSeq(maps.All(data))
+	if m.Len() != 2 {
+		t.Errorf("Len(): Expected length 2, got %d", m.Len())
+	}
+	v, ok := m.Load("key2")
+	if !ok || v != 43 {
+		t.Errorf("Load(): Expected value 43 for key %q, got value %d", "key2", v)
+	}
+}
+
 func TestMapLoad(t *testing.T) {
 	m := internal.NewMap[string, int](nil)
 	key := "key"
@@ -219,6 +236,85 @@ func TestMapRange(t *testing.T) {
 	}
 }
 
+func TestMapRangeReentrant(t *testing.T) {
+	m := internal.NewMap[int, int](nil)
+	for i := 0; i < 10; i++ {
+		m.Store(i, i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// f calls methods that need the write lock, this deadlocks unless Range released the lock.
+		m.Range(func(key, value int) bool {
+			m.Store(key+100, value)
+			m.Delete(key)
+			return true
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Range(): Expected f to be able to call Store and Delete")
+	}
+
+	if m.Len() != 10 {
+		t.Errorf("Len(): Expected length 10, got %d", m.Len())
+	}
+	for i := 0; i < 10; i++ {
+		if v, ok := m.Load(i + 100); !ok || v != i {
+			t.Errorf("Load(): Expected value %d for key %d, got %d", i, i+100, v)
+		}
+	}
+}
+
+func TestMapIterators(t *testing.T) {
+	m := internal.NewMap[int, int](nil)
+	for i := 0; i < 100; i++ {
+		m.Store(i, i)
+	}
+
+	sumKeys, sumValues := 0, 0
+	for key, value := range m.All() {
+		sumKeys += key
+		sumValues += value
+	}
+	if sumKeys != 4950 || sumValues != 4950 {
+		t.Errorf("All(): Expected sum 4950, got %d and %d", sumKeys, sumValues)
+	}
+
+	sumKeys = 0
+	for key := range m.KeysSeq() {
+		sumKeys += key
+	}
+	if sumKeys != 4950 {
+		t.Errorf("KeysSeq(): Expected sum 4950, got %d", sumKeys)
+	}
+
+	sumValues = 0
+	for value := range m.ValuesSeq() {
+		sumValues += value
+	}
+	if sumValues != 4950 {
+		t.Errorf("ValuesSeq(): Expected sum 4950, got %d", sumValues)
+	}
+
+	// breaking out of the loops must release the read lock.
+	for range m.All() {
+		break
+	}
+	for range m.KeysSeq() {
+		break
+	}
+	for range m.ValuesSeq() {
+		break
+	}
+	m.Store(100, 100)
+	if m.Len() != 101 {
+		t.Errorf("Len(): Expected length 101, got %d", m.Len())
+	}
+}
+
 func TestMapLen(t *testing.T) {
 	m := internal.NewMap[string, int](nil)
 	if m.Len() != 0 {
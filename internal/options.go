@@ -0,0 +1,76 @@
+package internal
+
+import "reflect"
+
+// Options configures a Map or a Value.
+type Options[V any] struct {
+	// Equal reports whether two values are equal, it is used by CompareAndSwap and CompareAndDelete and to
+	// detect the values changed within Exclusive. When Equal is nil values are compared with == if V holds
+	// no pointer, interface, map, slice, channel or function, and with reflect.DeepEqual otherwise.
+	Equal func(a, b V) bool
+	// Copy copies a value for Snapshot and Clone, see WithCopy. When Copy is nil values are copied by assignment.
+	Copy func(V) V
+	// Stats enables the recording of the lock activity returned by Stats, see WithStats.
+	Stats bool
+}
+
+// Option is a function that configures a Map or a Value.
+type Option[V any] func(*Options[V])
+
+// WithEqual sets the function used to compare values, a nil equal restores the default comparison.
+func WithEqual[V any](equal func(a, b V) bool) Option[V] {
+	return func(o *Options[V]) {
+		o.Equal = equal
+	}
+}
+
+// options returns the options set by opts, Equal is never nil.
+func options[V any](opts []Option[V]) Options[V] {
+	var o Options[V]
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.Equal == nil {
+		o.Equal = defaultEqual[V]()
+	}
+	return o
+}
+
+// defaultEqual returns == if it gives the same result as reflect.DeepEqual for values of type V,
+// that is if V is made only of booleans, numbers and strings, and reflect.DeepEqual otherwise.
+func defaultEqual[V any]() func(a, b V) bool {
+	if flat(reflect.TypeFor[V]()) {
+		return func(a, b V) bool { return any(a) == any(b) }
+	}
+	return deepEqual[V]
+}
+
+func deepEqual[V any](a, b V) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// comparableEqual compares values with ==.
+func comparableEqual[V comparable](a, b V) bool {
+	return a == b
+}
+
+// flat returns true if values of type t are made only of booleans, numbers and strings.
+func flat(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	case reflect.Array:
+		return flat(t.Elem())
+	case reflect.Struct:
+		for i := range t.NumField() {
+			if !flat(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package internal_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+func TestMapEqual(t *testing.T) {
+	now := time.Now()
+	utc := now.UTC()
+	m := internal.NewMap(map[string]time.Time{"a": now}, internal.WithEqual(time.Time.Equal))
+	if !m.CompareAndSwap("a", utc, utc) {
+		t.Errorf("CompareAndSwap(): Expected the same instant in another location to be equal")
+	}
+	if !m.CompareAndDelete("a", now) {
+		t.Errorf("CompareAndDelete(): Expected the same instant in another location to be equal")
+	}
+
+	d := internal.NewMap(map[string]time.Time{"a": now})
+	if d.CompareAndSwap("a", utc, utc) {
+		t.Errorf("CompareAndSwap(): Expected times in different locations to differ by default")
+	}
+
+	s := internal.NewShardedMap(2, intHash, internal.WithEqual(func(a, b string) bool { return len(a) == len(b) }))
+	s.Store(1, "abc")
+	if !s.CompareAndSwap(1, "xyz", "new") || !s.CompareAndDelete(1, "old") {
+		t.Errorf("CompareAndSwap(): Expected the custom equal function to be used by every shard")
+	}
+}
+
+func TestMapDefaultEqual(t *testing.T) {
+	type flat struct {
+		A int
+		B [2]string
+	}
+	f := internal.NewMap(map[string]flat{"a": {1, [2]string{"x", "y"}}})
+	if !f.CompareAndSwap("a", flat{1, [2]string{"x", "y"}}, flat{2, [2]string{}}) {
+		t.Errorf("CompareAndSwap(): Expected equal flat structs to be swapped")
+	}
+	if f.CompareAndSwap("a", flat{1, [2]string{"x", "y"}}, flat{}) {
+		t.Errorf("CompareAndSwap(): Expected different flat structs not to be swapped")
+	}
+
+	// pointers, slices and interfaces keep being compared with reflect.DeepEqual.
+	v1, v2 := 1, 1
+	p := internal.NewMap(map[string]*int{"a": &v1})
+	if !p.CompareAndSwap("a", &v2, &v2) {
+		t.Errorf("CompareAndSwap(): Expected pointers to equal values to be equal")
+	}
+	s := internal.NewMap(map[string][]int{"a": {1, 2}})
+	if !s.CompareAndDelete("a", []int{1, 2}) {
+		t.Errorf("CompareAndDelete(): Expected equal slices to be equal")
+	}
+	a := internal.NewMap(map[string]any{"a": []int{1}})
+	if !a.CompareAndSwap("a", []int{1}, 2) || !a.CompareAndSwap("a", 2, 3) {
+		t.Errorf("CompareAndSwap(): Expected interface values to be compared deeply")
+	}
+}
+
+func TestComparableMap(t *testing.T) {
+	m := internal.NewComparableMap(map[string]int{"a": 1})
+	if m.CompareAndSwap("a", 2, 3) || !m.CompareAndSwap("a", 1, 2) {
+		t.Errorf("CompareAndSwap(): Expected only the matching swap to succeed")
+	}
+	v := internal.NewComparableValue[string]()
+	if v.CompareAndSwap("", "a") {
+		t.Errorf("CompareAndSwap(): Expected unset value not to be swapped")
+	}
+	v.Store("a")
+	if !v.CompareAndSwap("a", "b") {
+		t.Errorf("CompareAndSwap(): Expected value to be swapped")
+	}
+}
+
+func TestValueEqual(t *testing.T) {
+	now := time.Now()
+	v := internal.NewWithValue(now, internal.WithEqual(time.Time.Equal))
+	if !v.CompareAndSwap(now.UTC(), now) {
+		t.Errorf("CompareAndSwap(): Expected the same instant in another location to be equal")
+	}
+	n := internal.NewNumericWithValue(1.5)
+	if !n.CompareAndSwap(1.5, 2) {
+		t.Errorf("CompareAndSwap(): Expected numeric value to be swapped")
+	}
+}
+
+func TestExclusiveEqual(t *testing.T) {
+	type cached struct {
+		ID    int
+		cache string
+	}
+	m := internal.NewMap(map[int]cached{1: {ID: 1}}, internal.WithEqual(func(a, b cached) bool { return a.ID == b.ID }))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := m.WatchAll(ctx)
+	m.Exclusive(func(data map[int]cached) {
+		data[1] = cached{ID: 1, cache: "warm"}
+		data[2] = cached{ID: 2}
+	})
+	if e := receive(t, ch); e.Key != 2 {
+		t.Errorf("Exclusive(): Expected only key 2 to be reported, got %+v", e)
+	}
+}
+
+func BenchmarkCompareAndSwap(b *testing.B) {
+	type point struct{ X, Y, Z float64 }
+	for _, bm := range []struct {
+		name string
+		m    *internal.Map[int, point]
+	}{
+		{"DeepEqual", internal.NewMap(map[int]point{1: {}}, internal.WithEqual(func(a, b point) bool { return reflect.DeepEqual(a, b) }))},
+		{"Default", internal.NewMap(map[int]point{1: {}})},
+		{"Comparable", internal.NewComparableMap(map[int]point{1: {}})},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				bm.m.CompareAndSwap(1, point{}, point{})
+			}
+		})
+	}
+}
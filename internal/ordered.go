@@ -0,0 +1,214 @@
+package internal
+
+import (
+	"container/list"
+	"iter"
+)
+
+// OrderedMap implements a thread-safe map remembering the order in which its keys were inserted.
+//
+// Range, Keys, Values, Entries, UpdateRange and the iterators visit the keys from the oldest to the newest.
+// Storing a key already present keeps its position, a deleted key is appended again when stored.
+// Exclusive appends the keys added by f in unspecified order, keys already present keep their position.
+type OrderedMap[K comparable, V any] struct {
+	*Map[K, V]
+	order *list.List // front is the oldest key, guarded by the map lock.
+	elems map[K]*list.Element
+}
+
+// NewOrderedMap returns a new, empty OrderedMap.
+func NewOrderedMap[K comparable, V any](opts ...Option[V]) *OrderedMap[K, V] {
+	m := &OrderedMap[K, V]{
+		Map:   NewMap[K, V](nil, opts...),
+		order: list.New(),
+		elems: make(map[K]*list.Element),
+	}
+	m.Map.obs = m
+	return m
+}
+
+func (m *OrderedMap[K, V]) accessed(key K) {}
+
+func (m *OrderedMap[K, V]) changed(e Event[K, V]) {
+	switch {
+	case e.Deleted:
+		if el, ok := m.elems[e.Key]; ok {
+			m.order.Remove(el)
+			delete(m.elems, e.Key)
+		}
+	case !e.Loaded:
+		m.elems[e.Key] = m.order.PushBack(e.Key)
+	}
+}
+
+func (m *OrderedMap[K, V]) unlocking() func() {
+	return nil
+}
+
+// replaceOrdered replaces the content of the map with the entries of keys and values, the keys follow the order of keys.
+// If a key appears more than once the last value and the last position are kept. The caller must hold the write lock.
+func (m *OrderedMap[K, V]) replaceOrdered(keys []K, values []V) {
+	data := make(map[K]V, len(keys))
+	for i, key := range keys {
+		data[key] = values[i]
+	}
+	m.Map.replace(data)
+	for _, key := range keys {
+		m.order.MoveToBack(m.elems[key])
+	}
+}
+
+// keys calls f for each key from the oldest to the newest until f returns false, the caller must hold the lock.
+func (m *OrderedMap[K, V]) keys(f func(K) bool) {
+	for el := m.order.Front(); el != nil; el = el.Next() {
+		if !f(el.Value.(K)) {
+			return
+		}
+	}
+}
+
+// MoveToFront moves key to the front of the map, making it the oldest key.
+// It returns false if key is not present.
+func (m *OrderedMap[K, V]) MoveToFront(key K) bool {
+	m.Map.lock()
+	defer m.Map.unlock()
+	el, ok := m.elems[key]
+	if ok {
+		m.order.MoveToFront(el)
+	}
+	return ok
+}
+
+// MoveToBack moves key to the back of the map, making it the newest key.
+// It returns false if key is not present.
+func (m *OrderedMap[K, V]) MoveToBack(key K) bool {
+	m.Map.lock()
+	defer m.Map.unlock()
+	el, ok := m.elems[key]
+	if ok {
+		m.order.MoveToBack(el)
+	}
+	return ok
+}
+
+// Oldest returns the key at the front of the map and its value, ok is false if the map is empty.
+func (m *OrderedMap[K, V]) Oldest() (key K, value V, ok bool) {
+	defer m.Map.runlock(m.Map.rlock())
+	return m.at(m.order.Front())
+}
+
+// Newest returns the key at the back of the map and its value, ok is false if the map is empty.
+func (m *OrderedMap[K, V]) Newest() (key K, value V, ok bool) {
+	defer m.Map.runlock(m.Map.rlock())
+	return m.at(m.order.Back())
+}
+
+// at returns the key held by el and its value, the caller must hold the lock.
+func (m *OrderedMap[K, V]) at(el *list.Element) (key K, value V, ok bool) {
+	if el == nil {
+		return key, value, false
+	}
+	key = el.Value.(K)
+	return key, m.Map.data[key], true
+}
+
+// Keys returns a slice of all the keys present in the map in insertion order, an empty slice is returned if the map is empty.
+func (m *OrderedMap[K, V]) Keys() []K {
+	defer m.Map.runlock(m.Map.rlock())
+	keys := make([]K, 0, len(m.Map.data))
+	m.keys(func(key K) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// Values returns a slice of all the values present in the map in insertion order, an empty slice is returned if the map is empty.
+func (m *OrderedMap[K, V]) Values() []V {
+	defer m.Map.runlock(m.Map.rlock())
+	values := make([]V, 0, len(m.Map.data))
+	m.keys(func(key K) bool {
+		values = append(values, m.Map.data[key])
+		return true
+	})
+	return values
+}
+
+// Entries returns two slices, one containing all the keys and the other containing all the values present in the map,
+// both in insertion order.
+func (m *OrderedMap[K, V]) Entries() (keys []K, values []V) {
+	defer m.Map.runlock(m.Map.rlock())
+	keys = make([]K, 0, len(m.Map.data))
+	values = make([]V, 0, len(m.Map.data))
+	m.keys(func(key K) bool {
+		keys = append(keys, key)
+		values = append(values, m.Map.data[key])
+		return true
+	})
+	return keys, values
+}
+
+// Range calls f sequentially for each key and value present in the map, in insertion order.
+// If f returns false, Range stops the iteration.
+//
+// Range iterates over a copy of the entries taken under the read lock, f may call any method on the map.
+func (m *OrderedMap[K, V]) Range(f func(K, V) bool) {
+	keys, values := m.Entries()
+	for i := range keys {
+		if !f(keys[i], values[i]) {
+			break
+		}
+	}
+}
+
+// UpdateRange is the same as Map.UpdateRange but visits the keys in insertion order, updating a value keeps its position.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (m *OrderedMap[K, V]) UpdateRange(f func(K, V) (V, bool)) {
+	m.Map.lock()
+	defer m.Map.unlock()
+	m.keys(func(key K) bool {
+		value, ok := f(key, m.Map.data[key])
+		if ok {
+			m.Map.set(OpUpdateRange, key, value)
+		}
+		return ok
+	})
+}
+
+// All returns an iterator over the key-value pairs in the map, in insertion order.
+// The map is read locked for the whole iteration, the lock is released when the loop ends or is broken out of.
+//
+// ! Do not invoke any Map functions within the loop body to prevent a deadlock.
+func (m *OrderedMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		defer m.Map.runlock(m.Map.rlock())
+		m.keys(func(key K) bool {
+			return yield(key, m.Map.data[key])
+		})
+	}
+}
+
+// KeysSeq returns an iterator over the keys in the map, in insertion order.
+// The map is read locked for the whole iteration, the lock is released when the loop ends or is broken out of.
+//
+// ! Do not invoke any Map functions within the loop body to prevent a deadlock.
+func (m *OrderedMap[K, V]) KeysSeq() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		defer m.Map.runlock(m.Map.rlock())
+		m.keys(yield)
+	}
+}
+
+// ValuesSeq returns an iterator over the values in the map, in insertion order.
+// The map is read locked for the whole iteration, the lock is released when the loop ends or is broken out of.
+//
+// ! Do not invoke any Map functions within the loop body to prevent a deadlock.
+func (m *OrderedMap[K, V]) ValuesSeq() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		defer m.Map.runlock(m.Map.rlock())
+		m.keys(func(key K) bool {
+			return yield(m.Map.data[key])
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package internal_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+func TestOrderedMapOrder(t *testing.T) {
+	m := internal.NewOrderedMap[string, int]()
+	for i, key := range []string{"c", "a", "d", "b"} {
+		m.Store(key, i)
+	}
+	m.Store("a", 42)
+	m.Delete("d")
+	m.Store("d", 7)
+	expectKeys := []string{"c", "a", "b", "d"}
+	if keys := m.Keys(); !reflect.DeepEqual(keys, expectKeys) {
+		t.Errorf("Keys(): Expected %v, got %v", expectKeys, keys)
+	}
+	expectValues := []int{0, 42, 3, 7}
+	if values := m.Values(); !reflect.DeepEqual(values, expectValues) {
+		t.Errorf("Values(): Expected %v, got %v", expectValues, values)
+	}
+	keys, values := m.Entries()
+	if !reflect.DeepEqual(keys, expectKeys) || !reflect.DeepEqual(values, expectValues) {
+		t.Errorf("Entries(): Expected %v %v, got %v %v", expectKeys, expectValues, keys, values)
+	}
+
+	var ranged []string
+	m.Range(func(key string, value int) bool {
+		ranged = append(ranged, key)
+		// Range runs on a copy, f may call the map.
+		m.Len()
+		return len(ranged) < 3
+	})
+	if !reflect.DeepEqual(ranged, expectKeys[:3]) {
+		t.Errorf("Range(): Expected %v, got %v", expectKeys[:3], ranged)
+	}
+
+	var all []string
+	for key := range m.All() {
+		all = append(all, key)
+	}
+	if !reflect.DeepEqual(all, expectKeys) {
+		t.Errorf("All(): Expected %v, got %v", expectKeys, all)
+	}
+	var seq []string
+	for key := range m.KeysSeq() {
+		seq = append(seq, key)
+	}
+	if !reflect.DeepEqual(seq, expectKeys) {
+		t.Errorf("KeysSeq(): Expected %v, got %v", expectKeys, seq)
+	}
+	var vseq []int
+	for value := range m.ValuesSeq() {
+		vseq = append(vseq, value)
+		if len(vseq) == 2 {
+			break
+		}
+	}
+	if !reflect.DeepEqual(vseq, expectValues[:2]) {
+		t.Errorf("ValuesSeq(): Expected %v, got %v", expectValues[:2], vseq)
+	}
+}
+
+func TestOrderedMapUpdateRange(t *testing.T) {
+	m := internal.NewOrderedMap[string, int]()
+	for i, key := range []string{"b", "a", "c"} {
+		m.Store(key, i)
+	}
+	var visited []string
+	m.UpdateRange(func(key string, value int) (int, bool) {
+		visited = append(visited, key)
+		return value * 10, key != "a"
+	})
+	if expect := []string{"b", "a"}; !reflect.DeepEqual(visited, expect) {
+		t.Errorf("UpdateRange(): Expected to visit %v, got %v", expect, visited)
+	}
+	if expect := []int{0, 1, 2}; !reflect.DeepEqual(m.Values(), expect) {
+		t.Errorf("UpdateRange(): Expected values %v, got %v", expect, m.Values())
+	}
+	if expect := []string{"b", "a", "c"}; !reflect.DeepEqual(m.Keys(), expect) {
+		t.Errorf("UpdateRange(): Expected keys %v, got %v", expect, m.Keys())
+	}
+}
+
+func TestOrderedMapMove(t *testing.T) {
+	m := internal.NewOrderedMap[string, int]()
+	if _, _, ok := m.Oldest(); ok {
+		t.Errorf("Oldest(): Expected empty map")
+	}
+	if _, _, ok := m.Newest(); ok {
+		t.Errorf("Newest(): Expected empty map")
+	}
+	if m.MoveToFront("a") || m.MoveToBack("a") {
+		t.Errorf("MoveToFront(), MoveToBack(): Expected false for a missing key")
+	}
+	for i, key := range []string{"a", "b", "c"} {
+		m.Store(key, i)
+	}
+	if key, value, ok := m.Oldest(); !ok || key != "a" || value != 0 {
+		t.Errorf("Oldest(): Expected a 0, got %v %v %v", key, value, ok)
+	}
+	if key, value, ok := m.Newest(); !ok || key != "c" || value != 2 {
+		t.Errorf("Newest(): Expected c 2, got %v %v %v", key, value, ok)
+	}
+	if !m.MoveToFront("c") || !m.MoveToBack("a") {
+		t.Errorf("MoveToFront(), MoveToBack(): Expected true for a present key")
+	}
+	if expect := []string{"c", "b", "a"}; !reflect.DeepEqual(m.Keys(), expect) {
+		t.Errorf("Keys(): Expected %v, got %v", expect, m.Keys())
+	}
+	m.Store("c", 5)
+	if key, value, _ := m.Oldest(); key != "c" || value != 5 {
+		t.Errorf("Oldest(): Expected c 5, got %v %v", key, value)
+	}
+}
+
+func TestOrderedMapOperations(t *testing.T) {
+	m := internal.NewOrderedMap[string, int]()
+	m.StoreMany(map[string]int{"a": 1})
+	m.LoadOrStore("b", 2)
+	m.ComputeIfAbsent("c", func() int { return 3 })
+	m.Compute("a", func(int, bool) (int, internal.ComputeOp) { return 0, internal.ComputeDelete })
+	m.Swap("a", 4)
+	m.Exclusive(func(data map[string]int) {
+		delete(data, "b")
+		data["b"] = 5
+	})
+	// b is present before and after f, so it keeps its position.
+	if expect := []string{"b", "c", "a"}; !reflect.DeepEqual(m.Keys(), expect) {
+		t.Errorf("Keys(): Expected %v, got %v", expect, m.Keys())
+	}
+
+	err := m.Transaction(func(tx internal.Tx[string, int]) error {
+		tx.Store("d", 6)
+		return errors.New("rollback")
+	})
+	if err == nil || m.Has("d") || m.Len() != 3 {
+		t.Errorf("Transaction(): Expected rollback, got keys %v", m.Keys())
+	}
+	m.Transaction(func(tx internal.Tx[string, int]) error {
+		tx.Delete("c")
+		tx.Store("d", 6)
+		return nil
+	})
+	if expect := []string{"b", "a", "d"}; !reflect.DeepEqual(m.Keys(), expect) {
+		t.Errorf("Transaction(): Expected %v, got %v", expect, m.Keys())
+	}
+
+	m.Clear()
+	if _, _, ok := m.Oldest(); ok || len(m.Keys()) != 0 {
+		t.Errorf("Clear(): Expected empty map, got %v", m.Keys())
+	}
+	m.Store("z", 1)
+	m.Store("y", 2)
+	if expect := []string{"z", "y"}; !reflect.DeepEqual(m.Keys(), expect) {
+		t.Errorf("Keys(): Expected %v, got %v", expect, m.Keys())
+	}
+}
+
+func TestOrderedMapJSON(t *testing.T) {
+	m := internal.NewOrderedMap[string, int]()
+	m.Store("z", 1)
+	m.Store("a", 2)
+	m.Store("m", 3)
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("MarshalJSON(): Expected no error, got %v", err)
+	}
+	if expect := `{"z":1,"a":2,"m":3}`; string(data) != expect {
+		t.Errorf("MarshalJSON(): Expected %s, got %s", expect, data)
+	}
+	if expect := `{"z":1,"a":2,"m":3}`; m.String() != expect {
+		t.Errorf("String(): Expected %s, got %s", expect, m.String())
+	}
+	if s := internal.NewOrderedMap[string, int]().String(); s != "{}" {
+		t.Errorf("String(): Expected {}, got %s", s)
+	}
+
+	out := internal.NewOrderedMap[int, string]()
+	out.Store(7, "removed")
+	out.Store(3, "kept")
+	if err := json.Unmarshal([]byte(`{"5":"e","3":"c","10":"j"}`), out); err != nil {
+		t.Fatalf("UnmarshalJSON(): Expected no error, got %v", err)
+	}
+	if expect := []int{5, 3, 10}; !reflect.DeepEqual(out.Keys(), expect) {
+		t.Errorf("UnmarshalJSON(): Expected keys %v, got %v", expect, out.Keys())
+	}
+	if expect := []string{"e", "c", "j"}; !reflect.DeepEqual(out.Values(), expect) {
+		t.Errorf("UnmarshalJSON(): Expected values %v, got %v", expect, out.Values())
+	}
+	if err := json.Unmarshal([]byte(`{"x":"y"}`), out); err == nil || out.Len() != 3 {
+		t.Errorf("UnmarshalJSON(): Expected an error and the map unchanged, got %v, %v", err, out.Keys())
+	}
+	if err := json.Unmarshal([]byte(`null`), out); err != nil || out.Len() != 0 {
+		t.Errorf("UnmarshalJSON(): Expected null to empty the map, got %v, %v", err, out.Keys())
+	}
+}
+
+func TestOrderedMapSnapshot(t *testing.T) {
+	m := internal.NewOrderedMap[string, int]()
+	for i, key := range []string{"z", "a", "m"} {
+		m.Store(key, i)
+	}
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo(): Expected no error, got %v", err)
+	}
+	data := buf.Bytes()
+	out := internal.NewOrderedMap[string, int]()
+	out.Store("b", 0)
+	if _, err := out.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatalf("ReadFrom(): Expected no error, got %v", err)
+	}
+	if expect := []string{"z", "a", "m"}; !reflect.DeepEqual(out.Keys(), expect) {
+		t.Errorf("ReadFrom(): Expected keys %v, got %v", expect, out.Keys())
+	}
+	if _, err := internal.NewMap[string, int](nil).ReadFrom(bytes.NewReader(data)); !errors.Is(err, internal.ErrInvalidSnapshot) {
+		t.Errorf("ReadFrom(): Expected a Map to reject an ordered snapshot, got %v", err)
+	}
+
+	encoded, err := m.GobEncode()
+	if err != nil {
+		t.Fatalf("GobEncode(): Expected no error, got %v", err)
+	}
+	decoded := internal.NewOrderedMap[string, int]()
+	if err := decoded.GobDecode(encoded); err != nil || !reflect.DeepEqual(decoded.Keys(), m.Keys()) {
+		t.Errorf("GobDecode(): Expected keys %v, got %v, %v", m.Keys(), decoded.Keys(), err)
+	}
+	empty := internal.NewOrderedMap[string, int]()
+	buf.Reset()
+	empty.WriteTo(&buf)
+	if _, err := decoded.ReadFrom(&buf); err != nil || decoded.Len() != 0 {
+		t.Errorf("ReadFrom(): Expected an empty map, got %v, %v", decoded.Keys(), err)
+	}
+}
+
+func TestOrderedMapClone(t *testing.T) {
+	m := internal.NewOrderedMap[string](internal.WithCopy(func(v []int) []int { return append([]int(nil), v...) }))
+	m.Store("z", []int{1})
+	m.Store("a", []int{2})
+	c := m.Clone()
+	m.Exclusive(func(data map[string][]int) { data["z"][0] = 10 })
+	m.Store("b", nil)
+	if expect := []string{"z", "a"}; !reflect.DeepEqual(c.Keys(), expect) {
+		t.Errorf("Clone(): Expected keys %v, got %v", expect, c.Keys())
+	}
+	if v, _ := c.Load("z"); v[0] != 1 {
+		t.Errorf("Clone(): Expected the values to be copied, got %v", v)
+	}
+	// the clone tracks its own order.
+	c.Store("c", nil)
+	c.MoveToFront("a")
+	if expect := []string{"a", "z", "c"}; !reflect.DeepEqual(c.Keys(), expect) {
+		t.Errorf("Clone(): Expected keys %v, got %v", expect, c.Keys())
+	}
+	if expect := []string{"z", "a", "b"}; !reflect.DeepEqual(m.Keys(), expect) {
+		t.Errorf("Clone(): Expected the original keys %v, got %v", expect, m.Keys())
+	}
+}
@@ -0,0 +1,545 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SyncPolicy defines when a PersistentMap flushes its log to stable storage with fsync.
+// The log is always written to the operating system before a mutation returns, so it survives a crash of the
+// process; the policy only controls how many mutations may be lost if the machine crashes.
+type SyncPolicy uint8
+
+const (
+	// SyncAlways syncs the log before every mutation returns.
+	SyncAlways SyncPolicy = iota
+	// SyncBatch syncs the log once BatchSize records have been written since the last sync.
+	SyncBatch
+	// SyncInterval syncs the log every SyncInterval from a background goroutine.
+	SyncInterval
+)
+
+// PersistentOptions configures a PersistentMap.
+type PersistentOptions[K comparable, V any] struct {
+	// KeyCodec encodes the keys in the log, defaults to GobCodec.
+	KeyCodec Codec[K]
+	// ValueCodec encodes the values in the log, defaults to GobCodec.
+	ValueCodec Codec[V]
+	// Sync is the policy used to sync the log, defaults to SyncAlways.
+	Sync SyncPolicy
+	// BatchSize is the number of records written between two syncs with SyncBatch, defaults to 64.
+	BatchSize int
+	// SyncInterval is the interval between two syncs with SyncInterval, defaults to one second.
+	SyncInterval time.Duration
+	// CompactSize is the size in bytes the log must reach to be compacted into a snapshot, defaults to 4 MiB.
+	// A negative CompactSize disables automatic compaction.
+	CompactSize int64
+}
+
+// ErrClosed is returned by Compact and Sync once the map is closed, and by Err once the map is mutated after Close.
+var ErrClosed = errors.New("mutex: persistent map closed")
+
+// ErrInvalidLog is returned when a snapshot or a log record cannot be decoded.
+var ErrInvalidLog = errors.New("mutex: invalid log")
+
+const (
+	logName      = "wal"
+	snapshotName = "snapshot"
+)
+
+// record operations.
+const (
+	recordPut    byte = 1
+	recordDelete byte = 2
+	recordClear  byte = 3
+)
+
+// PersistentMap implements a thread-safe map whose mutations are appended to a log file, so that the map content
+// survives a restart. The log is replayed by OpenPersistentMap and compacted into a snapshot once it grows past
+// the configured size.
+//
+// Every change to the map is logged, whatever the method that made it, including Exclusive, UpdateRange
+// and Transaction. Clear is logged as a single record.
+//
+// The log is made of records holding a length, a CRC-32 checksum and the operation. When the log is replayed an
+// incomplete or corrupted final record is assumed to be a write interrupted by a crash and is removed from the
+// log, a corrupted record followed by other records fails the replay with ErrInvalidLog.
+type PersistentMap[K comparable, V any] struct {
+	*Map[K, V]
+	dir      string
+	opts     PersistentOptions[K, V]
+	clearing bool // set while Clear runs, the map is write locked.
+
+	logMu    sync.Mutex // guards the fields below, the map lock is always acquired first.
+	file     *os.File
+	w        *bufio.Writer
+	size     int64 // size of the log in bytes.
+	unsynced int   // records written since the last sync.
+	err      error // first error met writing the log.
+	closed   bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// OpenPersistentMap opens the persistent map stored in dir, creating dir if needed, and replays its log.
+// Close must be called to release the log file.
+func OpenPersistentMap[K comparable, V any](dir string, opts PersistentOptions[K, V]) (*PersistentMap[K, V], error) {
+	if opts.KeyCodec == nil {
+		opts.KeyCodec = GobCodec[K]{}
+	}
+	if opts.ValueCodec == nil {
+		opts.ValueCodec = GobCodec[V]{}
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 64
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = time.Second
+	}
+	if opts.CompactSize == 0 {
+		opts.CompactSize = 4 << 20
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	m := &PersistentMap[K, V]{
+		Map:  NewMap[K, V](nil),
+		dir:  dir,
+		opts: opts,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if err := m.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := m.openLog(); err != nil {
+		return nil, err
+	}
+	m.Map.obs = m
+	if opts.Sync == SyncInterval {
+		go m.syncer()
+	} else {
+		close(m.done)
+	}
+	return m, nil
+}
+
+// loadSnapshot loads the snapshot, if any, into the map.
+func (m *PersistentMap[K, V]) loadSnapshot() error {
+	f, err := os.Open(filepath.Join(m.dir, snapshotName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	_, torn, err := m.replay(f, info.Size())
+	if err != nil {
+		return err
+	}
+	if torn {
+		// the snapshot is renamed into place once complete, it can only be damaged by a storage failure.
+		return fmt.Errorf("%w: corrupted snapshot", ErrInvalidLog)
+	}
+	return nil
+}
+
+// openLog opens the log, replays it and removes its final record if it is incomplete or corrupted.
+func (m *PersistentMap[K, V]) openLog() error {
+	f, err := os.OpenFile(filepath.Join(m.dir, logName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	offset, torn, err := m.replay(f, info.Size())
+	if err == nil && torn {
+		err = f.Truncate(offset)
+		if err == nil {
+			err = f.Sync()
+		}
+	}
+	if err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	m.file, m.w, m.size = f, bufio.NewWriter(f), offset
+	return nil
+}
+
+// replay applies the records read from r to the map, size is the number of bytes available in r.
+// It returns the offset following the last valid record and whether the final record is incomplete or corrupted.
+// A damaged record followed by a valid one returns ErrInvalidLog, the records following it are not dropped.
+func (m *PersistentMap[K, V]) replay(r io.Reader, size int64) (offset int64, torn bool, err error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, 8)
+	for {
+		read, err := io.ReadFull(br, header)
+		if err == io.EOF {
+			return offset, false, nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			return damaged(offset, header[:read], br)
+		}
+		if err != nil {
+			return offset, false, err
+		}
+		n := int64(binary.BigEndian.Uint32(header))
+		if n == 0 || offset+8+n > size {
+			return damaged(offset, header, br)
+		}
+		body := make([]byte, n)
+		if read, err := io.ReadFull(br, body); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return damaged(offset, append(header, body[:read]...), br)
+			}
+			return offset, false, err
+		}
+		if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(header[4:]) {
+			return damaged(offset, append(header, body...), br)
+		}
+		if err := m.apply(body); err != nil {
+			return offset, false, err
+		}
+		offset += 8 + n
+	}
+}
+
+// damaged returns the result of replay for the damaged record found at offset, read holds the bytes of the record
+// already read from r. The record is the final write torn by a crash, unless a valid record follows it: the log is
+// then corrupted and ErrInvalidLog is returned.
+func damaged(offset int64, read []byte, r io.Reader) (int64, bool, error) {
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		return offset, false, err
+	}
+	if validRecord(append(read, rest...)[1:]) {
+		return offset, false, fmt.Errorf("%w: corrupted record at offset %d", ErrInvalidLog, offset)
+	}
+	return offset, true, nil
+}
+
+// validRecord reports whether a record with a known operation, a length within data and a matching checksum
+// starts at any position of data.
+func validRecord(data []byte) bool {
+	for i := 0; i+8 < len(data); i++ {
+		n := int(binary.BigEndian.Uint32(data[i:]))
+		if n == 0 || n > len(data)-i-8 {
+			continue
+		}
+		body := data[i+8 : i+8+n]
+		if body[0] < recordPut || body[0] > recordClear {
+			continue
+		}
+		if crc32.ChecksumIEEE(body) == binary.BigEndian.Uint32(data[i+4:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply applies the record body to the map data.
+func (m *PersistentMap[K, V]) apply(body []byte) error {
+	if body[0] == recordClear {
+		clear(m.Map.data)
+		return nil
+	}
+	n, read := binary.Uvarint(body[1:])
+	if read <= 0 || uint64(len(body)-1-read) < n {
+		return fmt.Errorf("%w: bad key length", ErrInvalidLog)
+	}
+	keyData := body[1+read : 1+read+int(n)]
+	key, err := m.opts.KeyCodec.Unmarshal(keyData)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidLog, err)
+	}
+	switch body[0] {
+	case recordPut:
+		value, err := m.opts.ValueCodec.Unmarshal(body[1+read+int(n):])
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidLog, err)
+		}
+		m.Map.data[key] = value
+	case recordDelete:
+		delete(m.Map.data, key)
+	default:
+		return fmt.Errorf("%w: unknown operation %d", ErrInvalidLog, body[0])
+	}
+	return nil
+}
+
+// encode returns the record for op, value is ignored unless op is recordPut.
+func (m *PersistentMap[K, V]) encode(op byte, key K, value V) ([]byte, error) {
+	body := []byte{op}
+	if op != recordClear {
+		k, err := m.opts.KeyCodec.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		body = binary.AppendUvarint(body, uint64(len(k)))
+		body = append(body, k...)
+	}
+	if op == recordPut {
+		v, err := m.opts.ValueCodec.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, v...)
+	}
+	rec := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(rec, uint32(len(body)))
+	binary.BigEndian.PutUint32(rec[4:], crc32.ChecksumIEEE(body))
+	return append(rec, body...), nil
+}
+
+// append writes a record to the log, the map is write locked.
+func (m *PersistentMap[K, V]) append(op byte, key K, value V) {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+	if m.closed {
+		m.fail(ErrClosed)
+		return
+	}
+	if m.err != nil {
+		return
+	}
+	rec, err := m.encode(op, key, value)
+	if err != nil {
+		m.fail(err)
+		return
+	}
+	n, err := m.w.Write(rec)
+	m.size += int64(n)
+	m.unsynced++
+	m.fail(err)
+}
+
+// fail records err as the first error met writing the log, if it is not nil. The caller must hold logMu.
+func (m *PersistentMap[K, V]) fail(err error) {
+	if m.err == nil {
+		m.err = err
+	}
+}
+
+// sync flushes the log and syncs it to stable storage. The caller must hold logMu.
+func (m *PersistentMap[K, V]) sync() error {
+	if err := m.w.Flush(); err != nil {
+		return err
+	}
+	if m.unsynced == 0 {
+		return nil
+	}
+	if err := m.file.Sync(); err != nil {
+		return err
+	}
+	m.unsynced = 0
+	return nil
+}
+
+func (m *PersistentMap[K, V]) accessed(key K) {}
+
+func (m *PersistentMap[K, V]) changed(e Event[K, V]) {
+	switch {
+	case m.clearing:
+	case e.Deleted:
+		var zero V
+		m.append(recordDelete, e.Key, zero)
+	default:
+		m.append(recordPut, e.Key, e.New)
+	}
+}
+
+// unlocking writes the records of the mutation to the log, syncing and compacting it if needed.
+func (m *PersistentMap[K, V]) unlocking() func() {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+	if m.closed || m.err != nil {
+		return nil
+	}
+	var err error
+	switch {
+	case m.opts.Sync == SyncAlways, m.opts.Sync == SyncBatch && m.unsynced >= m.opts.BatchSize:
+		err = m.sync()
+	default:
+		err = m.w.Flush()
+	}
+	if err == nil && m.opts.CompactSize > 0 && m.size >= m.opts.CompactSize {
+		err = m.compact()
+	}
+	m.fail(err)
+	return nil
+}
+
+// syncer syncs the log every SyncInterval until Close is called.
+func (m *PersistentMap[K, V]) syncer() {
+	defer close(m.done)
+	ticker := time.NewTicker(m.opts.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.logMu.Lock()
+			if !m.closed && m.err == nil {
+				m.fail(m.sync())
+			}
+			m.logMu.Unlock()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// compact writes the map content to a new snapshot and empties the log.
+// The caller must hold the map write lock and logMu.
+func (m *PersistentMap[K, V]) compact() error {
+	tmp := filepath.Join(m.dir, snapshotName+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for key, value := range m.Map.data {
+		rec, err := m.encode(recordPut, key, value)
+		if err == nil {
+			_, err = w.Write(rec)
+		}
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	// once the snapshot is in place replaying the log again is harmless, the records it holds are already applied.
+	if err := os.Rename(tmp, filepath.Join(m.dir, snapshotName)); err != nil {
+		return err
+	}
+	if err := syncDir(m.dir); err != nil {
+		return err
+	}
+	m.w.Reset(m.file)
+	if err := m.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := m.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	m.size, m.unsynced = 0, 0
+	return m.file.Sync()
+}
+
+// syncDir syncs the directory dir, so that a rename in dir is durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Clear removes all items from the map, it is logged as a single record.
+func (m *PersistentMap[K, V]) Clear() {
+	m.Map.lock()
+	defer m.Map.unlock()
+	var key K
+	var value V
+	m.append(recordClear, key, value)
+	m.clearing = true
+	defer func() {
+		m.clearing = false
+	}()
+	m.Map.clear()
+}
+
+// Compact writes the map content to a new snapshot and empties the log. Compact is called automatically
+// once the log grows past the configured size, the map is write locked while it runs.
+func (m *PersistentMap[K, V]) Compact() error {
+	m.Map.lock()
+	defer m.Map.unlock()
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	if err := m.w.Flush(); err != nil {
+		m.fail(err)
+		return err
+	}
+	err := m.compact()
+	m.fail(err)
+	return err
+}
+
+// Sync flushes the log and syncs it to stable storage, regardless of the sync policy.
+// Sync returns the first error met writing the log, if any.
+func (m *PersistentMap[K, V]) Sync() error {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	if m.err != nil {
+		return m.err
+	}
+	m.fail(m.sync())
+	return m.err
+}
+
+// Err returns the first error met writing the log, once an error is met no further mutation is logged.
+// Err returns ErrClosed if the map is mutated after Close.
+func (m *PersistentMap[K, V]) Err() error {
+	m.logMu.Lock()
+	defer m.logMu.Unlock()
+	return m.err
+}
+
+// Close syncs and closes the log, stopping the background goroutine used by SyncInterval.
+// Close returns the first error met writing the log, if any. The map can still be read after Close,
+// but its mutations are no longer logged. Close is safe to call more than once.
+func (m *PersistentMap[K, V]) Close() error {
+	m.logMu.Lock()
+	if m.closed {
+		m.logMu.Unlock()
+		return nil
+	}
+	m.closed = true
+	close(m.stop)
+	err := m.err
+	if err == nil {
+		err = m.sync()
+	}
+	if cerr := m.file.Close(); err == nil {
+		err = cerr
+	}
+	m.logMu.Unlock()
+	<-m.done
+	return err
+}
@@ -0,0 +1,288 @@
+package internal_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+func openPersistent(t *testing.T, dir string, opts internal.PersistentOptions[string, int]) *internal.PersistentMap[string, int] {
+	t.Helper()
+	m, err := internal.OpenPersistentMap(dir, opts)
+	if err != nil {
+		t.Fatalf("OpenPersistentMap(): Expected no error, got %v", err)
+	}
+	return m
+}
+
+func sortedKeys(m interface{ Keys() []string }) []string {
+	keys := m.Keys()
+	sort.Strings(keys)
+	return keys
+}
+
+func TestPersistentMapReplay(t *testing.T) {
+	dir := t.TempDir()
+	m := openPersistent(t, dir, internal.PersistentOptions[string, int]{})
+	m.Store("a", 1)
+	m.Store("b", 2)
+	m.Store("c", 3)
+	m.Clear()
+	m.Store("a", 1)
+	m.Store("b", 2)
+	m.Swap("b", 20)
+	m.CompareAndSwap("a", 1, 10)
+	m.Update("c", func(v int, ok bool) int { return v + 30 })
+	m.Delete("missing")
+	m.Store("d", 4)
+	m.Delete("d")
+	m.Exclusive(func(data map[string]int) {
+		data["e"] = 5
+	})
+	m.Transaction(func(tx internal.Tx[string, int]) error {
+		tx.Store("f", 6)
+		return nil
+	})
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close(): Expected no error, got %v", err)
+	}
+
+	r := openPersistent(t, dir, internal.PersistentOptions[string, int]{})
+	defer r.Close()
+	expected := map[string]int{"a": 10, "b": 20, "c": 30, "e": 5, "f": 6}
+	if r.Len() != len(expected) {
+		t.Errorf("OpenPersistentMap(): Expected keys %v, got %v", expected, sortedKeys(r))
+	}
+	for key, value := range expected {
+		if v, ok := r.Load(key); !ok || v != value {
+			t.Errorf("Load(%s): Expected value %d, got %d", key, value, v)
+		}
+	}
+}
+
+func TestPersistentMapTruncatedTail(t *testing.T) {
+	for _, damage := range []struct {
+		name string
+		f    func(data []byte) []byte
+	}{
+		{"truncated record", func(data []byte) []byte { return data[:len(data)-3] }},
+		{"truncated header", func(data []byte) []byte { return append(data, 0, 0, 0) }},
+		{"corrupted record", func(data []byte) []byte { data[len(data)-1] ^= 0xff; return data }},
+		{"corrupted length", func(data []byte) []byte {
+			binary.BigEndian.PutUint32(data[len(data)/3*2:], 0xfffffff0)
+			return data
+		}},
+	} {
+		t.Run(damage.name, func(t *testing.T) {
+			dir := t.TempDir()
+			m := openPersistent(t, dir, internal.PersistentOptions[string, int]{})
+			m.Store("a", 1)
+			m.Store("b", 2)
+			// simulates a crash: the map is not closed and the last write is damaged.
+			m.Store("c", 3)
+			wal := filepath.Join(dir, "wal")
+			data, err := os.ReadFile(wal)
+			if err != nil {
+				t.Fatalf("ReadFile(): Expected no error, got %v", err)
+			}
+			if err := os.WriteFile(wal, damage.f(data), 0o644); err != nil {
+				t.Fatalf("WriteFile(): Expected no error, got %v", err)
+			}
+			m.Close()
+
+			r := openPersistent(t, dir, internal.PersistentOptions[string, int]{})
+			keys := sortedKeys(r)
+			if damage.name == "truncated header" {
+				if len(keys) != 3 {
+					t.Errorf("OpenPersistentMap(): Expected keys [a b c], got %v", keys)
+				}
+			} else if len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+				t.Errorf("OpenPersistentMap(): Expected keys [a b], got %v", keys)
+			}
+			// the damaged tail is removed, so new records are not lost behind it.
+			r.Store("d", 4)
+			r.Close()
+			r = openPersistent(t, dir, internal.PersistentOptions[string, int]{})
+			defer r.Close()
+			if !r.Has("d") {
+				t.Errorf("OpenPersistentMap(): Expected key d to be recovered, got %v", sortedKeys(r))
+			}
+		})
+	}
+}
+
+func TestPersistentMapCorruptedRecord(t *testing.T) {
+	for _, damage := range []struct {
+		name string
+		f    func(data []byte, record int)
+	}{
+		{"corrupted body", func(data []byte, record int) { data[record-1] ^= 0xff }},
+		{"length past the end", func(data []byte, record int) { binary.BigEndian.PutUint32(data, 0xfffffff0) }},
+		{"length within the log", func(data []byte, record int) { binary.BigEndian.PutUint32(data, uint32(record)) }},
+		{"empty record", func(data []byte, record int) { binary.BigEndian.PutUint32(data, 0) }},
+	} {
+		t.Run(damage.name, func(t *testing.T) {
+			dir := t.TempDir()
+			m := openPersistent(t, dir, internal.PersistentOptions[string, int]{})
+			m.Store("a", 1)
+			m.Store("b", 2)
+			m.Store("c", 3)
+			m.Close()
+			wal := filepath.Join(dir, "wal")
+			data, err := os.ReadFile(wal)
+			if err != nil {
+				t.Fatalf("ReadFile(): Expected no error, got %v", err)
+			}
+			// damages the first record, the records following it are valid.
+			damage.f(data, len(data)/3)
+			if err := os.WriteFile(wal, data, 0o644); err != nil {
+				t.Fatalf("WriteFile(): Expected no error, got %v", err)
+			}
+			if _, err := internal.OpenPersistentMap(dir, internal.PersistentOptions[string, int]{}); !errors.Is(err, internal.ErrInvalidLog) {
+				t.Errorf("OpenPersistentMap(): Expected ErrInvalidLog for a corrupted record, got %v", err)
+			}
+			if after, err := os.ReadFile(wal); err != nil || !bytes.Equal(after, data) {
+				t.Errorf("OpenPersistentMap(): Expected the log to be left untouched, got %d bytes, %v", len(after), err)
+			}
+		})
+	}
+}
+
+func TestPersistentMapCompaction(t *testing.T) {
+	dir := t.TempDir()
+	opts := internal.PersistentOptions[string, int]{CompactSize: 512}
+	m := openPersistent(t, dir, opts)
+	for i := 0; i < 100; i++ {
+		m.Store("key", i)
+	}
+	m.Store("other", 1)
+	if _, err := os.Stat(filepath.Join(dir, "snapshot")); err != nil {
+		t.Errorf("Compact(): Expected snapshot to be written, got %v", err)
+	}
+	info, _ := os.Stat(filepath.Join(dir, "wal"))
+	if info.Size() >= 512 {
+		t.Errorf("Compact(): Expected log to be compacted, got %d bytes", info.Size())
+	}
+	m.Close()
+	r := openPersistent(t, dir, opts)
+	defer r.Close()
+	if v, _ := r.Load("key"); v != 99 || r.Len() != 2 {
+		t.Errorf("OpenPersistentMap(): Expected key to be 99, got %d", v)
+	}
+}
+
+func TestPersistentMapCompactionCrash(t *testing.T) {
+	dir := t.TempDir()
+	opts := internal.PersistentOptions[string, int]{CompactSize: -1}
+	m := openPersistent(t, dir, opts)
+	m.Store("a", 1)
+	m.Store("b", 2)
+	m.Delete("a")
+	wal := filepath.Join(dir, "wal")
+	log, _ := os.ReadFile(wal)
+	if err := m.Compact(); err != nil {
+		t.Fatalf("Compact(): Expected no error, got %v", err)
+	}
+	m.Close()
+	// simulates a crash after the snapshot was renamed and before the log was emptied.
+	os.WriteFile(wal, log, 0o644)
+	r := openPersistent(t, dir, opts)
+	defer r.Close()
+	if keys := sortedKeys(r); len(keys) != 1 || keys[0] != "b" {
+		t.Errorf("OpenPersistentMap(): Expected keys [b], got %v", keys)
+	}
+}
+
+func TestPersistentMapSyncPolicies(t *testing.T) {
+	for _, opts := range []internal.PersistentOptions[string, int]{
+		{Sync: internal.SyncAlways},
+		{Sync: internal.SyncBatch, BatchSize: 2},
+		{Sync: internal.SyncInterval, SyncInterval: time.Millisecond},
+	} {
+		dir := t.TempDir()
+		m := openPersistent(t, dir, opts)
+		for i := 0; i < 5; i++ {
+			m.Store("key", i)
+		}
+		time.Sleep(5 * time.Millisecond)
+		if err := m.Sync(); err != nil {
+			t.Errorf("Sync(): Expected no error, got %v", err)
+		}
+		if err := m.Close(); err != nil {
+			t.Errorf("Close(): Expected no error, got %v", err)
+		}
+		r := openPersistent(t, dir, opts)
+		if v, _ := r.Load("key"); v != 4 {
+			t.Errorf("OpenPersistentMap(): Expected value 4, got %d", v)
+		}
+		r.Close()
+	}
+}
+
+func TestPersistentMapJSONCodec(t *testing.T) {
+	dir := t.TempDir()
+	opts := internal.PersistentOptions[string, []string]{
+		KeyCodec:   internal.JSONCodec[string]{},
+		ValueCodec: internal.JSONCodec[[]string]{},
+	}
+	m, err := internal.OpenPersistentMap(dir, opts)
+	if err != nil {
+		t.Fatalf("OpenPersistentMap(): Expected no error, got %v", err)
+	}
+	m.Store("tags", []string{"a", "b"})
+	m.Close()
+	r, err := internal.OpenPersistentMap(dir, opts)
+	if err != nil {
+		t.Fatalf("OpenPersistentMap(): Expected no error, got %v", err)
+	}
+	defer r.Close()
+	if v, _ := r.Load("tags"); len(v) != 2 || v[1] != "b" {
+		t.Errorf("Load(): Expected [a b], got %v", v)
+	}
+}
+
+type failingCodec struct{}
+
+func (failingCodec) Marshal(v int) ([]byte, error)      { return nil, errors.New("marshal failed") }
+func (failingCodec) Unmarshal(data []byte) (int, error) { return 0, errors.New("unmarshal failed") }
+
+func TestPersistentMapErrors(t *testing.T) {
+	dir := t.TempDir()
+	m := openPersistent(t, dir, internal.PersistentOptions[string, int]{ValueCodec: failingCodec{}})
+	m.Store("a", 1)
+	if err := m.Err(); err == nil || err.Error() != "marshal failed" {
+		t.Errorf("Err(): Expected codec error, got %v", err)
+	}
+	if err := m.Close(); err == nil {
+		t.Errorf("Close(): Expected codec error")
+	}
+
+	m = openPersistent(t, t.TempDir(), internal.PersistentOptions[string, int]{})
+	m.Close()
+	m.Store("a", 1)
+	if !errors.Is(m.Err(), internal.ErrClosed) || !errors.Is(m.Sync(), internal.ErrClosed) {
+		t.Errorf("Err(): Expected ErrClosed, got %v", m.Err())
+	}
+	if m.Close() != nil {
+		t.Errorf("Close(): Expected no error on second call")
+	}
+
+	dir = t.TempDir()
+	m = openPersistent(t, dir, internal.PersistentOptions[string, int]{})
+	m.Store("a", 1)
+	m.Compact()
+	m.Close()
+	snapshot := filepath.Join(dir, "snapshot")
+	data, _ := os.ReadFile(snapshot)
+	os.WriteFile(snapshot, data[:len(data)-1], 0o644)
+	if _, err := internal.OpenPersistentMap(dir, internal.PersistentOptions[string, int]{}); !errors.Is(err, internal.ErrInvalidLog) {
+		t.Errorf("OpenPersistentMap(): Expected ErrInvalidLog for a corrupted snapshot, got %v", err)
+	}
+}
@@ -0,0 +1,333 @@
+package internal
+
+import (
+	"container/heap"
+	"container/list"
+	"math/rand/v2"
+)
+
+// LRUPolicy evicts the least recently used key.
+type LRUPolicy[K comparable] struct {
+	order *list.List // front is the most recently used key.
+	elems map[K]*list.Element
+}
+
+// NewLRUPolicy returns a new LRUPolicy.
+func NewLRUPolicy[K comparable]() *LRUPolicy[K] {
+	return &LRUPolicy[K]{order: list.New(), elems: make(map[K]*list.Element)}
+}
+
+// RecordAccess marks key as the most recently used.
+func (p *LRUPolicy[K]) RecordAccess(key K) {
+	if e, ok := p.elems[key]; ok {
+		p.order.MoveToFront(e)
+	}
+}
+
+// RecordInsert adds key as the most recently used.
+func (p *LRUPolicy[K]) RecordInsert(key K) {
+	if e, ok := p.elems[key]; ok {
+		p.order.MoveToFront(e)
+		return
+	}
+	p.elems[key] = p.order.PushFront(key)
+}
+
+// Victim returns the least recently used key.
+func (p *LRUPolicy[K]) Victim() (key K, ok bool) {
+	if e := p.order.Back(); e != nil {
+		return e.Value.(K), true
+	}
+	return key, false
+}
+
+// Remove forgets key.
+func (p *LRUPolicy[K]) Remove(key K) {
+	if e, ok := p.elems[key]; ok {
+		p.order.Remove(e)
+		delete(p.elems, key)
+	}
+}
+
+// FIFOPolicy evicts the oldest inserted key, accesses do not change the eviction order.
+type FIFOPolicy[K comparable] struct {
+	order *list.List // front is the oldest key.
+	elems map[K]*list.Element
+}
+
+// NewFIFOPolicy returns a new FIFOPolicy.
+func NewFIFOPolicy[K comparable]() *FIFOPolicy[K] {
+	return &FIFOPolicy[K]{order: list.New(), elems: make(map[K]*list.Element)}
+}
+
+// RecordAccess does nothing, accesses do not change the eviction order.
+func (p *FIFOPolicy[K]) RecordAccess(key K) {}
+
+// RecordInsert adds key as the newest key.
+func (p *FIFOPolicy[K]) RecordInsert(key K) {
+	if _, ok := p.elems[key]; !ok {
+		p.elems[key] = p.order.PushBack(key)
+	}
+}
+
+// Victim returns the oldest key.
+func (p *FIFOPolicy[K]) Victim() (key K, ok bool) {
+	if e := p.order.Front(); e != nil {
+		return e.Value.(K), true
+	}
+	return key, false
+}
+
+// Remove forgets key.
+func (p *FIFOPolicy[K]) Remove(key K) {
+	if e, ok := p.elems[key]; ok {
+		p.order.Remove(e)
+		delete(p.elems, key)
+	}
+}
+
+// RandomPolicy evicts a key chosen at random, it is the cheapest policy to maintain.
+type RandomPolicy[K comparable] struct {
+	keys  []K
+	index map[K]int
+}
+
+// NewRandomPolicy returns a new RandomPolicy.
+func NewRandomPolicy[K comparable]() *RandomPolicy[K] {
+	return &RandomPolicy[K]{index: make(map[K]int)}
+}
+
+// RecordAccess does nothing, accesses do not change the eviction order.
+func (p *RandomPolicy[K]) RecordAccess(key K) {}
+
+// RecordInsert adds key to the candidates.
+func (p *RandomPolicy[K]) RecordInsert(key K) {
+	if _, ok := p.index[key]; !ok {
+		p.index[key] = len(p.keys)
+		p.keys = append(p.keys, key)
+	}
+}
+
+// Victim returns a random key.
+func (p *RandomPolicy[K]) Victim() (key K, ok bool) {
+	if len(p.keys) == 0 {
+		return key, false
+	}
+	return p.keys[rand.IntN(len(p.keys))], true
+}
+
+// Remove forgets key.
+func (p *RandomPolicy[K]) Remove(key K) {
+	i, ok := p.index[key]
+	if !ok {
+		return
+	}
+	// moves the last key in place of the removed one.
+	last := len(p.keys) - 1
+	p.keys[i] = p.keys[last]
+	p.index[p.keys[i]] = i
+	var zero K
+	p.keys[last] = zero
+	p.keys = p.keys[:last]
+	delete(p.index, key)
+}
+
+// LFUPolicy evicts the least frequently used key, ties are broken evicting the least recently used key.
+type LFUPolicy[K comparable] struct {
+	items lfuHeap[K]
+	index map[K]*lfuItem[K]
+	tick  uint64
+}
+
+// lfuItem is a key tracked by LFUPolicy.
+type lfuItem[K comparable] struct {
+	key  K
+	freq uint64
+	tick uint64 // last use, used to break ties.
+	pos  int    // position in the heap.
+}
+
+// lfuHeap is a min-heap of items ordered by frequency and last use.
+type lfuHeap[K comparable] []*lfuItem[K]
+
+func (h lfuHeap[K]) Len() int { return len(h) }
+
+func (h lfuHeap[K]) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h lfuHeap[K]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos = i
+	h[j].pos = j
+}
+
+func (h *lfuHeap[K]) Push(x any) {
+	item := x.(*lfuItem[K])
+	item.pos = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *lfuHeap[K]) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// NewLFUPolicy returns a new LFUPolicy.
+func NewLFUPolicy[K comparable]() *LFUPolicy[K] {
+	return &LFUPolicy[K]{index: make(map[K]*lfuItem[K])}
+}
+
+// RecordAccess increments the use count of key.
+func (p *LFUPolicy[K]) RecordAccess(key K) {
+	if item, ok := p.index[key]; ok {
+		p.tick++
+		item.freq++
+		item.tick = p.tick
+		heap.Fix(&p.items, item.pos)
+	}
+}
+
+// RecordInsert adds key with a use count of one.
+func (p *LFUPolicy[K]) RecordInsert(key K) {
+	if _, ok := p.index[key]; ok {
+		p.RecordAccess(key)
+		return
+	}
+	p.tick++
+	item := &lfuItem[K]{key: key, freq: 1, tick: p.tick}
+	p.index[key] = item
+	heap.Push(&p.items, item)
+}
+
+// Victim returns the least frequently used key.
+func (p *LFUPolicy[K]) Victim() (key K, ok bool) {
+	if len(p.items) == 0 {
+		return key, false
+	}
+	return p.items[0].key, true
+}
+
+// Remove forgets key.
+func (p *LFUPolicy[K]) Remove(key K) {
+	if item, ok := p.index[key]; ok {
+		heap.Remove(&p.items, item.pos)
+		delete(p.index, key)
+	}
+}
+
+// ARCPolicy implements the Adaptive Replacement Cache policy, it balances between recency and frequency
+// and resists scans: keys used only once are evicted before keys used more than once.
+//
+// ARCPolicy remembers up to capacity recently evicted keys to adapt the balance, capacity should match the
+// capacity of the map using the policy.
+type ARCPolicy[K comparable] struct {
+	capacity int
+	p        int        // target size of t1.
+	t1, t2   *list.List // keys in the map seen once (t1) or more (t2), front is the most recently used.
+	b1, b2   *list.List // ghost keys recently evicted from t1 and t2.
+	elems    map[K]*list.Element
+	lists    map[K]*list.List
+}
+
+// NewARCPolicy returns a new ARCPolicy for a map holding at most capacity entries.
+// NewARCPolicy panics if capacity is less than 1.
+func NewARCPolicy[K comparable](capacity int) *ARCPolicy[K] {
+	if capacity < 1 {
+		panic("mutex: NewARCPolicy called with capacity less than 1")
+	}
+	return &ARCPolicy[K]{
+		capacity: capacity,
+		t1:       list.New(),
+		t2:       list.New(),
+		b1:       list.New(),
+		b2:       list.New(),
+		elems:    make(map[K]*list.Element),
+		lists:    make(map[K]*list.List),
+	}
+}
+
+// move moves key to the front of l.
+func (p *ARCPolicy[K]) move(key K, l *list.List) {
+	p.forget(key)
+	p.elems[key] = l.PushFront(key)
+	p.lists[key] = l
+}
+
+// forget removes key from the list holding it.
+func (p *ARCPolicy[K]) forget(key K) {
+	if l, ok := p.lists[key]; ok {
+		l.Remove(p.elems[key])
+		delete(p.elems, key)
+		delete(p.lists, key)
+	}
+}
+
+// RecordAccess moves key to the frequently used keys.
+func (p *ARCPolicy[K]) RecordAccess(key K) {
+	if l := p.lists[key]; l == p.t1 || l == p.t2 {
+		p.move(key, p.t2)
+	}
+}
+
+// RecordInsert adds key to the recently used keys, or to the frequently used keys if key was recently evicted.
+func (p *ARCPolicy[K]) RecordInsert(key K) {
+	switch p.lists[key] {
+	case p.t1, p.t2:
+		p.move(key, p.t2)
+		return
+	case p.b1:
+		// a key recently evicted from t1 is back, t1 should grow.
+		p.p = min(p.capacity, p.p+max(p.b2.Len()/p.b1.Len(), 1))
+		p.move(key, p.t2)
+	case p.b2:
+		// a key recently evicted from t2 is back, t2 should grow.
+		p.p = max(0, p.p-max(p.b1.Len()/p.b2.Len(), 1))
+		p.move(key, p.t2)
+	default:
+		p.move(key, p.t1)
+	}
+	// bounds the ghost lists.
+	for p.t1.Len()+p.b1.Len() > p.capacity && p.b1.Len() > 0 {
+		p.forget(p.b1.Back().Value.(K))
+	}
+	for p.t1.Len()+p.t2.Len()+p.b1.Len()+p.b2.Len() > 2*p.capacity && p.b2.Len() > 0 {
+		p.forget(p.b2.Back().Value.(K))
+	}
+}
+
+// Victim returns the least recently used key of the recently or of the frequently used keys, depending on the adaptive target.
+func (p *ARCPolicy[K]) Victim() (key K, ok bool) {
+	key, _, ok = p.victim()
+	return key, ok
+}
+
+// victim returns the key Victim returns and the ghost list it joins once evicted.
+func (p *ARCPolicy[K]) victim() (key K, ghosts *list.List, ok bool) {
+	switch {
+	case p.t1.Len() > 0 && (p.t1.Len() > p.p || p.t2.Len() == 0):
+		return p.t1.Back().Value.(K), p.b1, true
+	case p.t2.Len() > 0:
+		return p.t2.Back().Value.(K), p.b2, true
+	}
+	return key, nil, false
+}
+
+// Remove forgets key. The key returned by Victim is remembered as a ghost key, to adapt the balance if it is
+// inserted again, so a key deleted while it is the next victim is handled as evicted.
+func (p *ARCPolicy[K]) Remove(key K) {
+	if victim, ghosts, ok := p.victim(); ok && victim == key {
+		p.move(key, ghosts)
+		return
+	}
+	if l := p.lists[key]; l == p.t1 || l == p.t2 {
+		p.forget(key)
+	}
+}
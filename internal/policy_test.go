@@ -0,0 +1,120 @@
+package internal_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+// evictions stores keys in a map of the given capacity and returns the evicted keys in order.
+// A negative key is a Load of its absolute value.
+func evictions(policy internal.EvictionPolicy[int], capacity int, ops ...int) (evicted []int) {
+	m := internal.NewBoundedMap[int, int](capacity, policy)
+	m.OnEvict(func(key, value int) {
+		evicted = append(evicted, key)
+	})
+	for _, op := range ops {
+		if op < 0 {
+			m.Load(-op)
+			continue
+		}
+		m.Store(op, op)
+	}
+	return evicted
+}
+
+func TestLRUPolicy(t *testing.T) {
+	got := evictions(internal.NewLRUPolicy[int](), 3, 1, 2, 3, -1, 4, 5, -1, 6)
+	if want := []int{2, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LRU: Expected evictions %v, got %v", want, got)
+	}
+}
+
+func TestFIFOPolicy(t *testing.T) {
+	// loads do not change the eviction order.
+	got := evictions(internal.NewFIFOPolicy[int](), 3, 1, 2, 3, -1, 4, 5, -1, 6)
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FIFO: Expected evictions %v, got %v", want, got)
+	}
+}
+
+func TestLFUPolicy(t *testing.T) {
+	// 1 is used three times, 2 twice, ties are broken by recency.
+	got := evictions(internal.NewLFUPolicy[int](), 3, 1, 2, 3, -1, -1, -2, 4, 5, -3, 6)
+	if want := []int{3, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LFU: Expected evictions %v, got %v", want, got)
+	}
+}
+
+func TestRandomPolicy(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		got := evictions(internal.NewRandomPolicy[int](), 3, 1, 2, 3, 4)
+		if len(got) != 1 || got[0] < 1 || got[0] > 3 {
+			t.Fatalf("Random: Expected one of the existing keys to be evicted, got %v", got)
+		}
+	}
+	p := internal.NewRandomPolicy[int]()
+	p.RecordInsert(1)
+	p.RecordInsert(2)
+	p.RecordInsert(2)
+	p.Remove(1)
+	p.Remove(3)
+	if key, ok := p.Victim(); !ok || key != 2 {
+		t.Errorf("Random: Expected victim 2, got %d", key)
+	}
+	p.Remove(2)
+	if _, ok := p.Victim(); ok {
+		t.Errorf("Random: Expected no victim")
+	}
+}
+
+func TestARCPolicy(t *testing.T) {
+	// 1 and 2 are used twice, the scan of 4..8 only evicts keys used once.
+	got := evictions(internal.NewARCPolicy[int](3), 3, 1, 2, -1, -2, 3, 4, 5, 6, 7, 8)
+	if want := []int{3, 4, 5, 6, 7}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ARC: Expected evictions %v, got %v", want, got)
+	}
+	// for comparison LRU evicts the frequently used keys.
+	got = evictions(internal.NewLRUPolicy[int](), 3, 1, 2, -1, -2, 3, 4, 5, 6, 7, 8)
+	if want := []int{1, 2, 3, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LRU: Expected evictions %v, got %v", want, got)
+	}
+
+	// a key evicted from the recently used keys and stored again is promoted to the frequently used keys.
+	p := internal.NewARCPolicy[int](2)
+	p.RecordInsert(1)
+	p.RecordInsert(2)
+	// Victim has no side effect, the victim stays the same until it is removed.
+	for range 2 {
+		if key, _ := p.Victim(); key != 1 {
+			t.Errorf("ARC: Expected victim 1, got %d", key)
+		}
+	}
+	p.Remove(1)
+	p.RecordInsert(3)
+	p.RecordInsert(1)
+	if key, _ := p.Victim(); key != 2 {
+		t.Errorf("ARC: Expected victim 2, got %d", key)
+	}
+	p.Remove(2)
+	if key, _ := p.Victim(); key != 3 {
+		t.Errorf("ARC: Expected victim 3, got %d", key)
+	}
+	p.Remove(3)
+	// 1 is the only key left in the map.
+	if key, _ := p.Victim(); key != 1 {
+		t.Errorf("ARC: Expected victim 1, got %d", key)
+	}
+	p.Remove(1)
+	if _, ok := p.Victim(); ok {
+		t.Errorf("ARC: Expected no victim")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("NewARCPolicy(0): Expected panic")
+		}
+	}()
+	internal.NewARCPolicy[int](0)
+}
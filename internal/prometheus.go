@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Real is the constraint of the numeric types that can be exported as Prometheus samples.
+type Real interface {
+	uint | uint8 | uint16 | uint32 | uint64 | int | int8 | int16 | int32 | int64 | float32 | float64
+}
+
+// MetricType is the type of a metric, written in its TYPE line.
+type MetricType string
+
+const (
+	MetricCounter MetricType = "counter"
+	MetricGauge   MetricType = "gauge"
+)
+
+// ErrInvalidMetric is returned when registering a metric with an invalid name, type or label name,
+// or with a name already registered.
+var ErrInvalidMetric = errors.New("mutex: invalid metric")
+
+var (
+	metricName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelName  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Registry holds a set of metrics and writes them in the Prometheus text exposition format (version 0.0.4),
+// it is safe for concurrent use. The structures backing the metrics are read when the metrics are written,
+// one at a time. The zero Registry is empty and ready to use.
+type Registry struct {
+	mu      sync.RWMutex
+	metrics map[string]*metric
+}
+
+// metric is a registered metric, collect yields its samples with their label value.
+type metric struct {
+	name, help string
+	typ        MetricType
+	label      string // name of the label holding the map keys, empty for a single sample.
+	collect    func() []sample
+}
+
+// sample is a value of a metric, label is its label value.
+type sample struct {
+	label, value string
+}
+
+// loader is a structure holding a single value, such as a Numeric.
+type loader[V any] interface {
+	Load() (V, bool)
+}
+
+// entries is a structure holding key-value pairs, such as a Map.
+type entries[K comparable, V any] interface {
+	Entries() (keys []K, values []V)
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// RegisterNumeric registers n as the metric name of type typ, its value is exported as a single sample,
+// 0 if it is not set.
+func RegisterNumeric[V Real](r *Registry, name, help string, typ MetricType, n loader[V]) error {
+	return r.register(&metric{name: name, help: help, typ: typ, collect: func() []sample {
+		v, _ := n.Load()
+		return []sample{{value: formatSample(v)}}
+	}})
+}
+
+// RegisterMap registers m as the metric name of type typ, every entry of m is exported as a sample with
+// a label named label holding the key, formatted with fmt.Sprint. Samples are written in label value order.
+func RegisterMap[K comparable, V Real](r *Registry, name, help string, typ MetricType, label string, m entries[K, V]) error {
+	if !labelName.MatchString(label) || strings.HasPrefix(label, "__") {
+		return fmt.Errorf("%w: invalid label name %q", ErrInvalidMetric, label)
+	}
+	return r.register(&metric{name: name, help: help, typ: typ, label: label, collect: func() []sample {
+		keys, values := m.Entries()
+		samples := make([]sample, len(keys))
+		for i := range keys {
+			samples[i] = sample{label: fmt.Sprint(keys[i]), value: formatSample(values[i])}
+		}
+		slices.SortFunc(samples, func(a, b sample) int { return cmp.Compare(a.label, b.label) })
+		return samples
+	}})
+}
+
+// register adds m to the registry.
+func (r *Registry) register(m *metric) error {
+	if !metricName.MatchString(m.name) {
+		return fmt.Errorf("%w: invalid name %q", ErrInvalidMetric, m.name)
+	}
+	if m.typ != MetricCounter && m.typ != MetricGauge {
+		return fmt.Errorf("%w: invalid type %q", ErrInvalidMetric, m.typ)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[m.name]; ok {
+		return fmt.Errorf("%w: %q already registered", ErrInvalidMetric, m.name)
+	}
+	if r.metrics == nil {
+		r.metrics = make(map[string]*metric)
+	}
+	r.metrics[m.name] = m
+	return nil
+}
+
+// Unregister removes the metric name, it returns false if name is not registered.
+func (r *Registry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.metrics[name]
+	delete(r.metrics, name)
+	return ok
+}
+
+// WriteTo writes the metrics to w in the Prometheus text exposition format, in name order.
+func (r *Registry) WriteTo(w io.Writer) (n int64, err error) {
+	r.mu.RLock()
+	metrics := make([]*metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		metrics = append(metrics, m)
+	}
+	r.mu.RUnlock()
+	slices.SortFunc(metrics, func(a, b *metric) int { return cmp.Compare(a.name, b.name) })
+
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		if m.help != "" {
+			fmt.Fprintf(&buf, "# HELP %s %s\n", m.name, helpEscaper.Replace(m.help))
+		}
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", m.name, m.typ)
+		for _, s := range m.collect() {
+			if m.label == "" {
+				fmt.Fprintf(&buf, "%s %s\n", m.name, s.value)
+			} else {
+				fmt.Fprintf(&buf, "%s{%s=\"%s\"} %s\n", m.name, m.label, labelEscaper.Replace(s.label), s.value)
+			}
+		}
+	}
+	return buf.WriteTo(w)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format, Registry can be used as a scrape endpoint.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// formatSample formats v as a Prometheus sample value, integers are written exactly.
+func formatSample[V Real](v V) string {
+	switch v := any(v).(type) {
+	case float32:
+		return formatFloat(float64(v), 32)
+	case float64:
+		return formatFloat(v, 64)
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	}
+	return strconv.FormatInt(int64(v), 10)
+}
+
+// formatFloat formats f, holding a float of the given bit size, as a Prometheus sample value.
+func formatFloat(f float64, bits int) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, bits)
+}
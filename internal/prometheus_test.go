@@ -0,0 +1,125 @@
+package internal_test
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// golden compares got with the content of testdata/name, or writes it with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := "testdata/" + name
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(expected) {
+		t.Errorf("Expected the content of %s, got:\n%s", path, got)
+	}
+}
+
+func newTestRegistry(t *testing.T) *internal.Registry {
+	t.Helper()
+	r := internal.NewRegistry()
+	requests := internal.NewNumeric[uint64]()
+	requests.Add(math.MaxUint64)
+	temperature := internal.NewMap(map[string]float64{
+		"kitchen":      21.5,
+		"living room":  19,
+		`quote " here`: -4.25,
+		"new\nline":    math.Inf(1),
+	})
+	inflight := internal.NewNumeric[int32]()
+	sharded := internal.NewShardedMap[int, float32](4, intHash)
+	sharded.Store(2, 0.1)
+	sharded.Store(10, 2)
+	for _, err := range []error{
+		internal.RegisterNumeric(r, "http_requests_total", "Requests served.", internal.MetricCounter, requests),
+		internal.RegisterNumeric(r, "http_inflight_requests", "", internal.MetricGauge, inflight),
+		internal.RegisterMap(r, "room_temperature_celsius", "Temperature\\per room,\nin celsius.", internal.MetricGauge, "room", temperature),
+		internal.RegisterMap(r, "shard_load", "Load per shard.", internal.MetricGauge, "shard", sharded),
+		internal.RegisterMap(r, "empty", "No samples.", internal.MetricGauge, "key", internal.NewMap[string, int](nil)),
+	} {
+		if err != nil {
+			t.Fatalf("Register(): Expected no error, got %v", err)
+		}
+	}
+	return r
+}
+
+func TestRegistryHandler(t *testing.T) {
+	srv := httptest.NewServer(newTestRegistry(t))
+	defer srv.Close()
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Expected the text exposition format content type, got %s", ct)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "metrics.prom", body)
+}
+
+func TestRegistryWriteTo(t *testing.T) {
+	r := newTestRegistry(t)
+	if !r.Unregister("empty") || r.Unregister("empty") {
+		t.Errorf("Unregister(): Expected to remove the metric once")
+	}
+	var buf strings.Builder
+	n, err := r.WriteTo(&buf)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("WriteTo(): Expected %d bytes, got %d, %v", buf.Len(), n, err)
+	}
+	if strings.Contains(buf.String(), "empty") {
+		t.Errorf("WriteTo(): Expected unregistered metrics not to be written, got:\n%s", buf.String())
+	}
+
+	var zero internal.Registry
+	if err := internal.RegisterNumeric(&zero, "zero", "", internal.MetricGauge, internal.NewNumeric[int]()); err != nil {
+		t.Errorf("RegisterNumeric(): Expected the zero Registry to be usable, got %v", err)
+	}
+	buf.Reset()
+	zero.WriteTo(&buf)
+	if buf.String() != "# TYPE zero gauge\nzero 0\n" {
+		t.Errorf("WriteTo(): Expected a single sample, got:\n%s", buf.String())
+	}
+}
+
+func TestRegistryInvalid(t *testing.T) {
+	r := internal.NewRegistry()
+	n := internal.NewNumeric[int]()
+	m := internal.NewMap[string, int](nil)
+	for name, err := range map[string]error{
+		"name":      internal.RegisterNumeric(r, "0requests", "", internal.MetricCounter, n),
+		"dash":      internal.RegisterNumeric(r, "http-requests", "", internal.MetricCounter, n),
+		"type":      internal.RegisterNumeric(r, "requests", "", "histogram", n),
+		"label":     internal.RegisterMap(r, "requests", "", internal.MetricCounter, "a:b", m),
+		"reserved":  internal.RegisterMap(r, "requests", "", internal.MetricCounter, "__name__", m),
+		"duplicate": errors.Join(internal.RegisterNumeric(r, "requests", "", internal.MetricCounter, n), internal.RegisterMap(r, "requests", "", internal.MetricGauge, "key", m)),
+	} {
+		if !errors.Is(err, internal.ErrInvalidMetric) {
+			t.Errorf("%s: Expected ErrInvalidMetric, got %v", name, err)
+		}
+	}
+}
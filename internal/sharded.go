@@ -0,0 +1,386 @@
+package internal
+
+import (
+	"context"
+	"iter"
+	"sync/atomic"
+)
+
+// ShardedMap implements a thread-safe map that splits its keys across a fixed number of independently locked Map shards.
+//
+// Operations on a single key only lock the shard owning that key, operations spanning the whole map
+// (Len, Keys, Values, Entries, Clear, UpdateRange and Exclusive) lock every shard, always in the same order,
+// and therefore observe or modify a consistent state of the map.
+type ShardedMap[K comparable, V any] struct {
+	_      noCopy // go vet to alert when copying by value.
+	hash   func(K) uint64
+	shards []*Map[K, V]
+	watch  *watchHub[K, V] // shared by all the shards.
+	id     atomic.Uint64   // assigned by the first call to Atomically.
+}
+
+// NewShardedMap returns a new ShardedMap with n shards, keys are assigned to a shard using hash.
+// If n is less than 1 a single shard is used. NewShardedMap panics if hash is nil.
+func NewShardedMap[K comparable, V any](n int, hash func(K) uint64, opts ...Option[V]) *ShardedMap[K, V] {
+	if hash == nil {
+		panic("mutex: NewShardedMap called with nil hash function")
+	}
+	if n < 1 {
+		n = 1
+	}
+	watch := newWatchHub[K, V]()
+	shards := make([]*Map[K, V], n)
+	for i := range shards {
+		shards[i] = NewMap[K, V](nil, opts...)
+		shards[i].watch = watch
+	}
+	return &ShardedMap[K, V]{hash: hash, shards: shards, watch: watch}
+}
+
+// shard returns the shard owning key.
+func (s *ShardedMap[K, V]) shard(key K) *Map[K, V] {
+	return s.shards[s.hash(key)%uint64(len(s.shards))]
+}
+
+// lock locks all the shards for writing, in order.
+func (s *ShardedMap[K, V]) lock() {
+	for _, shard := range s.shards {
+		shard.lock()
+	}
+}
+
+// unlock unlocks all the shards locked by lock.
+func (s *ShardedMap[K, V]) unlock() {
+	for i := len(s.shards) - 1; i >= 0; i-- {
+		s.shards[i].unlock()
+	}
+}
+
+// lockContext locks all the shards for writing, in order, giving up once ctx is done.
+// If an error is returned no shard is locked.
+func (s *ShardedMap[K, V]) lockContext(ctx context.Context) error {
+	for i, shard := range s.shards {
+		if err := shard.lockContext(ctx); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				s.shards[j].unlock()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// rlock locks all the shards for reading, in order. The returned time, passed to runlock, is the time the last
+// shard was locked: the read hold time recorded by the shards locked earlier does not include their wait for the next shards.
+func (s *ShardedMap[K, V]) rlock() (held int64) {
+	for _, shard := range s.shards {
+		held = shard.rlock()
+	}
+	return held
+}
+
+// runlock unlocks all the shards locked by rlock at held.
+func (s *ShardedMap[K, V]) runlock(held int64) {
+	for i := len(s.shards) - 1; i >= 0; i-- {
+		s.shards[i].runlock(held)
+	}
+}
+
+// merged returns a map holding the entries of every shard, the caller must hold the lock of every shard.
+func (s *ShardedMap[K, V]) merged() map[K]V {
+	data := make(map[K]V, s.len())
+	for _, shard := range s.shards {
+		for key, value := range shard.data {
+			data[key] = value
+		}
+	}
+	return data
+}
+
+// replace replaces the content of every shard with data and emits the changes, the caller must hold the write lock of every shard.
+func (s *ShardedMap[K, V]) replace(data map[K]V) {
+	parts := make(map[*Map[K, V]]map[K]V, len(s.shards))
+	for key, value := range data {
+		shard := s.shard(key)
+		if parts[shard] == nil {
+			parts[shard] = make(map[K]V)
+		}
+		parts[shard][key] = value
+	}
+	for _, shard := range s.shards {
+		shard.replace(parts[shard])
+	}
+}
+
+// Load returns the value stored in the map for a key, or nil if no
+// value is present.
+// The ok result indicates whether value was found in the map.
+func (s *ShardedMap[K, V]) Load(key K) (v V, ok bool) {
+	return s.shard(key).Load(key)
+}
+
+// Store sets the value for a key.
+func (s *ShardedMap[K, V]) Store(key K, value V) {
+	s.shard(key).Store(key, value)
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+func (s *ShardedMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	return s.shard(key).LoadOrStore(key, value)
+}
+
+// LoadAndDelete deletes the value for a key, returning the previous value if any.
+// The loaded result reports whether the key was present.
+func (s *ShardedMap[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	return s.shard(key).LoadAndDelete(key)
+}
+
+// Delete removes the key from the map.
+func (s *ShardedMap[K, V]) Delete(key K) {
+	s.shard(key).Delete(key)
+}
+
+// Swap swaps the value for a key and returns the previous value if any.
+// The loaded result reports whether the key was present.
+func (s *ShardedMap[K, V]) Swap(key K, value V) (previous V, loaded bool) {
+	return s.shard(key).Swap(key, value)
+}
+
+// CompareAndSwap swaps the old and new values for key
+// if the value stored in the map is equal to old.
+//
+// Values are compared with the Equal option, see Options.
+func (s *ShardedMap[K, V]) CompareAndSwap(key K, old, new V) bool {
+	return s.shard(key).CompareAndSwap(key, old, new)
+}
+
+// CompareAndDelete deletes the entry for key if its value is equal to old.
+//
+// Values are compared with the Equal option, see Options.
+func (s *ShardedMap[K, V]) CompareAndDelete(key K, old V) (deleted bool) {
+	return s.shard(key).CompareAndDelete(key, old)
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, Range stops the iteration.
+// Shards are visited one at a time, each shard is read locked only while a snapshot of its entries is taken,
+// so f may call any method on s.
+func (s *ShardedMap[K, V]) Range(f func(K, V) bool) {
+	next := true
+	for _, shard := range s.shards {
+		shard.Range(func(key K, value V) bool {
+			next = f(key, value)
+			return next
+		})
+		if !next {
+			return
+		}
+	}
+}
+
+// Clear removes all items from the map, all shards are cleared atomically.
+func (s *ShardedMap[K, V]) Clear() {
+	s.lock()
+	defer s.unlock()
+	for _, shard := range s.shards {
+		shard.clear()
+	}
+}
+
+// Has returns true if the map contains the key.
+func (s *ShardedMap[K, V]) Has(key K) bool {
+	return s.shard(key).Has(key)
+}
+
+// Update allows the caller to change the value associated with the key atomically guaranteeing that the value would not be changed by another goroutine during the operation.
+// Only the shard owning key is locked.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (s *ShardedMap[K, V]) Update(key K, f func(V, bool) V) {
+	s.shard(key).Update(key, f)
+}
+
+// UpdateRange locks all the shards for the duration of the iteration and allows for the modification of the values.
+// If f returns false, UpdateRange stops the iteration, without updating the corresponding value in the map.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (s *ShardedMap[K, V]) UpdateRange(f func(K, V) (V, bool)) {
+	s.lock()
+	defer s.unlock()
+	for _, shard := range s.shards {
+		for key, value := range shard.data {
+			newValue, ok := f(key, value)
+			if !ok {
+				return
+			}
+			shard.set(OpUpdateRange, key, newValue)
+		}
+	}
+}
+
+// Exclusive locks all the shards and passes f a map holding the entries of every shard.
+// Once f returns the changes made by f are applied to the shards, before any shard is unlocked.
+//
+// Exclusive copies every entry before and after f runs, prefer Update for single key operations.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (s *ShardedMap[K, V]) Exclusive(f func(m map[K]V)) {
+	s.lock()
+	defer s.unlock()
+	s.exclusive(f)
+}
+
+// exclusive implements Exclusive, the caller must hold the write lock of every shard.
+func (s *ShardedMap[K, V]) exclusive(f func(m map[K]V)) {
+	data := s.merged()
+	f(data)
+	for _, shard := range s.shards {
+		for key := range shard.data {
+			if _, ok := data[key]; !ok {
+				shard.del(OpExclusive, key)
+			}
+		}
+	}
+	for key, value := range data {
+		shard := s.shard(key)
+		if old, ok := shard.data[key]; ok && shard.observed() && shard.equal(old, value) {
+			continue
+		}
+		shard.set(OpExclusive, key, value)
+	}
+}
+
+// Transaction runs f with a Tx buffering its changes, the changes are applied atomically if f returns nil
+// and discarded if f returns an error or panics. All the shards are write locked for the duration of the transaction.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock, use tx instead.
+func (s *ShardedMap[K, V]) Transaction(f func(tx Tx[K, V]) error) error {
+	s.lock()
+	defer s.unlock()
+	return transaction(s.shard, f)
+}
+
+// Len returns the number of items in the map, all shards are read locked while counting.
+func (s *ShardedMap[K, V]) Len() (n int) {
+	defer s.runlock(s.rlock())
+	return s.len()
+}
+
+// Keys returns a slice of all the keys present in the map, an empty slice is returned if the map is empty.
+// All shards are read locked while collecting the keys.
+func (s *ShardedMap[K, V]) Keys() (keys []K) {
+	defer s.runlock(s.rlock())
+	keys = make([]K, 0, s.len())
+	for _, shard := range s.shards {
+		for key := range shard.data {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Values returns a slice of all the values present in the map, an empty slice is returned if the map is empty.
+// All shards are read locked while collecting the values.
+func (s *ShardedMap[K, V]) Values() (values []V) {
+	defer s.runlock(s.rlock())
+	values = make([]V, 0, s.len())
+	for _, shard := range s.shards {
+		for _, value := range shard.data {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Entries returns two slices, one containing all the keys and the other containing all the values present in the map.
+// All shards are read locked while collecting the entries.
+func (s *ShardedMap[K, V]) Entries() (keys []K, values []V) {
+	defer s.runlock(s.rlock())
+	n := s.len()
+	keys = make([]K, 0, n)
+	values = make([]V, 0, n)
+	for _, shard := range s.shards {
+		for key, value := range shard.data {
+			keys = append(keys, key)
+			values = append(values, value)
+		}
+	}
+	return keys, values
+}
+
+// len returns the number of items in all shards, the caller must hold the shards locks.
+func (s *ShardedMap[K, V]) len() (n int) {
+	for _, shard := range s.shards {
+		n += len(shard.data)
+	}
+	return n
+}
+
+// All returns an iterator over the key-value pairs in the map.
+// Shards are visited one at a time, each shard is read locked only while it is being iterated.
+//
+// ! Do not invoke any Map functions within the loop body to prevent a deadlock.
+func (s *ShardedMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for _, shard := range s.shards {
+			for key, value := range shard.All() {
+				if !yield(key, value) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// KeysSeq returns an iterator over the keys in the map.
+// Shards are visited one at a time, each shard is read locked only while it is being iterated.
+//
+// ! Do not invoke any Map functions within the loop body to prevent a deadlock.
+func (s *ShardedMap[K, V]) KeysSeq() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for _, shard := range s.shards {
+			for key := range shard.KeysSeq() {
+				if !yield(key) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// ValuesSeq returns an iterator over the values in the map.
+// Shards are visited one at a time, each shard is read locked only while it is being iterated.
+//
+// ! Do not invoke any Map functions within the loop body to prevent a deadlock.
+func (s *ShardedMap[K, V]) ValuesSeq() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, shard := range s.shards {
+			for value := range shard.ValuesSeq() {
+				if !yield(value) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Watch returns a channel receiving an Event every time key is changed.
+// The subscription is removed and the channel closed once ctx is done, ctx must be cancelled to release it.
+func (s *ShardedMap[K, V]) Watch(ctx context.Context, key K, opts ...WatchOption) <-chan Event[K, V] {
+	return watch(s.watch, ctx, key, false, event[K, V], opts)
+}
+
+// WatchAll returns a channel receiving an Event every time any key is changed.
+// Events of keys owned by different shards are not ordered.
+// The subscription is removed and the channel closed once ctx is done, ctx must be cancelled to release it.
+func (s *ShardedMap[K, V]) WatchAll(ctx context.Context, opts ...WatchOption) <-chan Event[K, V] {
+	var zero K
+	return watch(s.watch, ctx, zero, true, event[K, V], opts)
+}
+
+// hub returns the watch hub shared by all the shards.
+func (s *ShardedMap[K, V]) hub() *watchHub[K, V] {
+	return s.watch
+}
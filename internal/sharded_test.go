@@ -0,0 +1,251 @@
+package internal_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+func intHash(k int) uint64 { return uint64(k) }
+
+func TestNewShardedMap(t *testing.T) {
+	m := internal.NewShardedMap[int, int](0, intHash)
+	if m.Len() != 0 {
+		t.Errorf("Len(): Expected a new map, got map with length %d", m.Len())
+	}
+	m.Store(1, 1)
+	if v, ok := m.Load(1); !ok || v != 1 {
+		t.Errorf("Load(): Expected value 1, got value %d", v)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("NewShardedMap(): Expected panic with nil hash")
+		}
+	}()
+	internal.NewShardedMap[int, int](4, nil)
+}
+
+func TestShardedMapSingleKey(t *testing.T) {
+	m := internal.NewShardedMap[int, int](4, intHash)
+	if _, loaded := m.LoadOrStore(1, 42); loaded {
+		t.Errorf("LoadOrStore(): Expected key 1 to be stored")
+	}
+	if actual, loaded := m.LoadOrStore(1, 43); !loaded || actual != 42 {
+		t.Errorf("LoadOrStore(): Expected value 42 to be loaded, got %d", actual)
+	}
+	if previous, loaded := m.Swap(1, 43); !loaded || previous != 42 {
+		t.Errorf("Swap(): Expected previous value 42, got %d", previous)
+	}
+	if !m.CompareAndSwap(1, 43, 44) {
+		t.Errorf("CompareAndSwap(): Expected key 1 to be swapped")
+	}
+	if m.CompareAndDelete(1, 43) {
+		t.Errorf("CompareAndDelete(): Expected key 1 not to be deleted")
+	}
+	if !m.CompareAndDelete(1, 44) {
+		t.Errorf("CompareAndDelete(): Expected key 1 to be deleted")
+	}
+	if m.Has(1) {
+		t.Errorf("Has(): Expected key 1 to be absent")
+	}
+	m.Store(2, 2)
+	if v, loaded := m.LoadAndDelete(2); !loaded || v != 2 {
+		t.Errorf("LoadAndDelete(): Expected value 2, got %d", v)
+	}
+	m.Store(3, 3)
+	m.Delete(3)
+	if _, ok := m.Load(3); ok {
+		t.Errorf("Load(): Expected key 3 to be deleted")
+	}
+	m.Update(4, func(v int, ok bool) int {
+		if ok {
+			t.Errorf("Update(): Expected key 4 to be absent")
+		}
+		return 4
+	})
+	if v, ok := m.Load(4); !ok || v != 4 {
+		t.Errorf("Load(): Expected value 4, got %d", v)
+	}
+}
+
+func TestShardedMapAllShards(t *testing.T) {
+	m := internal.NewShardedMap[int, int](8, intHash)
+	for i := 0; i < 100; i++ {
+		m.Store(i, i)
+	}
+	if m.Len() != 100 {
+		t.Errorf("Len(): Expected length 100, got %d", m.Len())
+	}
+
+	sumKeys, sumValues := 0, 0
+	for _, key := range m.Keys() {
+		sumKeys += key
+	}
+	for _, value := range m.Values() {
+		sumValues += value
+	}
+	if sumKeys != 4950 || sumValues != 4950 {
+		t.Errorf("Keys(), Values(): Expected sum 4950, got %d and %d", sumKeys, sumValues)
+	}
+	keys, values := m.Entries()
+	for i := range keys {
+		if keys[i] != values[i] {
+			t.Errorf("Entries(): Expected key %d to match value %d", keys[i], values[i])
+		}
+	}
+
+	count := 0
+	m.Range(func(k, v int) bool {
+		count++
+		return count < 10
+	})
+	if count != 10 {
+		t.Errorf("Range(): Expected 10 calls, got %d", count)
+	}
+
+	m.UpdateRange(func(k, v int) (int, bool) {
+		return v + 1, true
+	})
+	if v, _ := m.Load(99); v != 100 {
+		t.Errorf("UpdateRange(): Expected value 100, got %d", v)
+	}
+	count = 0
+	m.UpdateRange(func(k, v int) (int, bool) {
+		count++
+		return 0, false
+	})
+	if count != 1 {
+		t.Errorf("UpdateRange(): Expected 1 call, got %d", count)
+	}
+
+	m.Exclusive(func(data map[int]int) {
+		if len(data) != 100 {
+			t.Errorf("Exclusive(): Expected 100 entries, got %d", len(data))
+		}
+		for k := range data {
+			if k%2 == 0 {
+				delete(data, k)
+			}
+		}
+		data[1000] = 1000
+	})
+	if m.Len() != 51 {
+		t.Errorf("Len(): Expected length 51, got %d", m.Len())
+	}
+	if v, ok := m.Load(1000); !ok || v != 1000 {
+		t.Errorf("Load(): Expected key 1000 to be moved to its shard, got %d", v)
+	}
+
+	m.Clear()
+	if m.Len() != 0 || len(m.Keys()) != 0 {
+		t.Errorf("Clear(): Expected empty map, got length %d", m.Len())
+	}
+	keys, values = m.Entries()
+	if len(keys) != 0 || len(values) != 0 {
+		t.Errorf("Entries(): Expected empty slices")
+	}
+}
+
+func TestShardedMapIterators(t *testing.T) {
+	m := internal.NewShardedMap[int, int](4, intHash)
+	for i := 0; i < 100; i++ {
+		m.Store(i, i)
+	}
+
+	sumKeys, sumValues, count := 0, 0, 0
+	for key, value := range m.All() {
+		sumKeys += key
+		sumValues += value
+	}
+	for key := range m.KeysSeq() {
+		sumKeys += key
+	}
+	for value := range m.ValuesSeq() {
+		sumValues += value
+	}
+	if sumKeys != 9900 || sumValues != 9900 {
+		t.Errorf("All(), KeysSeq(), ValuesSeq(): Expected sum 9900, got %d and %d", sumKeys, sumValues)
+	}
+
+	for range m.All() {
+		if count++; count == 10 {
+			break
+		}
+	}
+	for range m.KeysSeq() {
+		break
+	}
+	for range m.ValuesSeq() {
+		break
+	}
+	if count != 10 {
+		t.Errorf("All(): Expected 10 iterations, got %d", count)
+	}
+	m.Clear()
+	if m.Len() != 0 {
+		t.Errorf("Len(): Expected length 0, got %d", m.Len())
+	}
+}
+
+func TestShardedMapRangeReentrant(t *testing.T) {
+	m := internal.NewShardedMap[int, int](4, intHash)
+	for i := 0; i < 10; i++ {
+		m.Store(i, i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Range(func(key, value int) bool {
+			m.Store(key, value+1)
+			m.Len()
+			return true
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Range(): Expected f to be able to call Store and Len")
+	}
+	if v, _ := m.Load(9); v != 10 {
+		t.Errorf("Load(): Expected value 10, got %d", v)
+	}
+}
+
+func TestShardedMapConcurrentAccess(t *testing.T) {
+	m := internal.NewShardedMap[int, int](16, intHash)
+	numGoroutines := 100
+	for i := 0; i < numGoroutines; i++ {
+		m.Store(i, 0)
+	}
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	ctx, cancel := context.WithCancel(context.Background())
+	for i := 0; i < numGoroutines; i++ {
+		go func(i int) {
+			defer wg.Done()
+			// uses context done to have all goroutines start at the same time
+			<-ctx.Done()
+			for j := 0; j < numGoroutines; j++ {
+				m.Update(j, func(v int, ok bool) int {
+					return v + 1
+				})
+				if j%10 == 0 {
+					m.Len()
+				}
+			}
+		}(i)
+	}
+	cancel()
+	wg.Wait()
+	m.Range(func(k, v int) bool {
+		if v != numGoroutines {
+			t.Errorf("Expected value %d, got %d", numGoroutines, v)
+		}
+		return true
+	})
+}
@@ -0,0 +1,290 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"maps"
+	"math"
+)
+
+// A snapshot is made of a fixed size header, a gob encoded payload and a checksum:
+//
+//	magic    [4]byte  "MTXS"
+//	version  uint8    snapshotVersion
+//	kind     uint8    snapshotMap, snapshotOrdered or snapshotValue
+//	count    uint64   number of entries, 0 or 1 for a Value
+//	size     uint64   length of the payload in bytes
+//	payload  [size]byte
+//	checksum uint32   CRC-32 (IEEE) of the header and the payload
+//
+// Integers are big endian. The payload holds a map[K]V for a map, an orderedPayload for an OrderedMap and a V for a set Value,
+// it is empty for an unset Value.
+const (
+	snapshotMagic   = "MTXS"
+	snapshotVersion = 1
+	snapshotMap     = 'M'
+	snapshotOrdered = 'O'
+	snapshotValue   = 'V'
+	snapshotHeader  = 4 + 1 + 1 + 8 + 8
+)
+
+// ErrInvalidSnapshot is returned when reading a snapshot that is truncated, corrupted or of the wrong kind.
+var ErrInvalidSnapshot = errors.New("mutex: invalid snapshot")
+
+// writeSnapshot writes a snapshot holding count entries encoded from payload, payload is ignored if count is zero.
+func writeSnapshot(w io.Writer, kind byte, count int, payload any) (int64, error) {
+	var body bytes.Buffer
+	if count > 0 {
+		if err := gob.NewEncoder(&body).Encode(payload); err != nil {
+			return 0, err
+		}
+	}
+	buf := make([]byte, snapshotHeader, snapshotHeader+body.Len()+4)
+	copy(buf, snapshotMagic)
+	buf[4] = snapshotVersion
+	buf[5] = kind
+	binary.BigEndian.PutUint64(buf[6:], uint64(count))
+	binary.BigEndian.PutUint64(buf[14:], uint64(body.Len()))
+	buf = append(buf, body.Bytes()...)
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// readSnapshot reads a snapshot of the given kind and returns the number of entries and the payload.
+// The checksum is verified before the payload is returned.
+func readSnapshot(r io.Reader, kind byte) (n int64, count uint64, payload []byte, err error) {
+	header := make([]byte, snapshotHeader)
+	read, err := io.ReadFull(r, header)
+	n += int64(read)
+	if err != nil {
+		return n, 0, nil, truncated(err)
+	}
+	if string(header[:4]) != snapshotMagic {
+		return n, 0, nil, fmt.Errorf("%w: bad magic number", ErrInvalidSnapshot)
+	}
+	if header[4] != snapshotVersion {
+		return n, 0, nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, header[4])
+	}
+	if header[5] != kind {
+		return n, 0, nil, fmt.Errorf("%w: expected kind %q, got %q", ErrInvalidSnapshot, kind, header[5])
+	}
+	count = binary.BigEndian.Uint64(header[6:])
+	size := binary.BigEndian.Uint64(header[14:])
+	if size > math.MaxInt64-4 {
+		return n, 0, nil, fmt.Errorf("%w: bad payload size", ErrInvalidSnapshot)
+	}
+	// the payload is copied as it arrives, a corrupted size cannot cause a large allocation.
+	var body bytes.Buffer
+	copied, err := io.CopyN(&body, r, int64(size)+4)
+	n += copied
+	if err != nil {
+		return n, 0, nil, truncated(err)
+	}
+	data := body.Bytes()
+	payload, sum := data[:size], binary.BigEndian.Uint32(data[size:])
+	crc := crc32.NewIEEE()
+	crc.Write(header)
+	crc.Write(payload)
+	if crc.Sum32() != sum {
+		return n, 0, nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidSnapshot)
+	}
+	return n, count, payload, nil
+}
+
+// truncated wraps the error returned when a snapshot ends early.
+func truncated(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("%w: truncated: %w", ErrInvalidSnapshot, err)
+}
+
+// readMapSnapshot reads a map snapshot and decodes its entries.
+func readMapSnapshot[K comparable, V any](r io.Reader) (int64, map[K]V, error) {
+	n, count, payload, err := readSnapshot(r, snapshotMap)
+	if err != nil {
+		return n, nil, err
+	}
+	data := make(map[K]V)
+	if count > 0 {
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&data); err != nil {
+			return n, nil, fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+		}
+	}
+	if uint64(len(data)) != count {
+		return n, nil, fmt.Errorf("%w: expected %d entries, got %d", ErrInvalidSnapshot, count, len(data))
+	}
+	return n, data, nil
+}
+
+// WriteTo writes a binary snapshot of the map to w, keys and values are encoded with encoding/gob.
+// The map is read locked only while its entries are copied, the copy is encoded once the lock is released.
+func (m *Map[K, V]) WriteTo(w io.Writer) (n int64, err error) {
+	held := m.rlock()
+	data := maps.Clone(m.data)
+	m.runlock(held)
+	return writeSnapshot(w, snapshotMap, len(data), data)
+}
+
+// ReadFrom replaces the content of the map with the snapshot read from r, written by WriteTo.
+// The snapshot is fully read and verified before the map is locked, the map is left unchanged if an error is returned.
+// Replaced keys are reported to the subscribers as Store events, removed keys as Delete events.
+func (m *Map[K, V]) ReadFrom(r io.Reader) (n int64, err error) {
+	n, data, err := readMapSnapshot[K, V](r)
+	if err != nil {
+		return n, err
+	}
+	m.lock()
+	defer m.unlock()
+	m.replace(data)
+	return n, nil
+}
+
+// GobEncode returns a binary snapshot of the map, see WriteTo.
+func (m *Map[K, V]) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := m.WriteTo(&buf)
+	return buf.Bytes(), err
+}
+
+// GobDecode replaces the content of the map with the snapshot in data, see ReadFrom.
+func (m *Map[K, V]) GobDecode(data []byte) error {
+	_, err := m.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// WriteTo writes a binary snapshot of the map to w, keys and values are encoded with encoding/gob.
+// All the shards are read locked only while their entries are copied.
+func (s *ShardedMap[K, V]) WriteTo(w io.Writer) (n int64, err error) {
+	held := s.rlock()
+	data := s.merged()
+	s.runlock(held)
+	return writeSnapshot(w, snapshotMap, len(data), data)
+}
+
+// ReadFrom replaces the content of the map with the snapshot read from r, all the shards are replaced atomically.
+// The map is left unchanged if an error is returned.
+func (s *ShardedMap[K, V]) ReadFrom(r io.Reader) (n int64, err error) {
+	n, data, err := readMapSnapshot[K, V](r)
+	if err != nil {
+		return n, err
+	}
+	s.lock()
+	defer s.unlock()
+	s.replace(data)
+	return n, nil
+}
+
+// GobEncode returns a binary snapshot of the map, see WriteTo.
+func (s *ShardedMap[K, V]) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := s.WriteTo(&buf)
+	return buf.Bytes(), err
+}
+
+// GobDecode replaces the content of the map with the snapshot in data, see ReadFrom.
+func (s *ShardedMap[K, V]) GobDecode(data []byte) error {
+	_, err := s.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// orderedPayload is the payload of an OrderedMap snapshot, the keys are in insertion order.
+type orderedPayload[K comparable, V any] struct {
+	Keys   []K
+	Values []V
+}
+
+// WriteTo writes a binary snapshot of the map to w, keys and values are encoded with encoding/gob in insertion order.
+// The snapshot can only be read by an OrderedMap. The map is read locked only while its entries are copied.
+func (m *OrderedMap[K, V]) WriteTo(w io.Writer) (n int64, err error) {
+	keys, values := m.Entries()
+	return writeSnapshot(w, snapshotOrdered, len(keys), orderedPayload[K, V]{Keys: keys, Values: values})
+}
+
+// ReadFrom replaces the content of the map with the snapshot read from r, written by WriteTo, the keys follow the
+// order of the snapshot. The map is left unchanged if an error is returned.
+func (m *OrderedMap[K, V]) ReadFrom(r io.Reader) (n int64, err error) {
+	n, count, payload, err := readSnapshot(r, snapshotOrdered)
+	if err != nil {
+		return n, err
+	}
+	var p orderedPayload[K, V]
+	if count > 0 {
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&p); err != nil {
+			return n, fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+		}
+	}
+	if uint64(len(p.Keys)) != count || len(p.Values) != len(p.Keys) {
+		return n, fmt.Errorf("%w: expected %d entries, got %d keys and %d values", ErrInvalidSnapshot, count, len(p.Keys), len(p.Values))
+	}
+	m.Map.lock()
+	defer m.Map.unlock()
+	m.replaceOrdered(p.Keys, p.Values)
+	return n, nil
+}
+
+// GobEncode returns a binary snapshot of the map, see WriteTo.
+func (m *OrderedMap[K, V]) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := m.WriteTo(&buf)
+	return buf.Bytes(), err
+}
+
+// GobDecode replaces the content of the map with the snapshot in data, see ReadFrom.
+func (m *OrderedMap[K, V]) GobDecode(data []byte) error {
+	_, err := m.ReadFrom(bytes.NewReader(data))
+	return err
+}
+
+// WriteTo writes a binary snapshot of the value to w, the value is encoded with encoding/gob.
+// An unset value is written as a snapshot without entries.
+func (m *Value[V]) WriteTo(w io.Writer) (n int64, err error) {
+	held := m.rlock()
+	data, set := m.data, m.set
+	m.runlock(held)
+	if !set {
+		return writeSnapshot(w, snapshotValue, 0, nil)
+	}
+	return writeSnapshot(w, snapshotValue, 1, data)
+}
+
+// ReadFrom sets the value from the snapshot read from r, written by WriteTo. A snapshot without entries clears the value.
+// The value is left unchanged if an error is returned.
+func (m *Value[V]) ReadFrom(r io.Reader) (n int64, err error) {
+	n, count, payload, err := readSnapshot(r, snapshotValue)
+	if err != nil {
+		return n, err
+	}
+	switch count {
+	case 0:
+		m.Clear()
+	case 1:
+		var v V
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&v); err != nil {
+			return n, fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+		}
+		m.Store(v)
+	default:
+		return n, fmt.Errorf("%w: expected at most 1 entry, got %d", ErrInvalidSnapshot, count)
+	}
+	return n, nil
+}
+
+// GobEncode returns a binary snapshot of the value, see WriteTo.
+func (m *Value[V]) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := m.WriteTo(&buf)
+	return buf.Bytes(), err
+}
+
+// GobDecode sets the value from the snapshot in data, see ReadFrom.
+func (m *Value[V]) GobDecode(data []byte) error {
+	_, err := m.ReadFrom(bytes.NewReader(data))
+	return err
+}
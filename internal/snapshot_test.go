@@ -0,0 +1,158 @@
+package internal_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+func TestMapSnapshot(t *testing.T) {
+	m := internal.NewMap(map[string]int{"a": 1, "b": 2, "zero": 0})
+	var buf bytes.Buffer
+	n, err := m.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo(): Expected no error, got %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo(): Expected %d bytes written, got %d", buf.Len(), n)
+	}
+	snapshot := bytes.Clone(buf.Bytes())
+	r := internal.NewMap(map[string]int{"c": 3})
+	if n, err := r.ReadFrom(&buf); err != nil || n != int64(len(snapshot)) {
+		t.Fatalf("ReadFrom(): Expected %d bytes and no error, got %d, %v", len(snapshot), n, err)
+	}
+	if r.Len() != 3 || r.Has("c") || !r.Has("zero") {
+		t.Errorf("ReadFrom(): Expected content to be replaced, got %v", r.Keys())
+	}
+	if v, _ := r.Load("b"); v != 2 {
+		t.Errorf("ReadFrom(): Expected value 2, got %d", v)
+	}
+
+	empty := internal.NewMap[string, int](nil)
+	buf.Reset()
+	empty.WriteTo(&buf)
+	if _, err := r.ReadFrom(&buf); err != nil || r.Len() != 0 {
+		t.Errorf("ReadFrom(): Expected empty snapshot to empty the map, got %v", err)
+	}
+}
+
+func TestMapSnapshotErrors(t *testing.T) {
+	m := internal.NewMap(map[string]int{"a": 1, "b": 2})
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	snapshot := buf.Bytes()
+
+	corrupt := func(i int) []byte {
+		data := bytes.Clone(snapshot)
+		data[i] ^= 0xff
+		return data
+	}
+	values := internal.NewWithValue(1)
+	var valueSnapshot bytes.Buffer
+	values.WriteTo(&valueSnapshot)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated header", snapshot[:10]},
+		{"truncated payload", snapshot[:len(snapshot)-10]},
+		{"missing checksum", snapshot[:len(snapshot)-4]},
+		{"bad magic", corrupt(0)},
+		{"bad version", corrupt(4)},
+		{"bad count", corrupt(13)},
+		{"bad payload", corrupt(30)},
+		{"bad checksum", corrupt(len(snapshot) - 1)},
+		{"value snapshot", valueSnapshot.Bytes()},
+	}
+	for _, tt := range tests {
+		r := internal.NewMap(map[string]int{"c": 3})
+		_, err := r.ReadFrom(bytes.NewReader(tt.data))
+		if !errors.Is(err, internal.ErrInvalidSnapshot) {
+			t.Errorf("ReadFrom(%s): Expected ErrInvalidSnapshot, got %v", tt.name, err)
+		}
+		if r.Len() != 1 || !r.Has("c") {
+			t.Errorf("ReadFrom(%s): Expected map to be unchanged, got %v", tt.name, r.Keys())
+		}
+	}
+	_, err := m.ReadFrom(bytes.NewReader(snapshot[:len(snapshot)-1]))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("ReadFrom(): Expected io.ErrUnexpectedEOF for a truncated snapshot, got %v", err)
+	}
+}
+
+func TestShardedMapSnapshot(t *testing.T) {
+	m := internal.NewShardedMap[int, string](4, intHash)
+	for i := 0; i < 10; i++ {
+		m.Store(i, "v")
+	}
+	data, err := m.GobEncode()
+	if err != nil {
+		t.Fatalf("GobEncode(): Expected no error, got %v", err)
+	}
+	r := internal.NewShardedMap[int, string](3, intHash)
+	r.Store(100, "x")
+	if err := r.GobDecode(data); err != nil {
+		t.Fatalf("GobDecode(): Expected no error, got %v", err)
+	}
+	if r.Len() != 10 || r.Has(100) {
+		t.Errorf("GobDecode(): Expected content to be replaced, got %v", r.Keys())
+	}
+	// sharded and plain maps share the same format.
+	p := internal.NewMap[int, string](nil)
+	if err := p.GobDecode(data); err != nil || p.Len() != 10 {
+		t.Errorf("GobDecode(): Expected a plain map to read a sharded map snapshot, got %v", err)
+	}
+}
+
+func TestValueSnapshot(t *testing.T) {
+	v := internal.NewWithValue([]string{"a", "b"})
+	var buf bytes.Buffer
+	v.WriteTo(&buf)
+	r := internal.NewValue[[]string]()
+	if _, err := r.ReadFrom(&buf); err != nil {
+		t.Fatalf("ReadFrom(): Expected no error, got %v", err)
+	}
+	if s, ok := r.Load(); !ok || len(s) != 2 || s[1] != "b" {
+		t.Errorf("ReadFrom(): Expected [a b], got %v", s)
+	}
+	unset := internal.NewValue[[]string]()
+	buf.Reset()
+	unset.WriteTo(&buf)
+	if _, err := r.ReadFrom(&buf); err != nil || !r.IsZero() {
+		t.Errorf("ReadFrom(): Expected unset snapshot to clear the value, got %v", err)
+	}
+	m := internal.NewMap(map[string]int{"a": 1})
+	buf.Reset()
+	m.WriteTo(&buf)
+	if _, err := r.ReadFrom(&buf); !errors.Is(err, internal.ErrInvalidSnapshot) {
+		t.Errorf("ReadFrom(): Expected ErrInvalidSnapshot for a map snapshot, got %v", err)
+	}
+}
+
+func TestGobStruct(t *testing.T) {
+	type state struct {
+		Hits  *internal.Numeric[int]
+		Users *internal.Map[string, int]
+	}
+	in := state{Hits: internal.NewNumericWithValue(7), Users: internal.NewMap(map[string]int{"bob": 1})}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(in); err != nil {
+		t.Fatalf("Encode(): Expected no error, got %v", err)
+	}
+	out := state{Hits: internal.NewNumeric[int](), Users: internal.NewMap[string, int](nil)}
+	if err := gob.NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatalf("Decode(): Expected no error, got %v", err)
+	}
+	if v, _ := out.Hits.Load(); v != 7 {
+		t.Errorf("Decode(): Expected 7, got %d", v)
+	}
+	if v, _ := out.Users.Load("bob"); v != 1 {
+		t.Errorf("Decode(): Expected 1, got %d", v)
+	}
+}
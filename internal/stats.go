@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats reports the lock activity of a Map or a Value created with WithStats, since its creation.
+//
+// WriteHold and MaxHold include the write lock held when Stats is called, ReadHold only includes the released read locks.
+type Stats struct {
+	Reads     uint64        // number of read lock acquisitions.
+	Writes    uint64        // number of write lock acquisitions.
+	Contended uint64        // number of acquisitions, read or write, that had to wait for the lock.
+	ReadWait  time.Duration // total time spent waiting for the read lock.
+	WriteWait time.Duration // total time spent waiting for the write lock, including the waits given up by the Context methods.
+	ReadHold  time.Duration // total time the read lock was held, summed over concurrent readers.
+	WriteHold time.Duration // total time the write lock was held.
+	MaxHold   time.Duration // longest time the write lock was held at once.
+}
+
+// add returns the sum of s and o, MaxHold is the longest of the two.
+func (s Stats) add(o Stats) Stats {
+	return Stats{
+		Reads:     s.Reads + o.Reads,
+		Writes:    s.Writes + o.Writes,
+		Contended: s.Contended + o.Contended,
+		ReadWait:  s.ReadWait + o.ReadWait,
+		WriteWait: s.WriteWait + o.WriteWait,
+		ReadHold:  s.ReadHold + o.ReadHold,
+		WriteHold: s.WriteHold + o.WriteHold,
+		MaxHold:   max(s.MaxHold, o.MaxHold),
+	}
+}
+
+// WithStats records the lock activity of the structure, returned by its Stats method.
+// Without WithStats Stats always returns zero and locking only costs a nil check more.
+func WithStats[V any]() Option[V] {
+	return func(o *Options[V]) {
+		o.Stats = true
+	}
+}
+
+// epoch is the origin of the times recorded by lockStats, time.Since reads the monotonic clock.
+var epoch = time.Now()
+
+// nanotime returns the nanoseconds elapsed since epoch, it is never 0.
+func nanotime() int64 {
+	return int64(time.Since(epoch)) + 1
+}
+
+// lockStats records the lock activity of a structure. The structures hold a nil *lockStats unless created with
+// WithStats, so that the lock helpers do not read the clock when stats are disabled.
+//
+// Acquisitions try the lock first and only read the clock to measure the wait when the lock is busy.
+type lockStats struct {
+	reads, writes, contended atomic.Uint64
+	readWait, writeWait      atomic.Int64 // nanoseconds.
+	readHold, writeHold      atomic.Int64 // nanoseconds.
+	maxHold                  atomic.Int64 // nanoseconds.
+	locked                   atomic.Int64 // nanotime when the write lock was acquired, 0 if it is not held.
+}
+
+// newLockStats returns a new lockStats if enabled is true, and nil otherwise.
+func newLockStats(enabled bool) *lockStats {
+	if !enabled {
+		return nil
+	}
+	return &lockStats{}
+}
+
+// lock locks mu for writing and records the acquisition.
+func (s *lockStats) lock(mu *sync.RWMutex) {
+	if !mu.TryLock() {
+		start := nanotime()
+		mu.Lock()
+		s.contended.Add(1)
+		s.writeWait.Add(nanotime() - start)
+	}
+	s.acquired()
+}
+
+// lockContext locks mu for writing, giving up once ctx is done, and records the acquisition. See waitQueue.lockContext.
+func (s *lockStats) lockContext(ctx context.Context, mu *sync.RWMutex, q *waitQueue) error {
+	start, tried, free := nanotime(), false, false
+	err := q.lockContext(ctx, func() bool {
+		tried, free = true, mu.TryLock()
+		return free
+	}, mu.Lock, mu.Unlock)
+	if tried && !free {
+		s.writeWait.Add(nanotime() - start)
+		if err == nil {
+			s.contended.Add(1)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	s.acquired()
+	return nil
+}
+
+// tryLock locks mu for writing if it is not locked and records the acquisition.
+func (s *lockStats) tryLock(mu *sync.RWMutex) bool {
+	if !mu.TryLock() {
+		return false
+	}
+	s.acquired()
+	return true
+}
+
+// acquired records a write lock acquisition, the caller holds the write lock.
+func (s *lockStats) acquired() {
+	s.writes.Add(1)
+	s.locked.Store(nanotime())
+}
+
+// unlock records the release of the write lock, it is called before the lock is released.
+func (s *lockStats) unlock() {
+	held := nanotime() - s.locked.Swap(0)
+	s.writeHold.Add(held)
+	for {
+		longest := s.maxHold.Load()
+		if held <= longest || s.maxHold.CompareAndSwap(longest, held) {
+			return
+		}
+	}
+}
+
+// rlock locks mu for reading, records the acquisition and returns the time it was acquired, to be passed to runlock.
+func (s *lockStats) rlock(mu *sync.RWMutex) int64 {
+	if !mu.TryRLock() {
+		start := nanotime()
+		mu.RLock()
+		s.contended.Add(1)
+		s.readWait.Add(nanotime() - start)
+	}
+	s.reads.Add(1)
+	return nanotime()
+}
+
+// tryRLock locks mu for reading if it is not write locked, see rlock.
+func (s *lockStats) tryRLock(mu *sync.RWMutex) (int64, bool) {
+	if !mu.TryRLock() {
+		return 0, false
+	}
+	s.reads.Add(1)
+	return nanotime(), true
+}
+
+// runlock records the release of a read lock acquired at held, it is called before the lock is released.
+func (s *lockStats) runlock(held int64) {
+	s.readHold.Add(nanotime() - held)
+}
+
+// stats returns the activity recorded so far, a nil lockStats returns zero.
+func (s *lockStats) stats() Stats {
+	if s == nil {
+		return Stats{}
+	}
+	st := Stats{
+		Reads:     s.reads.Load(),
+		Writes:    s.writes.Load(),
+		Contended: s.contended.Load(),
+		ReadWait:  time.Duration(s.readWait.Load()),
+		WriteWait: time.Duration(s.writeWait.Load()),
+		ReadHold:  time.Duration(s.readHold.Load()),
+		WriteHold: time.Duration(s.writeHold.Load()),
+		MaxHold:   time.Duration(s.maxHold.Load()),
+	}
+	if locked := s.locked.Load(); locked != 0 {
+		held := time.Duration(nanotime() - locked)
+		st.WriteHold += held
+		st.MaxHold = max(st.MaxHold, held)
+	}
+	return st
+}
+
+// Stats returns the lock activity of the map recorded since its creation, it returns zero unless the map
+// was created with WithStats.
+func (m *Map[K, V]) Stats() Stats {
+	return m.stats.stats()
+}
+
+// Stats returns the lock activity of all the shards, see Map.Stats. MaxHold is the longest hold of any shard.
+func (s *ShardedMap[K, V]) Stats() Stats {
+	var st Stats
+	for _, shard := range s.shards {
+		st = st.add(shard.Stats())
+	}
+	return st
+}
+
+// Stats returns the lock activity of the value recorded since its creation, it returns zero unless the value
+// was created with WithStats.
+func (m *Value[V]) Stats() Stats {
+	return m.stats.stats()
+}
@@ -0,0 +1,150 @@
+package internal_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+func TestStatsDisabled(t *testing.T) {
+	m := internal.NewMap[string, int](nil)
+	m.Store("a", 1)
+	m.Load("a")
+	if st := m.Stats(); st != (internal.Stats{}) {
+		t.Errorf("Stats(): Expected zero without WithStats, got %+v", st)
+	}
+	v := internal.NewValue[int]()
+	v.Store(1)
+	if st := v.Stats(); st != (internal.Stats{}) {
+		t.Errorf("Stats(): Expected zero without WithStats, got %+v", st)
+	}
+}
+
+func TestMapStats(t *testing.T) {
+	m := internal.NewMap[string, int](nil, internal.WithStats[int]())
+	m.Store("a", 1)
+	m.Store("b", 2)
+	m.Load("a")
+	m.TryLoad("b")
+	for range m.All() {
+	}
+	if !m.TryStore("c", 3) {
+		t.Fatalf("TryStore(): Expected to run")
+	}
+	st := m.Stats()
+	if st.Writes != 3 || st.Reads != 3 || st.Contended != 0 {
+		t.Errorf("Stats(): Expected 3 writes, 3 reads and no contention, got %+v", st)
+	}
+	if st.ReadWait != 0 || st.WriteWait != 0 {
+		t.Errorf("Stats(): Expected no wait, got %+v", st)
+	}
+	if st.MaxHold <= 0 || st.WriteHold < st.MaxHold || st.ReadHold <= 0 {
+		t.Errorf("Stats(): Expected hold times to be recorded, got %+v", st)
+	}
+}
+
+func TestMapStatsHold(t *testing.T) {
+	m := internal.NewMap[string, int](nil, internal.WithStats[int]())
+	release := holdLock(func(wait func()) {
+		m.Exclusive(func(map[string]int) { wait() })
+	})
+	time.Sleep(10 * time.Millisecond)
+	// the lock being held is included.
+	if st := m.Stats(); st.MaxHold < 10*time.Millisecond || st.WriteHold < st.MaxHold {
+		t.Errorf("Stats(): Expected the current hold to be included, got %+v", st)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Store("a", 1)
+		m.Load("a")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if err := m.StoreContext(ctx, "b", 2); err == nil {
+		t.Fatalf("StoreContext(): Expected the deadline to be exceeded")
+	}
+	if m.TryStore("b", 2) {
+		t.Fatalf("TryStore(): Expected not to run")
+	}
+	time.Sleep(5 * time.Millisecond)
+	release()
+	<-done
+
+	st := m.Stats()
+	if st.Writes != 2 || st.Reads != 1 || st.Contended != 1 {
+		t.Errorf("Stats(): Expected 2 writes, 1 read and 1 contended write, got %+v", st)
+	}
+	if st.WriteWait < 10*time.Millisecond {
+		t.Errorf("Stats(): Expected the waits to be recorded, got %+v", st)
+	}
+	if st.MaxHold < 20*time.Millisecond {
+		t.Errorf("Stats(): Expected the longest hold to be recorded, got %+v", st)
+	}
+
+	// a reader waiting for the write lock.
+	release = holdLock(func(wait func()) {
+		m.Update("a", func(v int, ok bool) int { wait(); return v })
+	})
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		release()
+	}()
+	m.Load("a")
+	if st := m.Stats(); st.Contended != 2 || st.ReadWait <= 0 {
+		t.Errorf("Stats(): Expected a contended read, got %+v", st)
+	}
+}
+
+func TestShardedMapStats(t *testing.T) {
+	m := internal.NewShardedMap(4, intHash, internal.WithStats[int]())
+	for i := range 4 {
+		m.Store(i, i)
+	}
+	m.Len()
+	if st := m.Stats(); st.Writes != 4 || st.Reads != 4 {
+		t.Errorf("Stats(): Expected the stats of every shard, got %+v", st)
+	}
+}
+
+func TestValueStats(t *testing.T) {
+	n := internal.NewNumeric(internal.WithStats[int]())
+	n.Add(1)
+	n.Add(1)
+	n.TryStore(3)
+	n.Load()
+	st := n.Stats()
+	if st.Writes != 3 || st.Reads != 1 || st.Contended != 0 || st.MaxHold <= 0 {
+		t.Errorf("Stats(): Expected 3 writes and 1 read, got %+v", st)
+	}
+	v := internal.NewWithValue(1, internal.WithStats[int]())
+	release := holdLock(func(wait func()) {
+		v.Exclusive(func(v int, ok bool) int { wait(); return v })
+	})
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		release()
+	}()
+	v.Store(2)
+	if st := v.Stats(); st.Writes != 2 || st.Contended != 1 || st.WriteWait <= 0 {
+		t.Errorf("Stats(): Expected a contended write, got %+v", st)
+	}
+}
+
+func BenchmarkStats(b *testing.B) {
+	b.Run("disabled", func(b *testing.B) {
+		m := internal.NewMap[int, int](nil)
+		for i := 0; i < b.N; i++ {
+			m.Store(i&1023, i)
+		}
+	})
+	b.Run("enabled", func(b *testing.B) {
+		m := internal.NewMap[int, int](nil, internal.WithStats[int]())
+		for i := 0; i < b.N; i++ {
+			m.Store(i&1023, i)
+		}
+	})
+}
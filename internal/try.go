@@ -0,0 +1,136 @@
+package internal
+
+// tryLock locks the map for writing if it is not locked, it returns false without waiting otherwise.
+func (m *Map[K, V]) tryLock() bool {
+	if m.stats == nil {
+		if !m.mu.TryLock() {
+			return false
+		}
+	} else if !m.stats.tryLock(&m.mu) {
+		return false
+	}
+	m.acquired()
+	return true
+}
+
+// tryRLock locks the map for reading if it is not write locked, the returned time must be passed to runlock.
+func (m *Map[K, V]) tryRLock() (held int64, ok bool) {
+	if m.stats == nil {
+		return 0, m.mu.TryRLock()
+	}
+	return m.stats.tryRLock(&m.mu)
+}
+
+// TryLoad is the same as Load but does not wait if the map is write locked, acquired is false if Load did not run.
+func (m *Map[K, V]) TryLoad(key K) (v V, ok bool, acquired bool) {
+	held, acquired := m.tryRLock()
+	if !acquired {
+		return v, false, false
+	}
+	defer m.runlock(held)
+	v, ok = m.get(key)
+	return v, ok, true
+}
+
+// TryStore is the same as Store but does not wait if the map is locked, it returns false if Store did not run.
+func (m *Map[K, V]) TryStore(key K, value V) bool {
+	if !m.tryLock() {
+		return false
+	}
+	defer m.unlock()
+	m.set(OpStore, key, value)
+	return true
+}
+
+// TryUpdate is the same as Update but does not wait if the map is locked, it returns false if f was not called.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (m *Map[K, V]) TryUpdate(key K, f func(V, bool) V) bool {
+	if !m.tryLock() {
+		return false
+	}
+	defer m.unlock()
+	m.update(key, f)
+	return true
+}
+
+// TryExclusive is the same as Exclusive but does not wait if the map is locked, it returns false if f was not called.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (m *Map[K, V]) TryExclusive(f func(m map[K]V)) bool {
+	if !m.tryLock() {
+		return false
+	}
+	defer m.unlock()
+	m.exclusive(f)
+	return true
+}
+
+// tryLock locks all the shards for writing if none of them is locked, it returns false without waiting otherwise.
+func (s *ShardedMap[K, V]) tryLock() bool {
+	for i, shard := range s.shards {
+		if !shard.tryLock() {
+			for j := i - 1; j >= 0; j-- {
+				s.shards[j].unlock()
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// TryLoad is the same as Load but does not wait if the shard owning key is write locked, acquired is false if Load did not run.
+func (s *ShardedMap[K, V]) TryLoad(key K) (v V, ok bool, acquired bool) {
+	return s.shard(key).TryLoad(key)
+}
+
+// TryStore is the same as Store but does not wait if the shard owning key is locked, it returns false if Store did not run.
+func (s *ShardedMap[K, V]) TryStore(key K, value V) bool {
+	return s.shard(key).TryStore(key, value)
+}
+
+// TryUpdate is the same as Update but does not wait if the shard owning key is locked, it returns false if f was not called.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (s *ShardedMap[K, V]) TryUpdate(key K, f func(V, bool) V) bool {
+	return s.shard(key).TryUpdate(key, f)
+}
+
+// TryExclusive is the same as Exclusive but does not wait if any shard is locked, it returns false if f was not called.
+//
+// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+func (s *ShardedMap[K, V]) TryExclusive(f func(m map[K]V)) bool {
+	if !s.tryLock() {
+		return false
+	}
+	defer s.unlock()
+	s.exclusive(f)
+	return true
+}
+
+// TryLoad is the same as Load, it never waits since readers do not lock the map, acquired is always true.
+func (c *COWMap[K, V]) TryLoad(key K) (v V, ok bool, acquired bool) {
+	v, ok = c.Load(key)
+	return v, ok, true
+}
+
+// TryStore is the same as Store but does not wait if the value is locked, it returns false if Store did not run.
+func (m *Value[V]) TryStore(value V) bool {
+	if !m.tryLock() {
+		return false
+	}
+	defer m.unlock()
+	m.store(value)
+	return true
+}
+
+// TryExclusive is the same as Exclusive but does not wait if the value is locked, ok is false if update was not called.
+//
+// ! Do not invoke any Value or Numeric functions within 'f' to prevent a deadlock.
+func (m *Value[V]) TryExclusive(update func(actual V, loaded bool) V) (updated V, ok bool) {
+	if !m.tryLock() {
+		return updated, false
+	}
+	defer m.unlock()
+	return m.exclusive(update), true
+}
@@ -0,0 +1,154 @@
+package internal_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+func TestMapTry(t *testing.T) {
+	m := internal.NewMap(map[string]int{"a": 1})
+	release := holdLock(func(wait func()) {
+		m.Exclusive(func(map[string]int) { wait() })
+	})
+	if _, _, acquired := m.TryLoad("a"); acquired {
+		t.Errorf("TryLoad(): Expected not to run while the map is write locked")
+	}
+	if m.TryStore("a", 2) {
+		t.Errorf("TryStore(): Expected not to run while the map is locked")
+	}
+	if m.TryUpdate("a", func(v int, ok bool) int { t.Errorf("TryUpdate(): Expected f not to be called"); return v }) {
+		t.Errorf("TryUpdate(): Expected not to run while the map is locked")
+	}
+	if m.TryExclusive(func(map[string]int) { t.Errorf("TryExclusive(): Expected f not to be called") }) {
+		t.Errorf("TryExclusive(): Expected not to run while the map is locked")
+	}
+	release()
+
+	// readers do not prevent TryLoad, but prevent the writers.
+	release = holdLock(func(wait func()) {
+		for range m.All() {
+			wait()
+		}
+	})
+	if v, ok, acquired := m.TryLoad("a"); !acquired || !ok || v != 1 {
+		t.Errorf("TryLoad(): Expected value 1 while the map is read locked, got %d, %v", v, acquired)
+	}
+	if m.TryStore("a", 2) {
+		t.Errorf("TryStore(): Expected not to run while the map is read locked")
+	}
+	release()
+
+	if !m.TryStore("a", 2) || !m.TryUpdate("a", func(v int, ok bool) int { return v + 1 }) {
+		t.Errorf("TryStore(): Expected to run once the map is unlocked")
+	}
+	if !m.TryExclusive(func(data map[string]int) { data["b"] = data["a"] }) {
+		t.Errorf("TryExclusive(): Expected to run once the map is unlocked")
+	}
+	if v, ok, acquired := m.TryLoad("b"); !acquired || !ok || v != 3 {
+		t.Errorf("TryLoad(): Expected value 3, got %d", v)
+	}
+}
+
+func TestMapTryContention(t *testing.T) {
+	m := internal.NewMap[string, int](nil)
+	var ran atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if m.TryUpdate("n", func(v int, ok bool) int { return v + 1 }) {
+					ran.Add(1)
+				}
+				m.TryLoad("n")
+			}
+		}()
+	}
+	wg.Wait()
+	if v, _ := m.Load("n"); int64(v) != ran.Load() {
+		t.Errorf("TryUpdate(): Expected %d updates to have run, got %d", ran.Load(), v)
+	}
+}
+
+func TestShardedMapTry(t *testing.T) {
+	m := internal.NewShardedMap[int, int](4, intHash)
+	release := holdLock(func(wait func()) {
+		m.Update(2, func(v int, ok bool) int { wait(); return v })
+	})
+	if m.TryExclusive(func(map[int]int) {}) {
+		t.Errorf("TryExclusive(): Expected not to run while a shard is locked")
+	}
+	// the other shards are not locked.
+	if !m.TryStore(1, 1) || !m.TryUpdate(3, func(v int, ok bool) int { return 3 }) {
+		t.Errorf("TryStore(): Expected to run on an unlocked shard")
+	}
+	if m.TryStore(2, 2) {
+		t.Errorf("TryStore(): Expected not to run on a locked shard")
+	}
+	if _, _, acquired := m.TryLoad(2); acquired {
+		t.Errorf("TryLoad(): Expected not to run on a locked shard")
+	}
+	release()
+	if !m.TryExclusive(func(data map[int]int) { data[2] = 2 }) || m.Len() != 3 {
+		t.Errorf("TryExclusive(): Expected to run once the shards are unlocked, got %v", m.Keys())
+	}
+	if v, ok, acquired := m.TryLoad(2); !acquired || !ok || v != 2 {
+		t.Errorf("TryLoad(): Expected value 2, got %d", v)
+	}
+}
+
+func TestCOWMapTry(t *testing.T) {
+	m := internal.NewCOWMap(map[string]int{"a": 1})
+	release := holdLock(func(wait func()) {
+		m.Exclusive(func(map[string]int) { wait() })
+	})
+	defer release()
+	if v, ok, acquired := m.TryLoad("a"); !acquired || !ok || v != 1 {
+		t.Errorf("TryLoad(): Expected readers never to wait, got %d, %v", v, acquired)
+	}
+	if m.TryStore("a", 2) {
+		t.Errorf("TryStore(): Expected not to run while the map is locked")
+	}
+}
+
+func TestValueTry(t *testing.T) {
+	n := internal.NewNumeric[int]()
+	release := holdLock(func(wait func()) {
+		n.Exclusive(func(v int, ok bool) int { wait(); return v })
+	})
+	if n.TryStore(1) {
+		t.Errorf("TryStore(): Expected not to run while the value is locked")
+	}
+	if _, ok := n.TryExclusive(func(v int, ok bool) int { return v + 1 }); ok {
+		t.Errorf("TryExclusive(): Expected not to run while the value is locked")
+	}
+	release()
+	if !n.TryStore(1) {
+		t.Errorf("TryStore(): Expected to run once the value is unlocked")
+	}
+	if v, ok := n.TryExclusive(func(v int, ok bool) int { return v + 1 }); !ok || v != 2 {
+		t.Errorf("TryExclusive(): Expected 2, got %d", v)
+	}
+
+	var ran atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if _, ok := n.TryExclusive(func(v int, ok bool) int { return v + 1 }); ok {
+					ran.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if v, _ := n.Load(); int64(v) != ran.Load()+2 {
+		t.Errorf("TryExclusive(): Expected %d updates to have run, got %d", ran.Load(), v-2)
+	}
+}
@@ -0,0 +1,282 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock provides the current time to a TTLMap, it allows expiration to be controlled in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock used when none is provided, it returns time.Now().
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// TTLOptions configures a TTLMap.
+type TTLOptions struct {
+	// DefaultTTL is the time to live of entries added with Store and LoadOrStore.
+	// A DefaultTTL less or equal to zero means entries do not expire unless stored with StoreWithTTL.
+	DefaultTTL time.Duration
+	// Sliding resets the expiration of an entry every time it is returned by Load.
+	Sliding bool
+	// CleanupInterval is the interval at which the janitor removes expired entries.
+	// If CleanupInterval is less or equal to zero no janitor is started and expired entries
+	// are only removed by DeleteExpired, expired entries are never returned regardless.
+	CleanupInterval time.Duration
+	// Clock is the source of the current time, if nil the system clock is used.
+	Clock Clock
+}
+
+// ttlEntry is a value stored in a TTLMap along with its expiration.
+type ttlEntry[V any] struct {
+	value   V
+	ttl     time.Duration
+	expires time.Time // zero value means the entry never expires.
+}
+
+// expired returns true if the entry is expired at now.
+func (e ttlEntry[V]) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// TTLMap implements a thread-safe map whose entries expire after a time to live.
+// Expired entries are never returned, they are removed from the map by the janitor goroutine or by DeleteExpired.
+type TTLMap[K comparable, V any] struct {
+	_       noCopy // go vet to alert when copying by value.
+	data    *Map[K, ttlEntry[V]]
+	opts    TTLOptions
+	evictMu sync.RWMutex
+	onEvict func(K, V)
+	stop    chan struct{}
+	done    chan struct{}
+	closing sync.Once
+}
+
+// NewTTLMap returns a new TTLMap configured with opts.
+// If opts.CleanupInterval is greater than zero a janitor goroutine is started, Close must be called to stop it.
+func NewTTLMap[K comparable, V any](opts TTLOptions) *TTLMap[K, V] {
+	if opts.Clock == nil {
+		opts.Clock = systemClock{}
+	}
+	m := &TTLMap[K, V]{
+		data: NewMap[K, ttlEntry[V]](nil),
+		opts: opts,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if opts.CleanupInterval > 0 {
+		go m.janitor(opts.CleanupInterval)
+	} else {
+		close(m.done)
+	}
+	return m
+}
+
+// janitor removes expired entries every interval until Close is called.
+func (m *TTLMap[K, V]) janitor(interval time.Duration) {
+	defer close(m.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.DeleteExpired()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// Close stops the janitor goroutine, if any, and waits for it to return.
+// The map can still be used after Close, expired entries are then only removed by DeleteExpired.
+// Close is safe to call more than once.
+func (m *TTLMap[K, V]) Close() {
+	m.closing.Do(func() {
+		close(m.stop)
+	})
+	<-m.done
+}
+
+// OnEvict sets f as the function called for every entry removed because it expired, either by the janitor and
+// DeleteExpired or because Store, StoreWithTTL or LoadOrStore replaced it before it was collected.
+// f is called after the map lock is released, so it may call any method on m.
+func (m *TTLMap[K, V]) OnEvict(f func(key K, value V)) {
+	m.evictMu.Lock()
+	defer m.evictMu.Unlock()
+	m.onEvict = f
+}
+
+// evicted calls the eviction callback, if any, for the given entries.
+func (m *TTLMap[K, V]) evicted(keys []K, values []V) {
+	m.evictMu.RLock()
+	f := m.onEvict
+	m.evictMu.RUnlock()
+	if f == nil {
+		return
+	}
+	for i := range keys {
+		f(keys[i], values[i])
+	}
+}
+
+// entry returns a new entry for value expiring after ttl.
+func (m *TTLMap[K, V]) entry(value V, ttl time.Duration) ttlEntry[V] {
+	e := ttlEntry[V]{value: value, ttl: ttl}
+	if ttl > 0 {
+		e.expires = m.opts.Clock.Now().Add(ttl)
+	}
+	return e
+}
+
+// Load returns the value stored in the map for a key, or the zero value if no value is present or the entry expired.
+// The ok result indicates whether value was found in the map.
+// When the map uses sliding expiration a successful Load extends the entry expiration.
+func (m *TTLMap[K, V]) Load(key K) (v V, ok bool) {
+	if !m.opts.Sliding {
+		defer m.data.runlock(m.data.rlock())
+		e, ok := m.data.data[key]
+		if !ok || e.expired(m.opts.Clock.Now()) {
+			return v, false
+		}
+		return e.value, true
+	}
+	m.data.lock()
+	defer m.data.unlock()
+	e, ok := m.data.data[key]
+	if !ok || e.expired(m.opts.Clock.Now()) {
+		return v, false
+	}
+	m.data.data[key] = m.entry(e.value, e.ttl)
+	return e.value, true
+}
+
+// Store sets the value for a key, the entry expires after the default TTL.
+func (m *TTLMap[K, V]) Store(key K, value V) {
+	m.StoreWithTTL(key, value, m.opts.DefaultTTL)
+}
+
+// StoreWithTTL sets the value for a key, the entry expires after ttl.
+// A ttl less or equal to zero means the entry never expires.
+// An expired entry replaced by value is reported to the eviction callback.
+func (m *TTLMap[K, V]) StoreWithTTL(key K, value V, ttl time.Duration) {
+	m.data.lock()
+	e, ok := m.data.data[key]
+	expired := ok && e.expired(m.opts.Clock.Now())
+	m.data.data[key] = m.entry(value, ttl)
+	m.data.unlock()
+	if expired {
+		m.evicted([]K{key}, []V{e.value})
+	}
+}
+
+// LoadOrStore returns the existing value for the key if present and not expired.
+// Otherwise, it stores the given value with the default TTL and returns it.
+// The loaded result is true if the value was loaded, false if stored.
+// An expired entry replaced by value is reported to the eviction callback.
+func (m *TTLMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	m.data.lock()
+	e, ok := m.data.data[key]
+	if ok && !e.expired(m.opts.Clock.Now()) {
+		if m.opts.Sliding {
+			m.data.data[key] = m.entry(e.value, e.ttl)
+		}
+		m.data.unlock()
+		return e.value, true
+	}
+	m.data.data[key] = m.entry(value, m.opts.DefaultTTL)
+	m.data.unlock()
+	if ok {
+		m.evicted([]K{key}, []V{e.value})
+	}
+	return value, false
+}
+
+// LoadAndDelete deletes the value for a key, returning the previous value if any.
+// The loaded result reports whether the key was present and not expired.
+func (m *TTLMap[K, V]) LoadAndDelete(key K) (value V, loaded bool) {
+	e, ok := m.data.LoadAndDelete(key)
+	if !ok || e.expired(m.opts.Clock.Now()) {
+		return value, false
+	}
+	return e.value, true
+}
+
+// Delete removes the key from the map, the eviction callback is not called.
+func (m *TTLMap[K, V]) Delete(key K) {
+	m.data.Delete(key)
+}
+
+// Has returns true if the map contains the key and the entry is not expired.
+// Has does not extend the entry expiration.
+func (m *TTLMap[K, V]) Has(key K) bool {
+	e, ok := m.data.Load(key)
+	return ok && !e.expired(m.opts.Clock.Now())
+}
+
+// Range calls f sequentially for each key and value present in the map and not expired.
+// If f returns false, Range stops the iteration.
+// Range iterates over a snapshot of the map, f may call any method on m.
+func (m *TTLMap[K, V]) Range(f func(K, V) bool) {
+	now := m.opts.Clock.Now()
+	keys, entries := m.data.Entries()
+	for i := range keys {
+		if entries[i].expired(now) {
+			continue
+		}
+		if !f(keys[i], entries[i].value) {
+			return
+		}
+	}
+}
+
+// Keys returns a slice of all the keys present in the map and not expired, an empty slice is returned if the map is empty.
+func (m *TTLMap[K, V]) Keys() (keys []K) {
+	defer m.data.runlock(m.data.rlock())
+	now := m.opts.Clock.Now()
+	keys = make([]K, 0, len(m.data.data))
+	for key, e := range m.data.data {
+		if !e.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Len returns the number of entries in the map that are not expired.
+func (m *TTLMap[K, V]) Len() (n int) {
+	defer m.data.runlock(m.data.rlock())
+	now := m.opts.Clock.Now()
+	for _, e := range m.data.data {
+		if !e.expired(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// Clear removes all items from the map, the eviction callback is not called.
+func (m *TTLMap[K, V]) Clear() {
+	m.data.Clear()
+}
+
+// DeleteExpired removes all the expired entries from the map and returns how many were removed.
+// The eviction callback is called for each removed entry once the map lock is released.
+func (m *TTLMap[K, V]) DeleteExpired() (n int) {
+	var keys []K
+	var values []V
+	m.data.lock()
+	now := m.opts.Clock.Now()
+	for key, e := range m.data.data {
+		if e.expired(now) {
+			delete(m.data.data, key)
+			keys = append(keys, key)
+			values = append(values, e.value)
+		}
+	}
+	m.data.unlock()
+	m.evicted(keys, values)
+	return len(keys)
+}
@@ -0,0 +1,204 @@
+package internal_test
+
+import (
+	"maps"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+// fakeClock is a Clock that only moves when advanced.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestTTLMapExpiration(t *testing.T) {
+	clock := newFakeClock()
+	m := internal.NewTTLMap[string, int](internal.TTLOptions{DefaultTTL: time.Minute, Clock: clock})
+	defer m.Close()
+
+	m.Store("default", 1)
+	m.StoreWithTTL("short", 2, time.Second)
+	m.StoreWithTTL("forever", 3, 0)
+
+	if m.Len() != 3 {
+		t.Errorf("Len(): Expected length 3, got %d", m.Len())
+	}
+	clock.Advance(time.Second)
+	if _, ok := m.Load("short"); ok {
+		t.Errorf("Load(): Expected key %q to be expired", "short")
+	}
+	if m.Has("short") {
+		t.Errorf("Has(): Expected key %q to be expired", "short")
+	}
+	if v, ok := m.Load("default"); !ok || v != 1 {
+		t.Errorf("Load(): Expected value 1, got %d", v)
+	}
+	if m.Len() != 2 || len(m.Keys()) != 2 {
+		t.Errorf("Len(): Expected length 2, got %d", m.Len())
+	}
+
+	clock.Advance(time.Hour)
+	if v, ok := m.Load("forever"); !ok || v != 3 {
+		t.Errorf("Load(): Expected value 3, got %d", v)
+	}
+	count := 0
+	m.Range(func(key string, value int) bool {
+		count++
+		if key != "forever" {
+			t.Errorf("Range(): Expected only key %q, got %q", "forever", key)
+		}
+		return true
+	})
+	if count != 1 {
+		t.Errorf("Range(): Expected 1 call, got %d", count)
+	}
+
+	if actual, loaded := m.LoadOrStore("default", 4); loaded || actual != 4 {
+		t.Errorf("LoadOrStore(): Expected expired key to be stored, got %d", actual)
+	}
+	if actual, loaded := m.LoadOrStore("default", 5); !loaded || actual != 4 {
+		t.Errorf("LoadOrStore(): Expected value 4 to be loaded, got %d", actual)
+	}
+	if v, loaded := m.LoadAndDelete("default"); !loaded || v != 4 {
+		t.Errorf("LoadAndDelete(): Expected value 4, got %d", v)
+	}
+	m.Delete("forever")
+	if m.Len() != 0 {
+		t.Errorf("Len(): Expected length 0, got %d", m.Len())
+	}
+}
+
+func TestTTLMapSliding(t *testing.T) {
+	clock := newFakeClock()
+	m := internal.NewTTLMap[string, int](internal.TTLOptions{DefaultTTL: time.Minute, Sliding: true, Clock: clock})
+	m.Store("key", 1)
+	for i := 0; i < 5; i++ {
+		clock.Advance(30 * time.Second)
+		if _, ok := m.Load("key"); !ok {
+			t.Fatalf("Load(): Expected sliding expiration to keep key alive")
+		}
+	}
+	if _, loaded := m.LoadOrStore("key", 2); !loaded {
+		t.Errorf("LoadOrStore(): Expected key to be loaded")
+	}
+	clock.Advance(30 * time.Second)
+	if !m.Has("key") {
+		t.Errorf("Has(): Expected LoadOrStore to extend the expiration")
+	}
+	clock.Advance(30 * time.Second)
+	if m.Has("key") {
+		t.Errorf("Has(): Expected key to be expired")
+	}
+	if _, ok := m.Load("key"); ok {
+		t.Errorf("Load(): Expected key to be expired")
+	}
+	if _, loaded := m.LoadAndDelete("key"); loaded {
+		t.Errorf("LoadAndDelete(): Expected expired key not to be loaded")
+	}
+}
+
+func TestTTLMapDeleteExpired(t *testing.T) {
+	clock := newFakeClock()
+	m := internal.NewTTLMap[int, int](internal.TTLOptions{DefaultTTL: time.Second, Clock: clock})
+	evicted := map[int]int{}
+	m.OnEvict(func(key, value int) {
+		evicted[key] = value
+		// the callback runs without the lock held.
+		m.Len()
+	})
+	for i := 0; i < 10; i++ {
+		m.Store(i, i*10)
+	}
+	m.StoreWithTTL(10, 100, time.Hour)
+	if n := m.DeleteExpired(); n != 0 {
+		t.Errorf("DeleteExpired(): Expected 0 entries removed, got %d", n)
+	}
+	clock.Advance(time.Second)
+	if n := m.DeleteExpired(); n != 10 {
+		t.Errorf("DeleteExpired(): Expected 10 entries removed, got %d", n)
+	}
+	if len(evicted) != 10 || evicted[9] != 90 {
+		t.Errorf("OnEvict(): Expected 10 evictions, got %v", evicted)
+	}
+	m.Clear()
+	if m.Len() != 0 {
+		t.Errorf("Len(): Expected length 0, got %d", m.Len())
+	}
+}
+
+func TestTTLMapEvictOnReplace(t *testing.T) {
+	clock := newFakeClock()
+	m := internal.NewTTLMap[string, int](internal.TTLOptions{DefaultTTL: time.Second, Clock: clock})
+	evicted := map[string]int{}
+	m.OnEvict(func(key string, value int) {
+		evicted[key] = value
+	})
+	m.Store("a", 1)
+	m.Store("b", 2)
+	m.Store("a", 3)
+	if len(evicted) != 0 {
+		t.Errorf("OnEvict(): Expected no eviction replacing a live entry, got %v", evicted)
+	}
+	clock.Advance(time.Second)
+	m.StoreWithTTL("a", 4, time.Hour)
+	if v, ok := m.LoadOrStore("b", 5); ok || v != 5 {
+		t.Errorf("LoadOrStore(): Expected 5 to be stored, got %v %v", v, ok)
+	}
+	if expect := map[string]int{"a": 3, "b": 2}; !maps.Equal(evicted, expect) {
+		t.Errorf("OnEvict(): Expected %v, got %v", expect, evicted)
+	}
+}
+
+func TestTTLMapJanitor(t *testing.T) {
+	clock := newFakeClock()
+	m := internal.NewTTLMap[string, int](internal.TTLOptions{
+		DefaultTTL:      time.Second,
+		CleanupInterval: time.Millisecond,
+		Clock:           clock,
+	})
+	evicted := make(chan string, 1)
+	m.OnEvict(func(key string, value int) {
+		evicted <- key
+	})
+	m.Store("key", 1)
+	clock.Advance(time.Second)
+	select {
+	case key := <-evicted:
+		if key != "key" {
+			t.Errorf("OnEvict(): Expected key %q, got %q", "key", key)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("janitor: Expected expired entry to be evicted")
+	}
+	m.Close()
+	m.Close()
+
+	// once closed the janitor no longer runs.
+	m.Store("key", 1)
+	clock.Advance(time.Second)
+	select {
+	case <-evicted:
+		t.Errorf("janitor: Expected no eviction after Close")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
@@ -0,0 +1,95 @@
+package internal
+
+// Tx is the view of a map within a transaction, changes are buffered and applied to the map only
+// when the transaction commits. A Tx must not be used once the transaction function returns.
+type Tx[K comparable, V any] interface {
+	// Load returns the value for key as seen by the transaction, including its own changes.
+	Load(key K) (v V, ok bool)
+	// Store sets the value for key within the transaction.
+	Store(key K, value V)
+	// Delete removes key within the transaction.
+	Delete(key K)
+	// Has returns true if key is present as seen by the transaction.
+	Has(key K) bool
+}
+
+// txWrite is a change buffered by a transaction.
+type txWrite[V any] struct {
+	value   V
+	deleted bool
+}
+
+// txn implements Tx on top of one or more locked maps.
+type txn[K comparable, V any] struct {
+	shard  func(K) *Map[K, V] // returns the map owning key, its lock is held for the whole transaction.
+	writes map[K]txWrite[V]
+	keys   []K // keys in the order they were first written.
+	closed bool
+}
+
+// transaction runs f within a transaction and commits its changes if f returns nil.
+// The maps returned by shard must be write locked by the caller.
+func transaction[K comparable, V any](shard func(K) *Map[K, V], f func(tx Tx[K, V]) error) error {
+	tx := &txn[K, V]{shard: shard, writes: make(map[K]txWrite[V])}
+	defer func() {
+		tx.closed = true
+	}()
+	if err := f(tx); err != nil {
+		return err
+	}
+	for _, key := range tx.keys {
+		w := tx.writes[key]
+		if w.deleted {
+			shard(key).del(OpDelete, key)
+		} else {
+			shard(key).set(OpStore, key, w.value)
+		}
+	}
+	return nil
+}
+
+func (tx *txn[K, V]) check() {
+	if tx.closed {
+		panic("mutex: Tx used after the transaction returned")
+	}
+}
+
+func (tx *txn[K, V]) write(key K, w txWrite[V]) {
+	tx.check()
+	if _, ok := tx.writes[key]; !ok {
+		tx.keys = append(tx.keys, key)
+	}
+	tx.writes[key] = w
+}
+
+// Load returns the value for key as seen by the transaction, including its own changes.
+func (tx *txn[K, V]) Load(key K) (v V, ok bool) {
+	tx.check()
+	if w, ok := tx.writes[key]; ok {
+		if w.deleted {
+			return v, false
+		}
+		return w.value, true
+	}
+	return tx.shard(key).get(key)
+}
+
+// Store sets the value for key within the transaction.
+func (tx *txn[K, V]) Store(key K, value V) {
+	tx.write(key, txWrite[V]{value: value})
+}
+
+// Delete removes key within the transaction.
+func (tx *txn[K, V]) Delete(key K) {
+	tx.write(key, txWrite[V]{deleted: true})
+}
+
+// Has returns true if key is present as seen by the transaction.
+func (tx *txn[K, V]) Has(key K) bool {
+	tx.check()
+	if w, ok := tx.writes[key]; ok {
+		return !w.deleted
+	}
+	_, ok := tx.shard(key).data[key]
+	return ok
+}
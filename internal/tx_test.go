@@ -0,0 +1,137 @@
+package internal_test
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+func TestMapTransactionCommit(t *testing.T) {
+	m := internal.NewMap(map[string]int{"a": 1, "b": 2})
+	err := m.Transaction(func(tx internal.Tx[string, int]) error {
+		v, ok := tx.Load("a")
+		if !ok || v != 1 {
+			t.Errorf("Load(): Expected value 1, got %d", v)
+		}
+		tx.Store("a", v+10)
+		tx.Store("c", 3)
+		tx.Delete("b")
+		if v, ok := tx.Load("a"); !ok || v != 11 {
+			t.Errorf("Load(): Expected the transaction to see its own write, got %d", v)
+		}
+		if _, ok := tx.Load("b"); ok || tx.Has("b") {
+			t.Errorf("Load(): Expected the transaction to see its own delete")
+		}
+		if !tx.Has("c") || tx.Has("d") {
+			t.Errorf("Has(): Expected key c to be present and d absent")
+		}
+		tx.Delete("c")
+		tx.Store("b", 20)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Transaction(): Expected no error, got %v", err)
+	}
+	keys := m.Keys()
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Errorf("Keys(): Expected keys [a b], got %v", keys)
+	}
+	if v, _ := m.Load("a"); v != 11 {
+		t.Errorf("Load(): Expected value 11, got %d", v)
+	}
+	if v, _ := m.Load("b"); v != 20 {
+		t.Errorf("Load(): Expected value 20, got %d", v)
+	}
+}
+
+func TestMapTransactionRollback(t *testing.T) {
+	m := internal.NewMap(map[string]int{"a": 1})
+	errAbort := errors.New("abort")
+	err := m.Transaction(func(tx internal.Tx[string, int]) error {
+		tx.Store("a", 2)
+		tx.Store("b", 2)
+		return errAbort
+	})
+	if err != errAbort {
+		t.Errorf("Transaction(): Expected error %v, got %v", errAbort, err)
+	}
+	if v, _ := m.Load("a"); v != 1 || m.Has("b") {
+		t.Errorf("Transaction(): Expected changes to be discarded")
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("Transaction(): Expected panic to be propagated, got %v", r)
+			}
+		}()
+		m.Transaction(func(tx internal.Tx[string, int]) error {
+			tx.Delete("a")
+			panic("boom")
+		})
+	}()
+	if v, ok := m.Load("a"); !ok || v != 1 {
+		t.Errorf("Transaction(): Expected changes to be discarded after a panic")
+	}
+	// the lock is released after a panic.
+	m.Store("c", 3)
+}
+
+func TestMapTransactionUseAfterReturn(t *testing.T) {
+	m := internal.NewMap[string, int](nil)
+	var leaked internal.Tx[string, int]
+	m.Transaction(func(tx internal.Tx[string, int]) error {
+		leaked = tx
+		return nil
+	})
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Store(): Expected panic when using a Tx after the transaction returned")
+		}
+	}()
+	leaked.Store("a", 1)
+}
+
+func TestShardedMapTransaction(t *testing.T) {
+	m := internal.NewShardedMap[int, int](4, intHash)
+	for i := 0; i < 8; i++ {
+		m.Store(i, i)
+	}
+	// moves all values to key 100 atomically.
+	err := m.Transaction(func(tx internal.Tx[int, int]) error {
+		sum := 0
+		for i := 0; i < 8; i++ {
+			v, _ := tx.Load(i)
+			sum += v
+			tx.Delete(i)
+		}
+		tx.Store(100, sum)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Transaction(): Expected no error, got %v", err)
+	}
+	if v, _ := m.Load(100); v != 28 || m.Len() != 1 {
+		t.Errorf("Transaction(): Expected a single key with value 28, got %v", m.Keys())
+	}
+}
+
+func TestBoundedMapTransaction(t *testing.T) {
+	m := internal.NewLRUMap[int, int](2)
+	var evicted []int
+	m.OnEvict(func(key, value int) {
+		evicted = append(evicted, key)
+	})
+	m.Transaction(func(tx internal.Tx[int, int]) error {
+		tx.Store(1, 1)
+		tx.Store(2, 2)
+		tx.Store(3, 3)
+		return nil
+	})
+	if m.Len() != 2 || len(evicted) != 1 || evicted[0] != 1 {
+		t.Errorf("Transaction(): Expected key 1 to be evicted, got %v", evicted)
+	}
+}
@@ -1,38 +1,128 @@
 package internal
 
 import (
-	"reflect"
+	"context"
 	"sync"
+	"sync/atomic"
 )
 
 type Value[V any] struct {
-	_    noCopy // go vet to alert when copying by value.
-	mu   sync.RWMutex
-	set  bool
-	data V
+	_       noCopy // go vet to alert when copying by value.
+	mu      sync.RWMutex
+	set     bool
+	data    V
+	guard   guard             // detects re-entrant calls with the mutexdebug build tag.
+	waiters waitQueue         // callers of the Context methods waiting for the lock.
+	stats   *lockStats        // nil unless created with WithStats.
+	id      atomic.Uint64     // assigned by the first call to Atomically.
+	eq      func(a, b V) bool // compares values, see Options.
 }
 
 // NewValue returns a new Value.
-func NewValue[V any]() *Value[V] {
-	return &Value[V]{}
+func NewValue[V any](opts ...Option[V]) *Value[V] {
+	o := options(opts)
+	return &Value[V]{eq: o.Equal, stats: newLockStats(o.Stats)}
 }
 
 // NewWithValue returns a new Value, set to the specified value.
-func NewWithValue[V any](v V) *Value[V] {
-	return &Value[V]{data: v, set: true}
+func NewWithValue[V any](v V, opts ...Option[V]) *Value[V] {
+	o := options(opts)
+	return &Value[V]{data: v, set: true, eq: o.Equal, stats: newLockStats(o.Stats)}
+}
+
+// NewComparableValue returns a new Value whose values are compared with ==.
+func NewComparableValue[V comparable]() *Value[V] {
+	return NewValue(WithEqual(comparableEqual[V]))
+}
+
+// lock locks the value for writing.
+func (m *Value[V]) lock() {
+	m.guard.check()
+	if m.stats == nil {
+		m.mu.Lock()
+	} else {
+		m.stats.lock(&m.mu)
+	}
+	m.guard.acquire()
+}
+
+// lockContext locks the value for writing, giving up once ctx is done. See waitQueue.lockContext.
+func (m *Value[V]) lockContext(ctx context.Context) error {
+	m.guard.check()
+	if m.stats == nil {
+		if err := m.waiters.lockContext(ctx, m.mu.TryLock, m.mu.Lock, m.mu.Unlock); err != nil {
+			return err
+		}
+	} else if err := m.stats.lockContext(ctx, &m.mu, &m.waiters); err != nil {
+		return err
+	}
+	m.guard.acquire()
+	return nil
+}
+
+// tryLock locks the value for writing if it is not locked, it returns false without waiting otherwise.
+func (m *Value[V]) tryLock() bool {
+	if m.stats == nil {
+		if !m.mu.TryLock() {
+			return false
+		}
+	} else if !m.stats.tryLock(&m.mu) {
+		return false
+	}
+	m.guard.acquire()
+	return true
+}
+
+// unlock unlocks the value locked by lock, lockContext or tryLock.
+func (m *Value[V]) unlock() {
+	m.guard.release()
+	if m.stats != nil {
+		m.stats.unlock()
+	}
+	m.mu.Unlock()
+}
+
+// rlock locks the value for reading, the returned time must be passed to runlock.
+func (m *Value[V]) rlock() (held int64) {
+	m.guard.check()
+	if m.stats == nil {
+		m.mu.RLock()
+		return 0
+	}
+	return m.stats.rlock(&m.mu)
+}
+
+// runlock unlocks the value locked by rlock at held.
+func (m *Value[V]) runlock(held int64) {
+	if m.stats != nil {
+		m.stats.runlock(held)
+	}
+	m.mu.RUnlock()
+}
+
+// equal reports whether a and b are equal, using the function set by the constructor.
+func (m *Value[V]) equal(a, b V) bool {
+	if m.eq == nil {
+		return deepEqual(a, b)
+	}
+	return m.eq(a, b)
 }
 
 // Load returns the value stored, ok indicates whether value was previously set.
 func (m *Value[V]) Load() (v V, ok bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	defer m.runlock(m.rlock())
 	return m.data, m.set
 }
 
 // Store sets the value.
 func (m *Value[V]) Store(value V) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.lock()
+	defer m.unlock()
+	m.store(value)
+}
+
+// store implements Store, the caller must hold the write lock.
+func (m *Value[V]) store(value V) {
 	m.data = value
 	m.set = true
 }
@@ -40,21 +130,25 @@ func (m *Value[V]) Store(value V) {
 // LoadOrStore returns the existing value if present. Otherwise, it stores and returns the given value.
 // The loaded result is true if the value was loaded, false if stored.
 func (m *Value[V]) LoadOrStore(value V) (actual V, loaded bool) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.lock()
+	defer m.unlock()
+	return m.loadOrStore(value)
+}
+
+// loadOrStore implements LoadOrStore, the caller must hold the write lock.
+func (m *Value[V]) loadOrStore(value V) (actual V, loaded bool) {
 	if m.set {
 		return m.data, true
 	}
-	m.data = value
-	m.set = true
+	m.store(value)
 	return value, false
 }
 
 // Swap swaps the value for a key and returns the previous value if any.
 // The loaded result reports whether the key was present.
 func (m *Value[V]) Swap(value V) (previous V, loaded bool) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.lock()
+	defer m.unlock()
 	previous = m.data
 	loaded = m.set
 	m.data = value
@@ -63,10 +157,11 @@ func (m *Value[V]) Swap(value V) (previous V, loaded bool) {
 }
 
 // CompareAndSwap swaps the old and new values if the value stored in the map is equal to old.
+// Values are compared with the Equal option, see Options.
 func (m *Value[V]) CompareAndSwap(old, new V) bool {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	if m.set && reflect.DeepEqual(m.data, old) {
+	m.lock()
+	defer m.unlock()
+	if m.set && m.equal(m.data, old) {
 		m.data = new
 		return true
 	}
@@ -75,24 +170,27 @@ func (m *Value[V]) CompareAndSwap(old, new V) bool {
 
 // IsZero returns true if the value is a zero value (not set). It relies on the set flag.
 func (m *Value[V]) IsZero() bool {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	defer m.runlock(m.rlock())
 	return !m.set
 }
 
 // Exclusive executes the function f exclusively, ensuring that no other goroutine is accessing the value.
 func (m *Value[V]) Exclusive(update func(actual V, loaded bool) V) (updated V) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.data = update(m.data, m.set)
-	m.set = true
+	m.lock()
+	defer m.unlock()
+	return m.exclusive(update)
+}
+
+// exclusive implements Exclusive, the caller must hold the write lock.
+func (m *Value[V]) exclusive(update func(actual V, loaded bool) V) V {
+	m.store(update(m.data, m.set))
 	return m.data
 }
 
 // Clear set the value with the zero value and set flag to false.
 func (m *Value[V]) Clear() {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	m.lock()
+	defer m.unlock()
 	var zero V
 	m.data = zero
 	m.set = false
@@ -0,0 +1,293 @@
+package internal
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Op is the operation that changed a key of a Map.
+type Op uint8
+
+const (
+	OpStore          Op = iota + 1 // the key was set by Store or LoadOrStore.
+	OpSwap                         // the key was set by Swap.
+	OpCompareAndSwap               // the key was set by CompareAndSwap.
+	OpUpdate                       // the key was set by Update.
+	OpUpdateRange                  // the key was set by UpdateRange.
+	OpDelete                       // the key was removed by Delete, LoadAndDelete or CompareAndDelete.
+	OpClear                        // the key was removed by Clear.
+	OpEvict                        // the key was removed by the map itself, for instance by an eviction policy.
+	OpExclusive                    // the key was set or removed within Exclusive.
+	OpCompute                      // the key was set or removed by ComputeIfAbsent, ComputeIfPresent or Compute.
+	OpMerge                        // the key was set by Merge.
+)
+
+// String returns the name of the operation.
+func (op Op) String() string {
+	switch op {
+	case OpStore:
+		return "Store"
+	case OpSwap:
+		return "Swap"
+	case OpCompareAndSwap:
+		return "CompareAndSwap"
+	case OpUpdate:
+		return "Update"
+	case OpUpdateRange:
+		return "UpdateRange"
+	case OpDelete:
+		return "Delete"
+	case OpClear:
+		return "Clear"
+	case OpEvict:
+		return "Evict"
+	case OpExclusive:
+		return "Exclusive"
+	case OpCompute:
+		return "Compute"
+	case OpMerge:
+		return "Merge"
+	}
+	return "Unknown"
+}
+
+// Event describes a change to a key of a Map.
+type Event[K comparable, V any] struct {
+	Op  Op
+	Key K
+	// Old is the value of the key before the change, it is valid only if Loaded is true.
+	Old    V
+	Loaded bool
+	// New is the value of the key after the change, it is valid only if Deleted is false.
+	New     V
+	Deleted bool
+}
+
+// WatchPolicy defines what happens to the events of a subscriber whose channel is full.
+type WatchPolicy uint8
+
+const (
+	// WatchDrop discards the events that do not fit in the channel buffer, writers are never blocked.
+	WatchDrop WatchPolicy = iota
+	// WatchBlock blocks the writer, while it holds the map lock, until the event is received or the subscription is cancelled.
+	// A slow subscriber therefore stalls every writer of the map, and the readers queued behind them.
+	WatchBlock
+	// WatchCoalesce queues the events that do not fit in the channel buffer, merging the events of the same key:
+	// the merged event keeps the oldest Old value and the latest Op and New value. Events are sent unmerged while
+	// the buffer has room and no queued event waits to be sent, the order of the events is kept. Writers are never blocked.
+	WatchCoalesce
+)
+
+// WatchOptions configures a subscription.
+type WatchOptions struct {
+	// Buffer is the capacity of the subscription channel, defaults to 16.
+	Buffer int
+	// Policy is applied when the subscription channel is full, defaults to WatchDrop.
+	Policy WatchPolicy
+}
+
+// WatchOption is a function that configures a subscription.
+type WatchOption func(*WatchOptions)
+
+// WithWatchBuffer sets the capacity of the subscription channel, n less than zero is treated as zero.
+func WithWatchBuffer(n int) WatchOption {
+	return func(o *WatchOptions) {
+		o.Buffer = max(n, 0)
+	}
+}
+
+// WithWatchPolicy sets the policy applied when the subscription channel is full.
+func WithWatchPolicy(policy WatchPolicy) WatchOption {
+	return func(o *WatchOptions) {
+		o.Policy = policy
+	}
+}
+
+// watchHub dispatches the events of a map to its subscribers.
+type watchHub[K comparable, V any] struct {
+	n    atomic.Int32 // number of subscribers, allows notify to return early.
+	mu   sync.Mutex
+	subs map[sink[K, V]]struct{}
+}
+
+// newWatchHub returns a hub without subscribers.
+func newWatchHub[K comparable, V any]() *watchHub[K, V] {
+	return &watchHub[K, V]{subs: make(map[sink[K, V]]struct{})}
+}
+
+// sink is a subscriber as seen by the hub, whatever the element type of its channel.
+type sink[K comparable, V any] interface {
+	// deliver sends e to the subscriber if it watches e.Key, according to its policy.
+	deliver(e Event[K, V])
+}
+
+// subscriber is a subscription to the events of a single key or of all keys, delivered on a channel of E.
+type subscriber[K comparable, V any, E any] struct {
+	ctx     context.Context
+	key     K
+	all     bool
+	policy  WatchPolicy
+	ch      chan E
+	convert func(Event[K, V]) E
+	mu      sync.Mutex // guards pending, index and sending, used by WatchCoalesce only.
+	pending []Event[K, V]
+	index   map[K]int
+	sending bool // true while serve sends the events taken from pending.
+	wake    chan struct{}
+}
+
+// Watcher is a map whose changes can be watched, see WatchAs.
+type Watcher[K comparable, V any] interface {
+	hub() *watchHub[K, V]
+}
+
+// WatchAs is the same as Watch, or WatchAll if all is true, but the events are converted by convert before they
+// are sent, so that the channel can carry a type of another package.
+func WatchAs[K comparable, V any, E any](w Watcher[K, V], ctx context.Context, key K, all bool, convert func(Event[K, V]) E, opts ...WatchOption) <-chan E {
+	return watch(w.hub(), ctx, key, all, convert, opts)
+}
+
+// event returns e, it is the conversion used by Watch and WatchAll.
+func event[K comparable, V any](e Event[K, V]) Event[K, V] {
+	return e
+}
+
+// watch adds a subscription to h, the subscription is removed and its channel closed when ctx is done.
+func watch[K comparable, V any, E any](h *watchHub[K, V], ctx context.Context, key K, all bool, convert func(Event[K, V]) E, opts []WatchOption) <-chan E {
+	o := WatchOptions{Buffer: 16}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	s := &subscriber[K, V, E]{
+		ctx:     ctx,
+		key:     key,
+		all:     all,
+		policy:  o.Policy,
+		ch:      make(chan E, o.Buffer),
+		convert: convert,
+	}
+	if ctx.Err() != nil {
+		close(s.ch)
+		return s.ch
+	}
+	if s.policy == WatchCoalesce {
+		s.index = make(map[K]int)
+		s.wake = make(chan struct{}, 1)
+	}
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.n.Add(1)
+	h.mu.Unlock()
+	go s.serve(h)
+	return s.ch
+}
+
+// serve delivers the coalesced events of s, and removes s from h once its context is done.
+func (s *subscriber[K, V, E]) serve(h *watchHub[K, V]) {
+	defer close(s.ch)
+	defer h.remove(s)
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.wake:
+			for _, e := range s.take() {
+				select {
+				case s.ch <- s.convert(e):
+				case <-s.ctx.Done():
+					return
+				}
+			}
+			s.mu.Lock()
+			s.sending = false
+			s.mu.Unlock()
+		}
+	}
+}
+
+// remove removes s from the hub, once remove returns no event is sent to s.
+func (h *watchHub[K, V]) remove(s sink[K, V]) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, s)
+	h.n.Add(-1)
+}
+
+// active returns true if the hub has subscribers.
+func (h *watchHub[K, V]) active() bool {
+	return h.n.Load() > 0
+}
+
+// notify sends e to the subscribers watching e.Key.
+func (h *watchHub[K, V]) notify(e Event[K, V]) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		s.deliver(e)
+	}
+}
+
+func (s *subscriber[K, V, E]) deliver(e Event[K, V]) {
+	if !s.all && s.key != e.Key {
+		return
+	}
+	switch s.policy {
+	case WatchBlock:
+		select {
+		case s.ch <- s.convert(e):
+		case <-s.ctx.Done():
+		}
+	case WatchCoalesce:
+		s.coalesce(e)
+	default:
+		select {
+		case s.ch <- s.convert(e):
+		default:
+		}
+	}
+}
+
+// coalesce sends e if it fits in the channel buffer and no earlier event waits to be sent, so that events are
+// only merged once the buffer is full. Otherwise e is queued by push, after the events already waiting.
+func (s *subscriber[K, V, E]) coalesce(e Event[K, V]) {
+	s.mu.Lock()
+	if len(s.pending) == 0 && !s.sending {
+		select {
+		case s.ch <- s.convert(e):
+			s.mu.Unlock()
+			return
+		default:
+		}
+	}
+	s.mu.Unlock()
+	s.push(e)
+}
+
+// push queues e, merging it with the pending event of the same key if any.
+func (s *subscriber[K, V, E]) push(e Event[K, V]) {
+	s.mu.Lock()
+	if i, ok := s.index[e.Key]; ok {
+		p := &s.pending[i]
+		p.Op, p.New, p.Deleted = e.Op, e.New, e.Deleted
+	} else {
+		s.index[e.Key] = len(s.pending)
+		s.pending = append(s.pending, e)
+	}
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take returns and clears the pending events.
+func (s *subscriber[K, V, E]) take() []Event[K, V] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := s.pending
+	s.pending = nil
+	s.sending = len(pending) > 0
+	clear(s.index)
+	return pending
+}
@@ -0,0 +1,332 @@
+package internal_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+// receive returns the next event from ch, failing the test if none is received in time.
+func receive[K comparable, V any](t *testing.T, ch <-chan internal.Event[K, V]) internal.Event[K, V] {
+	t.Helper()
+	select {
+	case e, ok := <-ch:
+		if !ok {
+			t.Fatalf("Expected an event, channel is closed")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected an event, got none")
+	}
+	return internal.Event[K, V]{}
+}
+
+// expectClosed fails the test if ch is not closed in time.
+func expectClosed[K comparable, V any](t *testing.T, ch <-chan internal.Event[K, V]) {
+	t.Helper()
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected the channel to be closed")
+		}
+	}
+}
+
+func TestMapWatchOps(t *testing.T) {
+	m := internal.NewMap[string, int](nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := m.WatchAll(ctx, internal.WithWatchBuffer(32))
+
+	m.Store("a", 1)
+	m.Swap("a", 2)
+	m.CompareAndSwap("a", 2, 3)
+	m.Update("a", func(v int, ok bool) int { return v + 1 })
+	m.UpdateRange(func(k string, v int) (int, bool) { return v + 1, true })
+	m.LoadOrStore("b", 1)
+	m.LoadOrStore("b", 2) // loaded, no event.
+	m.Delete("a")
+	m.Delete("a") // absent, no event.
+	m.Store("c", 1)
+	m.Clear()
+
+	expected := []internal.Event[string, int]{
+		{Op: internal.OpStore, Key: "a", New: 1},
+		{Op: internal.OpSwap, Key: "a", Old: 1, Loaded: true, New: 2},
+		{Op: internal.OpCompareAndSwap, Key: "a", Old: 2, Loaded: true, New: 3},
+		{Op: internal.OpUpdate, Key: "a", Old: 3, Loaded: true, New: 4},
+		{Op: internal.OpUpdateRange, Key: "a", Old: 4, Loaded: true, New: 5},
+		{Op: internal.OpStore, Key: "b", New: 1},
+		{Op: internal.OpDelete, Key: "a", Old: 5, Loaded: true, Deleted: true},
+		{Op: internal.OpStore, Key: "c", New: 1},
+	}
+	for i, want := range expected {
+		if got := receive(t, ch); got != want {
+			t.Errorf("WatchAll(): Expected event %d to be %+v, got %+v", i, want, got)
+		}
+	}
+	// Clear reports the keys in random order.
+	cleared := map[string]int{}
+	for i := 0; i < 2; i++ {
+		e := receive(t, ch)
+		if e.Op != internal.OpClear || !e.Deleted || !e.Loaded {
+			t.Errorf("Clear(): Expected a Clear event, got %+v", e)
+		}
+		cleared[e.Key] = e.Old
+	}
+	if cleared["b"] != 1 || cleared["c"] != 1 {
+		t.Errorf("Clear(): Expected keys b and c to be cleared, got %v", cleared)
+	}
+	cancel()
+	expectClosed(t, ch)
+}
+
+func TestMapWatchKey(t *testing.T) {
+	m := internal.NewMap[string, int](nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := m.Watch(ctx, "a")
+	m.Store("b", 1)
+	m.Store("a", 1)
+	m.CompareAndDelete("a", 1)
+	if e := receive(t, ch); e.Key != "a" || e.Op != internal.OpStore {
+		t.Errorf("Watch(): Expected Store event for key a, got %+v", e)
+	}
+	if e := receive(t, ch); e.Key != "a" || e.Op != internal.OpDelete {
+		t.Errorf("Watch(): Expected Delete event for key a, got %+v", e)
+	}
+	cancel()
+	expectClosed(t, ch)
+	// the map keeps working once the subscription is released.
+	m.Store("a", 2)
+
+	// a subscription with a done context is closed immediately.
+	ch = m.Watch(ctx, "a")
+	expectClosed(t, ch)
+}
+
+func TestMapWatchExclusive(t *testing.T) {
+	m := internal.NewMap[string, int](map[string]int{"a": 1, "b": 2, "c": 3})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := m.WatchAll(ctx)
+	m.Exclusive(func(data map[string]int) {
+		delete(data, "a")
+		data["b"] = 20
+		data["d"] = 4
+	})
+	got := map[string]internal.Event[string, int]{}
+	for i := 0; i < 3; i++ {
+		e := receive(t, ch)
+		got[e.Key] = e
+	}
+	want := map[string]internal.Event[string, int]{
+		"a": {Op: internal.OpExclusive, Key: "a", Old: 1, Loaded: true, Deleted: true},
+		"b": {Op: internal.OpExclusive, Key: "b", Old: 2, Loaded: true, New: 20},
+		"d": {Op: internal.OpExclusive, Key: "d", New: 4},
+	}
+	for key, e := range want {
+		if got[key] != e {
+			t.Errorf("Exclusive(): Expected event %+v, got %+v", e, got[key])
+		}
+	}
+	select {
+	case e := <-ch:
+		t.Errorf("Exclusive(): Expected unchanged key c not to be reported, got %+v", e)
+	default:
+	}
+}
+
+func TestMapWatchPolicies(t *testing.T) {
+	t.Run("drop", func(t *testing.T) {
+		m := internal.NewMap[int, int](nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		ch := m.WatchAll(ctx, internal.WithWatchBuffer(2))
+		for i := 0; i < 10; i++ {
+			m.Store(i, i)
+		}
+		if e := receive(t, ch); e.Key != 0 {
+			t.Errorf("Expected event for key 0, got %+v", e)
+		}
+		if e := receive(t, ch); e.Key != 1 {
+			t.Errorf("Expected event for key 1, got %+v", e)
+		}
+		select {
+		case e := <-ch:
+			t.Errorf("Expected events to be dropped, got %+v", e)
+		default:
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		m := internal.NewMap[int, int](nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		ch := m.WatchAll(ctx, internal.WithWatchBuffer(0), internal.WithWatchPolicy(internal.WatchBlock))
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 10; i++ {
+				m.Store(i, i)
+			}
+		}()
+		for i := 0; i < 10; i++ {
+			if e := receive(t, ch); e.Key != i {
+				t.Errorf("Expected event for key %d, got %+v", i, e)
+			}
+		}
+		<-done
+
+		// cancelling the subscription releases a blocked writer.
+		blocked := make(chan struct{})
+		go func() {
+			defer close(blocked)
+			m.Store(10, 10)
+		}()
+		cancel()
+		select {
+		case <-blocked:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected the writer to be released")
+		}
+		expectClosed(t, ch)
+	})
+
+	t.Run("coalesce", func(t *testing.T) {
+		m := internal.NewMap[int, int](nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		ch := m.WatchAll(ctx, internal.WithWatchBuffer(0), internal.WithWatchPolicy(internal.WatchCoalesce))
+		m.Store(1, 1)
+		// waits for the first event to be pending on the channel.
+		time.Sleep(50 * time.Millisecond)
+		for i := 2; i <= 10; i++ {
+			m.Store(1, i)
+			m.Store(2, i)
+		}
+		m.Delete(2)
+		if e := receive(t, ch); e.New != 1 {
+			t.Errorf("Expected first event to be delivered, got %+v", e)
+		}
+		got := map[int]internal.Event[int, int]{}
+		for len(got) < 2 {
+			e := receive(t, ch)
+			if prev, ok := got[e.Key]; ok {
+				// the events may have been split in two batches.
+				e.Old, e.Loaded = prev.Old, prev.Loaded
+			}
+			got[e.Key] = e
+		}
+		if e := got[1]; e.Old != 1 || e.New != 10 || e.Op != internal.OpStore {
+			t.Errorf("Expected key 1 events to be merged, got %+v", e)
+		}
+		if e := got[2]; e.Loaded || !e.Deleted || e.Op != internal.OpDelete {
+			t.Errorf("Expected key 2 events to be merged, got %+v", e)
+		}
+		cancel()
+		expectClosed(t, ch)
+	})
+
+	t.Run("coalesce buffered", func(t *testing.T) {
+		m := internal.NewMap[int, int](nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		ch := m.WatchAll(ctx, internal.WithWatchBuffer(2), internal.WithWatchPolicy(internal.WatchCoalesce))
+		// the events fitting in the buffer are not merged, the others are queued after them.
+		for i := 1; i <= 5; i++ {
+			m.Store(1, i)
+		}
+		for i := 1; i <= 2; i++ {
+			if e := receive(t, ch); e.New != i || e.Old != i-1 {
+				t.Errorf("Expected event %d to be delivered as is, got %+v", i, e)
+			}
+		}
+		if e := receive(t, ch); e.Old != 2 || e.New != 5 {
+			t.Errorf("Expected the queued events to be merged, got %+v", e)
+		}
+		m.Store(2, 1)
+		m.Store(2, 2)
+		for i := 1; i <= 2; i++ {
+			if e := receive(t, ch); e.Key != 2 || e.New != i {
+				t.Errorf("Expected event %d of key 2 to be delivered as is, got %+v", i, e)
+			}
+		}
+		cancel()
+		expectClosed(t, ch)
+	})
+}
+
+func TestShardedMapWatch(t *testing.T) {
+	m := internal.NewShardedMap[int, int](4, intHash)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	all := m.WatchAll(ctx, internal.WithWatchBuffer(64))
+	one := m.Watch(ctx, 3)
+	for i := 0; i < 8; i++ {
+		m.Store(i, i)
+	}
+	m.UpdateRange(func(k, v int) (int, bool) { return v, true })
+	m.Exclusive(func(data map[int]int) {
+		delete(data, 0)
+		data[3] = 30
+	})
+	m.Clear()
+
+	counts := map[internal.Op]int{}
+	for i := 0; i < 8+8+2+7; i++ {
+		counts[receive(t, all).Op]++
+	}
+	if counts[internal.OpStore] != 8 || counts[internal.OpUpdateRange] != 8 || counts[internal.OpExclusive] != 2 || counts[internal.OpClear] != 7 {
+		t.Errorf("WatchAll(): Unexpected events %v", counts)
+	}
+	for _, op := range []internal.Op{internal.OpStore, internal.OpUpdateRange, internal.OpExclusive, internal.OpClear} {
+		if e := receive(t, one); e.Key != 3 || e.Op != op {
+			t.Errorf("Watch(): Expected %v event for key 3, got %+v", op, e)
+		}
+	}
+}
+
+func TestBoundedMapWatch(t *testing.T) {
+	m := internal.NewLRUMap[int, int](1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := m.WatchAll(ctx)
+	m.Store(1, 1)
+	m.Store(2, 2)
+	want := []internal.Event[int, int]{
+		{Op: internal.OpStore, Key: 1, New: 1},
+		{Op: internal.OpStore, Key: 2, New: 2},
+		{Op: internal.OpEvict, Key: 1, Old: 1, Loaded: true, Deleted: true},
+	}
+	for _, e := range want {
+		if got := receive(t, ch); got != e {
+			t.Errorf("Expected event %+v, got %+v", e, got)
+		}
+	}
+}
+
+func TestOpString(t *testing.T) {
+	ops := map[internal.Op]string{
+		internal.OpStore:          "Store",
+		internal.OpSwap:           "Swap",
+		internal.OpCompareAndSwap: "CompareAndSwap",
+		internal.OpUpdate:         "Update",
+		internal.OpUpdateRange:    "UpdateRange",
+		internal.OpDelete:         "Delete",
+		internal.OpClear:          "Clear",
+		internal.OpEvict:          "Evict",
+		internal.OpExclusive:      "Exclusive",
+		internal.Op(0):            "Unknown",
+	}
+	for op, name := range ops {
+		if op.String() != name {
+			t.Errorf("String(): Expected %q, got %q", name, op.String())
+		}
+	}
+}
@@ -1,9 +1,16 @@
 package mutex
 
-import "github.com/thetechpanda/mutex/internal"
+import (
+	"context"
+	"iter"
+
+	"github.com/thetechpanda/mutex/internal"
+)
 
 // Map is a generic interface that provides a way to interact with the map.
-// its interface is identical to sync.Map and so are function definition and behaviour.
+// It includes the methods of sync.Map, with the same definitions and behaviour but typed keys and values,
+// and extends them with locked updates (Update, UpdateRange, Exclusive, Compute), non-blocking (Try) and
+// Context variants, bulk operations, iterators, transactions, watches, snapshots and clones.
 type Map[K comparable, V any] interface {
 	// Load returns the value stored in the map for a key, or nil if no
 	// value is present.
@@ -28,14 +35,15 @@ type Map[K comparable, V any] interface {
 	//
 	// Returns true if the swap was performed.
 	//
-	// ! this function uses reflect.DeepEqual to compare the values.
+	// Values are compared with the function set by WithEqual, by default with == if V holds no pointer,
+	// interface, map, slice, channel or function, and with reflect.DeepEqual otherwise.
 	CompareAndSwap(key K, old, new V) bool
 	// CompareAndDelete deletes the entry for key if its value is equal to old.
 	//
 	// If there is no current value for key in the map, CompareAndDelete
 	// returns false (even if the old value is the nil interface value).
 	//
-	// ! this function uses reflect.DeepEqual to compare the values.
+	// Values are compared as in CompareAndSwap.
 	CompareAndDelete(key K, old V) (deleted bool)
 	// Range calls f sequentially for each key and value present in the map.
 	// If f returns false, range stops the iteration.
@@ -58,12 +66,97 @@ type Map[K comparable, V any] interface {
 	//
 	// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
 	UpdateRange(f func(K, V) (V, bool))
+	// ComputeIfAbsent returns the value for key if present, otherwise it stores and returns the value returned by f.
+	// f is called only if the key is not present. The loaded result is true if the value was loaded, false if computed.
+	//
+	// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+	ComputeIfAbsent(key K, f func() V) (actual V, loaded bool)
+	// ComputeIfPresent calls f with the value for key if present, and stores the value returned by f if keep is true
+	// or removes the key otherwise. f is not called if the key is not present.
+	// It returns the value for key once f returns, ok is false if the key is not present.
+	//
+	// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+	ComputeIfPresent(key K, f func(V) (value V, keep bool)) (value V, ok bool)
+	// Compute calls f with the value for key, loaded reporting whether the key is present. Depending on the
+	// ComputeOp returned by f, the entry is left unchanged, the value returned by f is stored or the key is removed.
+	// It returns the value for key once f returns, ok is false if the key is not present.
+	//
+	// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+	Compute(key K, f func(value V, loaded bool) (V, ComputeOp)) (value V, ok bool)
+	// Merge stores value for key if the key is not present, otherwise it stores the value returned by f called
+	// with the current value and value. It returns the value stored.
+	//
+	// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+	Merge(key K, value V, f func(old, new V) V) V
 	// Exclusive provides a way to perform  operations on the map ensuring that no other operation is performed on the map during the execution of the function.
 	//
 	// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
 	Exclusive(f func(m map[K]V))
+	// StoreContext is the same as Store but returns ctx.Err(), without acquiring the lock, if ctx is done before the lock is acquired.
+	//
+	// The Context methods queue for the lock like the methods without a context, new readers wait behind them.
+	// While the lock is busy a single goroutine per lock, or per shard lock, waits for it on behalf of the callers, a caller giving up leaves nothing behind.
+	StoreContext(ctx context.Context, key K, value V) error
+	// LoadOrStoreContext is the same as LoadOrStore but returns ctx.Err() if ctx is done before the lock is acquired.
+	LoadOrStoreContext(ctx context.Context, key K, value V) (actual V, loaded bool, err error)
+	// UpdateContext is the same as Update but returns ctx.Err() if ctx is done before the lock is acquired.
+	//
+	// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+	UpdateContext(ctx context.Context, key K, f func(V, bool) V) error
+	// ExclusiveContext is the same as Exclusive but returns ctx.Err() if ctx is done before the lock is acquired.
+	//
+	// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+	ExclusiveContext(ctx context.Context, f func(m map[K]V)) error
+	// TryLoad is the same as Load but returns immediately if the map is write locked, acquired reports whether Load ran.
+	TryLoad(key K) (v V, ok bool, acquired bool)
+	// TryStore is the same as Store but returns false immediately, without storing value, if the map is locked.
+	TryStore(key K, value V) bool
+	// TryUpdate is the same as Update but returns false immediately, without calling f, if the map is locked.
+	//
+	// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+	TryUpdate(key K, f func(V, bool) V) bool
+	// TryExclusive is the same as Exclusive but returns false immediately, without calling f, if the map is locked.
+	//
+	// ! Do not invoke any Map functions within 'f' to prevent a deadlock.
+	TryExclusive(f func(m map[K]V)) bool
+	// Transaction runs f with a Tx buffering its changes, the changes are applied atomically if f returns nil
+	// and discarded if f returns an error or panics, in which case the error is returned or the panic propagated.
+	// The map is locked for the duration of the transaction. Committed changes are reported to the subscribers
+	// as Store and Delete events.
+	//
+	// ! Do not invoke any Map functions within 'f' to prevent a deadlock, use tx instead.
+	Transaction(f func(tx Tx[K, V]) error) error
 	// Clear removes all items from the map.
 	Clear()
+	// StoreMany sets the values of all the keys in entries, the map is locked once.
+	StoreMany(entries map[K]V)
+	// LoadMany returns the values of the keys present in the map, keys not present are omitted.
+	// The map is read locked once.
+	LoadMany(keys []K) map[K]V
+	// DeleteMany removes keys from the map and returns the number of keys removed, the map is locked once.
+	DeleteMany(keys []K) (n int)
+	// Replace replaces the content of the map with a copy of data and returns the previous content.
+	// Replaced keys are reported to the subscribers as Store events, removed keys as Delete events.
+	Replace(data map[K]V) (old map[K]V)
+	// DeleteIf removes the entries for which pred returns true and returns the number of entries removed.
+	// The map is locked while pred is called, removed keys are reported to the subscribers as Delete events.
+	//
+	// ! Do not invoke any Map functions within 'pred' to prevent a deadlock.
+	DeleteIf(pred func(K, V) bool) (n int)
+	// RetainIf removes the entries for which pred returns false and returns the number of entries removed.
+	// The map is locked while pred is called, removed keys are reported to the subscribers as Delete events.
+	//
+	// ! Do not invoke any Map functions within 'pred' to prevent a deadlock.
+	RetainIf(pred func(K, V) bool) (n int)
+	// Drain removes all items from the map and returns them atomically, the removed keys are reported
+	// to the subscribers as Clear events.
+	Drain() map[K]V
+	// String returns the JSON encoding of the map, the map is read locked while it is encoded.
+	// It implements expvar.Var, see PublishMap.
+	String() string
+	// Stats returns the lock activity of the map since its creation, it returns zero unless the map
+	// was created with WithStats. The Stats of a sharded map add up the activity of its shards.
+	Stats() Stats
 	// Has returns true if the map contains the key.
 	Has(key K) bool
 	// Keys returns a slice of all the keys present in the map, an empty slice is returned if the map is empty.
@@ -72,17 +165,179 @@ type Map[K comparable, V any] interface {
 	Values() (values []V)
 	// Entries returns two slices, one containing all the keys and the other containing all the values present in the map.
 	Entries() (keys []K, values []V)
+	// Snapshot returns a copy of the content of the map taken under a single read lock, values are copied with the
+	// function set by WithCopy, if any. Unlike Entries it returns a map, and unlike Exclusive the map can be kept and
+	// modified freely. A copy-on-write map returns a copy of its published content without locking.
+	Snapshot() map[K]V
+	// Clone returns a new, independent Map holding a Snapshot of the map, with its Equal and Copy options,
+	// recording lock statistics if the map does. The clone of a sharded, copy-on-write, bounded or persistent map
+	// is a plain Map, the clone of an OrderedMap is an OrderedMap with the same order.
+	Clone() Map[K, V]
 	// Len returns the number of unique keys in the map.
 	Len() (n int)
+	// All returns an iterator over the key-value pairs in the map, to be used with range-over-func.
+	//
+	// Unlike Range, All does not copy the map: the map is read locked while the loop runs and the lock is
+	// released when the loop ends or is broken out of.
+	//
+	// ! Do not invoke any Map functions within the loop body to prevent a deadlock.
+	All() iter.Seq2[K, V]
+	// KeysSeq returns an iterator over the keys in the map, it follows the same locking rules as All.
+	//
+	// ! Do not invoke any Map functions within the loop body to prevent a deadlock.
+	KeysSeq() iter.Seq[K]
+	// ValuesSeq returns an iterator over the values in the map, it follows the same locking rules as All.
+	//
+	// ! Do not invoke any Map functions within the loop body to prevent a deadlock.
+	ValuesSeq() iter.Seq[V]
+	// Watch returns a channel receiving an Event every time key is stored, swapped, updated or deleted, including
+	// by Clear and within Exclusive. The subscription is removed and the channel closed once ctx is done,
+	// ctx must be cancelled to release the subscription.
+	//
+	// By default the channel has a buffer of 16 events and events that do not fit are dropped,
+	// see WithWatchBuffer and WithWatchPolicy.
+	Watch(ctx context.Context, key K, opts ...WatchOption) <-chan Event[K, V]
+	// WatchAll is the same as Watch but reports the changes to any key.
+	WatchAll(ctx context.Context, opts ...WatchOption) <-chan Event[K, V]
+}
+
+// Tx is the view of a Map within Transaction, changes are buffered and applied to the map only when the
+// transaction commits. A Tx must not be used once the transaction function returns.
+type Tx[K comparable, V any] interface {
+	// Load returns the value for key as seen by the transaction, including its own changes.
+	Load(key K) (v V, ok bool)
+	// Store sets the value for key within the transaction.
+	Store(key K, value V)
+	// Delete removes key within the transaction.
+	Delete(key K)
+	// Has returns true if key is present as seen by the transaction.
+	Has(key K) bool
 }
 
+// transaction returns f as a transaction function of the internal package.
+func transaction[K comparable, V any](f func(tx Tx[K, V]) error) func(tx internal.Tx[K, V]) error {
+	return func(tx internal.Tx[K, V]) error {
+		return f(tx)
+	}
+}
+
+// ComputeOp is the action taken by Compute on the key once its function returns.
+type ComputeOp = internal.ComputeOp
+
+const (
+	ComputeKeep   = internal.ComputeKeep   // the entry is left unchanged, the returned value is ignored.
+	ComputeStore  = internal.ComputeStore  // the returned value is stored.
+	ComputeDelete = internal.ComputeDelete // the key is removed, the returned value is ignored.
+)
+
 // NewMap returns an empty Mutex Map.
-func NewMap[K comparable, V any]() Map[K, V] {
-	return internal.NewMap[K, V](nil)
+func NewMap[K comparable, V any](opts ...Option[V]) Map[K, V] {
+	return &plainMap[K, V]{internal.NewMap[K, V](nil, options(opts)...)}
 }
 
 // NewMapWithValue returns a Mutex Map with the provided map.
 // m is copied into the Mutex Map.
-func NewMapWithValue[K comparable, V any](m map[K]V) Map[K, V] {
-	return internal.NewMap(m)
+func NewMapWithValue[K comparable, V any](m map[K]V, opts ...Option[V]) Map[K, V] {
+	return &plainMap[K, V]{internal.NewMap(m, options(opts)...)}
+}
+
+// NewMapFromSeq returns a Mutex Map holding the key-value pairs yielded by seq.
+// If a key is yielded more than once the last value is kept.
+func NewMapFromSeq[K comparable, V any](seq iter.Seq2[K, V], opts ...Option[V]) Map[K, V] {
+	return &plainMap[K, V]{internal.NewMapFromSeq(seq, options(opts)...)}
+}
+
+// NewComparableMap returns a Mutex Map with a copy of m, m may be nil.
+// Values must be comparable and are compared with == by CompareAndSwap and CompareAndDelete.
+func NewComparableMap[K comparable, V comparable](m map[K]V) Map[K, V] {
+	return &plainMap[K, V]{internal.NewComparableMap(m)}
+}
+
+// NewShardedMap returns an empty Mutex Map that splits its keys across n independently locked shards.
+// hash is used to assign each key to a shard, it must be safe for concurrent use and return the same value for the same key.
+//
+// Single key operations only lock the shard owning the key, while Len, Keys, Values, Entries, Clear, UpdateRange
+// and Exclusive lock every shard and therefore see a consistent state of the map. Range visits a snapshot of one shard at a time.
+//
+// NewShardedMap panics if hash is nil.
+func NewShardedMap[K comparable, V any](n int, hash func(K) uint64, opts ...Option[V]) Map[K, V] {
+	return &shardedMap[K, V]{internal.NewShardedMap(n, hash, options(opts)...)}
+}
+
+// NewCOWMap returns a copy-on-write Mutex Map holding a copy of m, m may be nil.
+//
+// Readers load an immutable copy of the map without locking, while every write copies the whole map under
+// the map lock and publishes the copy once the lock is released. NewCOWMap is meant for maps read very often
+// and written rarely, such as routing tables or configuration.
+//
+// Load, Has, Len, Keys, Values, Entries, Range, All, KeysSeq and ValuesSeq never lock the map, so the body of
+// Range and of the iterators may call any method on the map.
+func NewCOWMap[K comparable, V any](m map[K]V) Map[K, V] {
+	return &cowMap[K, V]{internal.NewCOWMap(m)}
+}
+
+// clone implements Clone for the maps whose clone is a plain Map.
+func clone[K comparable, V any](m interface{ Snapshot() map[K]V }) Map[K, V] {
+	return &plainMap[K, V]{internal.Clone(m)}
+}
+
+// plainMap implements Map on top of a Map of the internal package. The internal package cannot refer to the types
+// of this package, such as Tx, so the methods using them are implemented by the wrapper.
+type plainMap[K comparable, V any] struct{ *internal.Map[K, V] }
+
+func (m *plainMap[K, V]) Transaction(f func(tx Tx[K, V]) error) error {
+	return m.Map.Transaction(transaction(f))
+}
+
+func (m *plainMap[K, V]) Watch(ctx context.Context, key K, opts ...WatchOption) <-chan Event[K, V] {
+	return watch(m.Map, ctx, key, false, opts)
+}
+
+func (m *plainMap[K, V]) WatchAll(ctx context.Context, opts ...WatchOption) <-chan Event[K, V] {
+	var zero K
+	return watch(m.Map, ctx, zero, true, opts)
+}
+
+func (m *plainMap[K, V]) Clone() Map[K, V] {
+	return clone[K, V](m.Map)
+}
+
+// shardedMap implements Map on top of a ShardedMap of the internal package, see plainMap.
+type shardedMap[K comparable, V any] struct{ *internal.ShardedMap[K, V] }
+
+func (m *shardedMap[K, V]) Transaction(f func(tx Tx[K, V]) error) error {
+	return m.ShardedMap.Transaction(transaction(f))
+}
+
+func (m *shardedMap[K, V]) Watch(ctx context.Context, key K, opts ...WatchOption) <-chan Event[K, V] {
+	return watch(m.ShardedMap, ctx, key, false, opts)
+}
+
+func (m *shardedMap[K, V]) WatchAll(ctx context.Context, opts ...WatchOption) <-chan Event[K, V] {
+	var zero K
+	return watch(m.ShardedMap, ctx, zero, true, opts)
+}
+
+func (m *shardedMap[K, V]) Clone() Map[K, V] {
+	return clone[K, V](m.ShardedMap)
+}
+
+// cowMap implements Map on top of a COWMap of the internal package, see plainMap.
+type cowMap[K comparable, V any] struct{ *internal.COWMap[K, V] }
+
+func (m *cowMap[K, V]) Transaction(f func(tx Tx[K, V]) error) error {
+	return m.COWMap.Transaction(transaction(f))
+}
+
+func (m *cowMap[K, V]) Watch(ctx context.Context, key K, opts ...WatchOption) <-chan Event[K, V] {
+	return watch(m.COWMap, ctx, key, false, opts)
+}
+
+func (m *cowMap[K, V]) WatchAll(ctx context.Context, opts ...WatchOption) <-chan Event[K, V] {
+	var zero K
+	return watch(m.COWMap, ctx, zero, true, opts)
+}
+
+func (m *cowMap[K, V]) Clone() Map[K, V] {
+	return clone[K, V](m.COWMap)
 }
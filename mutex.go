@@ -6,4 +6,14 @@
 // providing a simple and familiar interface similar to well known atomic.Value and sync.Map, but with added type safety
 // and the flexibility of generics. The package aims to simplify concurrent programming by ensuring safe
 // access to shared data and reducing the boilerplate code associated with mutexes.
+//
+// # Debugging deadlocks
+//
+// Calling a method of a structure from within the function passed to its Update, UpdateRange, Exclusive or
+// Transaction methods deadlocks. When the package is built with the mutexdebug build tag, such a call panics
+// instead, with a message naming both methods and their call sites:
+//
+//	go test -tags mutexdebug ./...
+//
+// The build tag makes every lock noticeably slower and should not be used in production.
 package mutex
@@ -1,7 +1,20 @@
 package mutex_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/thetechpanda/mutex"
 )
@@ -100,4 +113,452 @@ func TestMap(t *testing.T) {
 			t.Errorf("Expected value to be 42, got %v", v)
 		}
 	})
+
+	t.Run("new from seq", func(t *testing.T) {
+		m := map[string]string{"key": "42"}
+		mv := mutex.NewMapFromSeq(maps.All(m))
+		v, ok := mv.Load("key")
+		if !ok {
+			t.Errorf("Expected ok to be true, got false")
+		}
+		if v != "42" {
+			t.Errorf("Expected value to be 42, got %v", v)
+		}
+		for key, value := range mv.All() {
+			if key != "key" || value != "42" {
+				t.Errorf("Expected key, 42, got %v, %v", key, value)
+			}
+		}
+	})
+
+	t.Run("copy on write", func(t *testing.T) {
+		mv := mutex.NewCOWMap(map[string]string{"key": "42"})
+		mv.Range(func(key, value string) bool {
+			mv.Store(key+"2", value)
+			return true
+		})
+		v, ok := mv.Load("key2")
+		if !ok {
+			t.Errorf("Expected ok to be true, got false")
+		}
+		if v != "42" {
+			t.Errorf("Expected value to be 42, got %v", v)
+		}
+	})
+
+	t.Run("sharded", func(t *testing.T) {
+		mv := mutex.NewShardedMap[int, string](4, func(k int) uint64 { return uint64(k) })
+		for i := 0; i < 10; i++ {
+			mv.Store(i, "42")
+		}
+		if mv.Len() != 10 {
+			t.Errorf("Expected length to be 10, got %d", mv.Len())
+		}
+		v, ok := mv.Load(7)
+		if !ok {
+			t.Errorf("Expected ok to be true, got false")
+		}
+		if v != "42" {
+			t.Errorf("Expected value to be 42, got %v", v)
+		}
+	})
+}
+
+// fakeClock is a Clock that only moves when advanced.
+type fakeClock struct{ now atomic.Int64 }
+
+func (c *fakeClock) Now() time.Time { return time.Unix(0, c.now.Load()) }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now.Add(int64(d)) }
+
+func TestTTLMap(t *testing.T) {
+	clock := &fakeClock{}
+	m := mutex.NewTTLMap[string, int](mutex.TTLOptions{DefaultTTL: time.Hour, Clock: clock})
+	defer m.Close()
+	m.Store("key", 42)
+	v, ok := m.Load("key")
+	if !ok {
+		t.Errorf("Expected ok to be true, got false")
+	}
+	if v != 42 {
+		t.Errorf("Expected value to be 42, got %v", v)
+	}
+	m.StoreWithTTL("expired", 42, time.Minute)
+	if !m.Has("expired") {
+		t.Errorf("Expected key not to be expired yet")
+	}
+	clock.Advance(time.Minute)
+	if m.Has("expired") {
+		t.Errorf("Expected key to be expired")
+	}
+}
+
+func TestLRUMap(t *testing.T) {
+	m := mutex.NewLRUMap[string, int](1)
+	evicted := ""
+	m.OnEvict(func(key string, value int) {
+		evicted = key
+	})
+	m.Store("a", 1)
+	m.Store("b", 2)
+	if evicted != "a" {
+		t.Errorf("Expected key a to be evicted, got %q", evicted)
+	}
+	if v, ok := m.Load("b"); !ok || v != 2 {
+		t.Errorf("Expected value to be 2, got %v", v)
+	}
+}
+
+func TestBoundedMap(t *testing.T) {
+	m := mutex.NewBoundedMap[string, int](2, mutex.NewFIFOPolicy[string]())
+	m.Store("a", 1)
+	m.Store("b", 2)
+	m.Load("a")
+	m.Store("c", 3)
+	if m.Has("a") {
+		t.Errorf("Expected key a to be evicted")
+	}
+	for _, policy := range []mutex.EvictionPolicy[string]{
+		mutex.NewLRUPolicy[string](),
+		mutex.NewLFUPolicy[string](),
+		mutex.NewARCPolicy[string](2),
+		mutex.NewRandomPolicy[string](),
+	} {
+		m := mutex.NewBoundedMap[string, int](2, policy)
+		for _, key := range []string{"a", "b", "c", "d"} {
+			m.Store(key, 0)
+		}
+		if m.Len() != 2 || m.Capacity() != 2 {
+			t.Errorf("Expected length to be 2, got %d", m.Len())
+		}
+	}
+}
+
+func TestOrderedMap(t *testing.T) {
+	m := mutex.NewOrderedMap[string, int]()
+	m.Store("b", 1)
+	m.Store("a", 2)
+	m.Store("b", 3)
+	if keys := m.Keys(); len(keys) != 2 || keys[0] != "b" || keys[1] != "a" {
+		t.Errorf("Expected keys [b a], got %v", keys)
+	}
+	m.MoveToBack("b")
+	if key, value, ok := m.Newest(); !ok || key != "b" || value != 3 {
+		t.Errorf("Expected newest key b, got %v %v", key, value)
+	}
+	if key, _, _ := m.Oldest(); key != "a" {
+		t.Errorf("Expected oldest key a, got %v", key)
+	}
+	if s := m.String(); s != `{"a":2,"b":3}` {
+		t.Errorf("Expected the JSON encoding to follow the order, got %s", s)
+	}
+	c, ok := m.Clone().(mutex.OrderedMap[string, int])
+	if !ok {
+		t.Fatalf("Expected the clone to be an OrderedMap")
+	}
+	if key, _, _ := c.Newest(); key != "b" {
+		t.Errorf("Expected newest key b in the clone, got %v", key)
+	}
+}
+
+func TestMapWatch(t *testing.T) {
+	m := mutex.NewMap[string, int]()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := m.Watch(ctx, "key", mutex.WithWatchBuffer(1), mutex.WithWatchPolicy(mutex.WatchCoalesce))
+	m.Store("key", 42)
+	e := <-ch
+	if e.Op != mutex.OpStore || e.Key != "key" || e.New != 42 {
+		t.Errorf("Expected Store event for key, got %+v", e)
+	}
+}
+
+func TestMapTransaction(t *testing.T) {
+	m := mutex.NewMapWithValue(map[string]int{"from": 42})
+	err := m.Transaction(func(tx mutex.Tx[string, int]) error {
+		v, ok := tx.Load("from")
+		if !ok {
+			return errors.New("missing key")
+		}
+		tx.Delete("from")
+		tx.Store("to", v)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if v, ok := m.Load("to"); !ok || v != 42 || m.Has("from") {
+		t.Errorf("Expected value to be moved, got %v", v)
+	}
+}
+
+func TestAtomically(t *testing.T) {
+	from := mutex.NewMapWithValue(map[string]int{"key": 42})
+	to := mutex.NewMap[string, int]()
+	moved := mutex.NewNumeric[int]()
+	mutex.Atomically(func(l *mutex.Locks) {
+		src, dst := mutex.LockedMapOf(l, from), mutex.LockedMapOf(l, to)
+		if v, ok := src.Load("key"); ok {
+			src.Delete("key")
+			dst.Store("key", v)
+			mutex.LockedValueOf(l, moved).Store(1)
+		}
+	}, from, to, moved)
+	if v, ok := to.Load("key"); !ok || v != 42 || from.Has("key") {
+		t.Errorf("Expected value to be moved, got %v", v)
+	}
+	if v, _ := moved.Load(); v != 1 {
+		t.Errorf("Expected value to be 1, got %v", v)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type config struct {
+		Name  mutex.Value[string]       `json:"name"`
+		Count mutex.Numeric[int]        `json:"count"`
+		Tags  mutex.Map[string, string] `json:"tags"`
+	}
+	in := config{
+		Name:  mutex.NewWithValue("svc"),
+		Count: mutex.NewNumericWithValue(3),
+		Tags:  mutex.NewMapWithValue(map[string]string{"env": "prod"}),
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if string(data) != `{"name":"svc","count":3,"tags":{"env":"prod"}}` {
+		t.Errorf("Unexpected encoding %s", data)
+	}
+	out := config{Name: mutex.NewValue[string](), Count: mutex.NewNumeric[int](), Tags: mutex.NewMap[string, string]()}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if v, _ := out.Tags.Load("env"); v != "prod" {
+		t.Errorf("Expected value to be prod, got %v", v)
+	}
+	if v, _ := out.Count.Load(); v != 3 {
+		t.Errorf("Expected value to be 3, got %v", v)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	m := mutex.NewMapWithValue(map[string]int{"key": 42})
+	var buf bytes.Buffer
+	if _, err := m.(io.WriterTo).WriteTo(&buf); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	data := buf.Bytes()
+	r := mutex.NewMap[string, int]()
+	if _, err := r.(io.ReaderFrom).ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if v, ok := r.Load("key"); !ok || v != 42 {
+		t.Errorf("Expected value to be 42, got %v", v)
+	}
+	_, err := r.(io.ReaderFrom).ReadFrom(bytes.NewReader(data[:len(data)-1]))
+	if !errors.Is(err, mutex.ErrInvalidSnapshot) {
+		t.Errorf("Expected ErrInvalidSnapshot, got %v", err)
+	}
+}
+
+func TestPersistentMap(t *testing.T) {
+	dir := t.TempDir()
+	m, err := mutex.OpenPersistentMap(dir, mutex.PersistentOptions[string, int]{Sync: mutex.SyncBatch})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	m.Store("key", 42)
+	if err := m.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	m, err = mutex.OpenPersistentMap(dir, mutex.PersistentOptions[string, int]{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer m.Close()
+	if v, ok := m.Load("key"); !ok || v != 42 {
+		t.Errorf("Expected value to be 42, got %v", v)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	now := time.Now()
+	m := mutex.NewMapWithValue(map[string]time.Time{"key": now}, mutex.WithEqual(time.Time.Equal))
+	if !m.CompareAndSwap("key", now.UTC(), now) {
+		t.Errorf("Expected values to be equal")
+	}
+	c := mutex.NewComparableMap(map[string]int{"key": 42})
+	if !c.CompareAndDelete("key", 42) {
+		t.Errorf("Expected value to be deleted")
+	}
+	v := mutex.NewComparableValue[int]()
+	v.Store(42)
+	if !v.CompareAndSwap(42, 43) {
+		t.Errorf("Expected value to be swapped")
+	}
+}
+
+func TestContext(t *testing.T) {
+	m := mutex.NewMap[string, int]()
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := m.UpdateContext(ctx, "key", func(v int, ok bool) int { return 42 }); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	cancel()
+	if err := m.StoreContext(ctx, "key", 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if v, _ := m.Load("key"); v != 42 {
+		t.Errorf("Expected value to be 42, got %v", v)
+	}
+	v := mutex.NewValue[int]()
+	if _, err := v.ExclusiveContext(ctx, func(v int, ok bool) int { return 1 }); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestTry(t *testing.T) {
+	m := mutex.NewMap[string, int]()
+	if !m.TryStore("key", 42) {
+		t.Errorf("Expected TryStore to run")
+	}
+	if v, ok, acquired := m.TryLoad("key"); !acquired || !ok || v != 42 {
+		t.Errorf("Expected value to be 42, got %v", v)
+	}
+	n := mutex.NewNumeric[int]()
+	if v, ok := n.TryExclusive(func(v int, ok bool) int { return v + 1 }); !ok || v != 1 {
+		t.Errorf("Expected value to be 1, got %v", v)
+	}
+}
+
+func TestStats(t *testing.T) {
+	m := mutex.NewMap[string](mutex.WithStats[int]())
+	m.Store("key", 42)
+	m.Load("key")
+	if st := m.Stats(); st.Writes != 1 || st.Reads != 1 {
+		t.Errorf("Expected 1 write and 1 read, got %+v", st)
+	}
+	n := mutex.NewNumeric(mutex.WithStats[int]())
+	n.Add(1)
+	if st := n.Stats(); st.Writes != 1 {
+		t.Errorf("Expected 1 write, got %+v", st)
+	}
+	if st := mutex.NewValue[int]().Stats(); st != (mutex.Stats{}) {
+		t.Errorf("Expected zero stats, got %+v", st)
+	}
+}
+
+// published counts the calls to TestPublish, expvar panics if a name is published twice
+// and the test may run more than once in the same process.
+var published atomic.Int64
+
+func TestPublish(t *testing.T) {
+	prefix := fmt.Sprintf("%s.%d.", t.Name(), published.Add(1))
+	n := mutex.PublishNumeric(prefix+"requests", mutex.NewNumeric[int64]())
+	n.Add(2)
+	m := mutex.PublishMap(prefix+"map", mutex.NewMap[string, int]())
+	m.Store("key", 42)
+	v := mutex.PublishValue(prefix+"value", mutex.NewValue[string]())
+	v.Store("value")
+	for name, expected := range map[string]string{
+		prefix + "requests": "2",
+		prefix + "map":      `{"key":42}`,
+		prefix + "value":    `"value"`,
+	} {
+		if s := expvar.Get(name).String(); s != expected {
+			t.Errorf("Expected %s to be %s, got %s", name, expected, s)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := mutex.NewRegistry()
+	requests := mutex.NewNumeric[int64]()
+	requests.Add(3)
+	load := mutex.NewMapWithValue(map[string]float64{"a": 0.5})
+	if err := mutex.RegisterNumeric(r, "requests_total", "Requests.", mutex.MetricCounter, requests); err != nil {
+		t.Fatal(err)
+	}
+	if err := mutex.RegisterMap(r, "load", "", mutex.MetricGauge, "node", load); err != nil {
+		t.Fatal(err)
+	}
+	if err := mutex.RegisterMap(r, "load", "", mutex.MetricGauge, "node", load); !errors.Is(err, mutex.ErrInvalidMetric) {
+		t.Errorf("Expected ErrInvalidMetric, got %v", err)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	expected := "# TYPE load gauge\nload{node=\"a\"} 0.5\n# HELP requests_total Requests.\n# TYPE requests_total counter\nrequests_total 3\n"
+	if rec.Body.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, rec.Body.String())
+	}
+}
+
+func TestCompute(t *testing.T) {
+	m := mutex.NewMap[string, int]()
+	m.ComputeIfAbsent("key", func() int { return 1 })
+	m.Merge("key", 2, func(old, new int) int { return old + new })
+	if v, ok := m.ComputeIfPresent("key", func(v int) (int, bool) { return v * 2, true }); !ok || v != 6 {
+		t.Errorf("Expected value to be 6, got %v", v)
+	}
+	if _, ok := m.Compute("key", func(v int, loaded bool) (int, mutex.ComputeOp) { return v, mutex.ComputeDelete }); ok || m.Has("key") {
+		t.Errorf("Expected key to be deleted")
+	}
+}
+
+func TestBulk(t *testing.T) {
+	m := mutex.NewMap[string, int]()
+	m.StoreMany(map[string]int{"a": 1, "b": 2})
+	if v := m.LoadMany([]string{"a", "c"}); len(v) != 1 || v["a"] != 1 {
+		t.Errorf("Expected a single value, got %v", v)
+	}
+	if n := m.DeleteMany([]string{"a"}); n != 1 {
+		t.Errorf("Expected 1 key removed, got %d", n)
+	}
+	if old := m.Replace(map[string]int{"c": 3}); len(old) != 1 || old["b"] != 2 {
+		t.Errorf("Expected the previous content, got %v", old)
+	}
+	if old := m.Drain(); len(old) != 1 || m.Len() != 0 {
+		t.Errorf("Expected the content and an empty map, got %v", old)
+	}
+}
+
+func TestFunctional(t *testing.T) {
+	m := mutex.NewMapWithValue(map[string]int{"a": 1, "b": 2, "c": 3})
+	odd := func(_ string, v int) bool { return v%2 == 1 }
+	if f := mutex.Filter(m, odd); f.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %v", f.Keys())
+	}
+	folded := mutex.NewMapWithValue(map[string]string{"a": "x"}, mutex.WithEqual(strings.EqualFold))
+	if f := mutex.Filter(folded, func(string, string) bool { return true }); !f.CompareAndSwap("a", "X", "y") {
+		t.Errorf("Expected Filter to keep the Equal option")
+	}
+	if w := mutex.Transform(m, func(_ string, v int) float64 { return float64(v) / 2 }); w.Len() != 3 {
+		t.Errorf("Expected 3 entries, got %v", w.Keys())
+	}
+	if sum := mutex.Reduce(m, 0, func(acc int, _ string, v int) int { return acc + v }); sum != 6 {
+		t.Errorf("Expected 6, got %d", sum)
+	}
+	if matched, rest := mutex.Partition(m, odd); matched.Len() != 2 || rest.Len() != 1 {
+		t.Errorf("Expected 2 and 1 entries, got %v and %v", matched.Keys(), rest.Keys())
+	}
+	if n := m.RetainIf(odd); n != 1 {
+		t.Errorf("Expected 1 entry removed, got %d", n)
+	}
+	if n := m.DeleteIf(odd); n != 2 || m.Len() != 0 {
+		t.Errorf("Expected 2 entries removed, got %d", n)
+	}
+}
+
+func TestClone(t *testing.T) {
+	m := mutex.NewMapWithValue(map[string][]int{"key": {1}}, mutex.WithCopy(func(v []int) []int { return append([]int(nil), v...) }))
+	snap := m.Snapshot()
+	c := m.Clone()
+	m.Exclusive(func(data map[string][]int) { data["key"][0] = 2 })
+	if snap["key"][0] != 1 {
+		t.Errorf("Expected the snapshot not to change, got %v", snap["key"])
+	}
+	if v, _ := c.Load("key"); v[0] != 1 {
+		t.Errorf("Expected the clone not to change, got %v", v)
+	}
 }
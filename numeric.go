@@ -10,11 +10,11 @@ type Numeric[V uint | uint8 | uint16 | uint32 | uint64 | int | int8 | int16 | in
 }
 
 // NewNumeric returns a new Numeric.
-func NewNumeric[V uint | uint8 | uint16 | uint32 | uint64 | int | int8 | int16 | int32 | int64 | float32 | float64 | complex64 | complex128]() Numeric[V] {
-	return internal.NewNumeric[V]()
+func NewNumeric[V uint | uint8 | uint16 | uint32 | uint64 | int | int8 | int16 | int32 | int64 | float32 | float64 | complex64 | complex128](opts ...Option[V]) Numeric[V] {
+	return internal.NewNumeric(options(opts)...)
 }
 
 // NewNumericWithValue returns a new Numeric, set to the specified value.
-func NewNumericWithValue[V uint | uint8 | uint16 | uint32 | uint64 | int | int8 | int16 | int32 | int64 | float32 | float64 | complex64 | complex128](v V) Numeric[V] {
-	return internal.NewNumericWithValue(v)
+func NewNumericWithValue[V uint | uint8 | uint16 | uint32 | uint64 | int | int8 | int16 | int32 | int64 | float32 | float64 | complex64 | complex128](v V, opts ...Option[V]) Numeric[V] {
+	return internal.NewNumericWithValue(v, options(opts)...)
 }
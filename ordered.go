@@ -0,0 +1,54 @@
+package mutex
+
+import (
+	"context"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+// OrderedMap is a Map remembering the order in which its keys were inserted.
+//
+// Range, Keys, Values, Entries, UpdateRange, All, KeysSeq and ValuesSeq visit the keys from the oldest to the newest.
+// Storing a key already present keeps its position, while a key deleted and stored again becomes the newest.
+// Exclusive appends the keys added by f in unspecified order, keys already present keep their position.
+//
+// MarshalJSON, String and WriteTo also follow the insertion order, UnmarshalJSON and ReadFrom restore the order of
+// their input. The snapshots written by WriteTo can only be read by an OrderedMap. Clone returns an OrderedMap.
+type OrderedMap[K comparable, V any] interface {
+	Map[K, V]
+	// MoveToFront moves key to the front of the map, making it the oldest key.
+	// It returns false if key is not present.
+	MoveToFront(key K) bool
+	// MoveToBack moves key to the back of the map, making it the newest key.
+	// It returns false if key is not present.
+	MoveToBack(key K) bool
+	// Oldest returns the key at the front of the map and its value, ok is false if the map is empty.
+	Oldest() (key K, value V, ok bool)
+	// Newest returns the key at the back of the map and its value, ok is false if the map is empty.
+	Newest() (key K, value V, ok bool)
+}
+
+// NewOrderedMap returns an empty OrderedMap.
+func NewOrderedMap[K comparable, V any](opts ...Option[V]) OrderedMap[K, V] {
+	return &orderedMap[K, V]{internal.NewOrderedMap[K, V](options(opts)...)}
+}
+
+// orderedMap implements OrderedMap on top of a OrderedMap of the internal package, see plainMap.
+type orderedMap[K comparable, V any] struct{ *internal.OrderedMap[K, V] }
+
+func (m *orderedMap[K, V]) Transaction(f func(tx Tx[K, V]) error) error {
+	return m.OrderedMap.Transaction(transaction(f))
+}
+
+func (m *orderedMap[K, V]) Watch(ctx context.Context, key K, opts ...WatchOption) <-chan Event[K, V] {
+	return watch(m.OrderedMap, ctx, key, false, opts)
+}
+
+func (m *orderedMap[K, V]) WatchAll(ctx context.Context, opts ...WatchOption) <-chan Event[K, V] {
+	var zero K
+	return watch(m.OrderedMap, ctx, zero, true, opts)
+}
+
+func (m *orderedMap[K, V]) Clone() Map[K, V] {
+	return &orderedMap[K, V]{m.OrderedMap.Clone()}
+}
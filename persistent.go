@@ -0,0 +1,135 @@
+package mutex
+
+import (
+	"context"
+	"time"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+// Codec converts keys or values to and from bytes, it is used by PersistentMap to write its log.
+// Implementations must be safe for concurrent use.
+type Codec[T any] interface {
+	// Marshal returns the encoding of v.
+	Marshal(v T) ([]byte, error)
+	// Unmarshal decodes a value encoded by Marshal.
+	Unmarshal(data []byte) (T, error)
+}
+
+// GobCodec is a Codec using encoding/gob, it is the default codec of PersistentMap.
+type GobCodec[T any] struct{}
+
+// Marshal returns the gob encoding of v.
+func (GobCodec[T]) Marshal(v T) ([]byte, error) {
+	return internal.GobCodec[T]{}.Marshal(v)
+}
+
+// Unmarshal decodes a value encoded by Marshal.
+func (GobCodec[T]) Unmarshal(data []byte) (T, error) {
+	return internal.GobCodec[T]{}.Unmarshal(data)
+}
+
+// JSONCodec is a Codec using encoding/json.
+type JSONCodec[T any] struct{}
+
+// Marshal returns the JSON encoding of v.
+func (JSONCodec[T]) Marshal(v T) ([]byte, error) {
+	return internal.JSONCodec[T]{}.Marshal(v)
+}
+
+// Unmarshal decodes a value encoded by Marshal.
+func (JSONCodec[T]) Unmarshal(data []byte) (T, error) {
+	return internal.JSONCodec[T]{}.Unmarshal(data)
+}
+
+// SyncPolicy defines when a PersistentMap syncs its log to stable storage, see SyncAlways, SyncBatch and SyncInterval.
+// The log is always written to the operating system before a mutation returns, so it survives a crash of the process.
+type SyncPolicy = internal.SyncPolicy
+
+const (
+	// SyncAlways syncs the log before every mutation returns.
+	SyncAlways = internal.SyncAlways
+	// SyncBatch syncs the log once PersistentOptions.BatchSize records have been written since the last sync.
+	SyncBatch = internal.SyncBatch
+	// SyncInterval syncs the log every PersistentOptions.SyncInterval from a background goroutine.
+	SyncInterval = internal.SyncInterval
+)
+
+// PersistentOptions configures a PersistentMap, see OpenPersistentMap.
+type PersistentOptions[K comparable, V any] struct {
+	// KeyCodec encodes the keys in the log, defaults to GobCodec.
+	KeyCodec Codec[K]
+	// ValueCodec encodes the values in the log, defaults to GobCodec.
+	ValueCodec Codec[V]
+	// Sync is the policy used to sync the log, defaults to SyncAlways.
+	Sync SyncPolicy
+	// BatchSize is the number of records written between two syncs with SyncBatch, defaults to 64.
+	BatchSize int
+	// SyncInterval is the interval between two syncs with SyncInterval, defaults to one second.
+	SyncInterval time.Duration
+	// CompactSize is the size in bytes the log must reach to be compacted into a snapshot, defaults to 4 MiB.
+	// A negative CompactSize disables automatic compaction.
+	CompactSize int64
+}
+
+// ErrClosed is returned by Compact and Sync once the PersistentMap is closed, and by Err once it is mutated after Close.
+var ErrClosed = internal.ErrClosed
+
+// ErrInvalidLog is returned by OpenPersistentMap when the snapshot or a log record cannot be decoded.
+var ErrInvalidLog = internal.ErrInvalidLog
+
+// PersistentMap is a Map whose mutations are appended to a log file, so that its content survives a restart.
+type PersistentMap[K comparable, V any] interface {
+	Map[K, V]
+	// Compact writes the map content to a new snapshot and empties the log.
+	// It is called automatically once the log grows past PersistentOptions.CompactSize.
+	Compact() error
+	// Sync flushes the log and syncs it to stable storage, regardless of the sync policy.
+	Sync() error
+	// Err returns the first error met writing the log, once an error is met no further mutation is logged.
+	// Err returns ErrClosed if the map is mutated after Close.
+	Err() error
+	// Close syncs and closes the log. The map can still be read after Close, but its mutations are no longer logged.
+	Close() error
+}
+
+// OpenPersistentMap opens the persistent map stored in the directory dir, creating it if needed.
+// The snapshot and the log found in dir are replayed, an incomplete or corrupted final record, left by a crash
+// during a write, is discarded. A corrupted record followed by other records returns ErrInvalidLog.
+//
+// Every change to the map is appended to the log before the mutating method returns, whatever the method,
+// and the log is synced according to opts.Sync. Close must be called to release the log file.
+func OpenPersistentMap[K comparable, V any](dir string, opts PersistentOptions[K, V]) (PersistentMap[K, V], error) {
+	m, err := internal.OpenPersistentMap(dir, internal.PersistentOptions[K, V]{
+		KeyCodec:     opts.KeyCodec,
+		ValueCodec:   opts.ValueCodec,
+		Sync:         opts.Sync,
+		BatchSize:    opts.BatchSize,
+		SyncInterval: opts.SyncInterval,
+		CompactSize:  opts.CompactSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &persistentMap[K, V]{m}, nil
+}
+
+// persistentMap implements PersistentMap on top of a PersistentMap of the internal package, see plainMap.
+type persistentMap[K comparable, V any] struct{ *internal.PersistentMap[K, V] }
+
+func (m *persistentMap[K, V]) Transaction(f func(tx Tx[K, V]) error) error {
+	return m.PersistentMap.Transaction(transaction(f))
+}
+
+func (m *persistentMap[K, V]) Watch(ctx context.Context, key K, opts ...WatchOption) <-chan Event[K, V] {
+	return watch(m.PersistentMap, ctx, key, false, opts)
+}
+
+func (m *persistentMap[K, V]) WatchAll(ctx context.Context, opts ...WatchOption) <-chan Event[K, V] {
+	var zero K
+	return watch(m.PersistentMap, ctx, zero, true, opts)
+}
+
+func (m *persistentMap[K, V]) Clone() Map[K, V] {
+	return clone[K, V](m.PersistentMap)
+}
@@ -0,0 +1,49 @@
+package mutex
+
+import "github.com/thetechpanda/mutex/internal"
+
+// Registry holds a set of metrics backed by Numeric and Map instances and writes them in the Prometheus
+// text exposition format, without depending on the Prometheus client. Registry implements http.Handler
+// and can be used as a scrape endpoint:
+//
+//	r := mutex.NewRegistry()
+//	mutex.RegisterNumeric(r, "http_requests_total", "Requests served.", mutex.MetricCounter, requests)
+//	http.Handle("/metrics", r)
+//
+// The structures are read when the metrics are written, one at a time. The zero Registry is empty and ready to use.
+type Registry = internal.Registry
+
+// MetricType is the type of a metric, MetricCounter or MetricGauge.
+type MetricType = internal.MetricType
+
+const (
+	// MetricCounter is a value that only goes up.
+	MetricCounter = internal.MetricCounter
+	// MetricGauge is a value that goes up and down.
+	MetricGauge = internal.MetricGauge
+)
+
+// Real is the constraint of the numeric types that can be exported as metrics, the numeric types without complex numbers.
+type Real = internal.Real
+
+// ErrInvalidMetric is returned when registering a metric with an invalid name, type or label name,
+// or with a name already registered.
+var ErrInvalidMetric = internal.ErrInvalidMetric
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return internal.NewRegistry()
+}
+
+// RegisterNumeric registers n as the metric name of type typ with the given help text, n is exported
+// as a single sample, 0 if it is not set. Integers are written exactly.
+func RegisterNumeric[V Real](r *Registry, name, help string, typ MetricType, n Numeric[V]) error {
+	return internal.RegisterNumeric(r, name, help, typ, n)
+}
+
+// RegisterMap registers m as the metric name of type typ with the given help text, every entry of m is
+// exported as a sample labelled with label="key", the key being formatted with fmt.Sprint.
+// The entries are copied under the map lock and written in the order of the formatted keys.
+func RegisterMap[K comparable, V Real](r *Registry, name, help string, typ MetricType, label string, m Map[K, V]) error {
+	return internal.RegisterMap(r, name, help, typ, label, m)
+}
@@ -0,0 +1,9 @@
+package mutex
+
+import "github.com/thetechpanda/mutex/internal"
+
+// ErrInvalidSnapshot is returned by ReadFrom and GobDecode when the snapshot is truncated, corrupted or of the wrong kind.
+//
+// Map and Value implement io.WriterTo, io.ReaderFrom, gob.GobEncoder and gob.GobDecoder: a snapshot starts with a versioned
+// header holding the number of entries and ends with a checksum, keys and values are encoded with encoding/gob.
+var ErrInvalidSnapshot = internal.ErrInvalidSnapshot
@@ -0,0 +1,65 @@
+package mutex
+
+import (
+	"time"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+// Clock provides the current time to a TTLMap, it allows expiration to be controlled in tests.
+type Clock = internal.Clock
+
+// TTLOptions configures a TTLMap, see NewTTLMap.
+type TTLOptions = internal.TTLOptions
+
+// TTLMap is a thread-safe map whose entries expire after a time to live.
+// Expired entries are never returned, they are removed by a janitor goroutine or by DeleteExpired.
+type TTLMap[K comparable, V any] interface {
+	// Load returns the value stored in the map for a key, or zero value if no
+	// value is present or the entry expired.
+	// The ok result indicates whether value was found in the map.
+	// When sliding expiration is enabled a successful Load extends the entry expiration.
+	Load(key K) (v V, ok bool)
+	// Store sets the value for a key, the entry expires after the default TTL.
+	Store(key K, value V)
+	// StoreWithTTL sets the value for a key, the entry expires after ttl.
+	// A ttl less or equal to zero means the entry never expires.
+	StoreWithTTL(key K, value V, ttl time.Duration)
+	// LoadOrStore returns the existing value for the key if present and not expired.
+	// Otherwise, it stores the given value with the default TTL and returns it.
+	// The loaded result is true if the value was loaded, false if stored.
+	LoadOrStore(key K, value V) (actual V, loaded bool)
+	// LoadAndDelete deletes the value for a key, returning the previous value if any.
+	// The loaded result reports whether the key was present and not expired.
+	LoadAndDelete(key K) (value V, loaded bool)
+	// Delete deletes the value for a key.
+	Delete(key K)
+	// Has returns true if the map contains the key and the entry is not expired.
+	Has(key K) bool
+	// Range calls f sequentially for each key and value present in the map and not expired.
+	// If f returns false, range stops the iteration.
+	// Range iterates over a snapshot of the map, f may call any method on the map.
+	Range(f func(K, V) bool)
+	// Keys returns a slice of all the keys present in the map and not expired.
+	Keys() (keys []K)
+	// Len returns the number of entries in the map that are not expired.
+	Len() (n int)
+	// Clear removes all items from the map.
+	Clear()
+	// DeleteExpired removes all the expired entries from the map and returns how many were removed.
+	DeleteExpired() (n int)
+	// OnEvict sets f as the function called for every entry removed because it expired, by the janitor,
+	// DeleteExpired or a Store, StoreWithTTL or LoadOrStore replacing it before it was collected.
+	// Entries removed by Delete, LoadAndDelete or Clear are not reported.
+	// f is called once the map lock is released, so it may call any method on the map.
+	OnEvict(f func(key K, value V))
+	// Close stops the janitor goroutine and waits for it to return, it is safe to call Close more than once.
+	Close()
+}
+
+// NewTTLMap returns an empty TTLMap configured with opts.
+// If opts.CleanupInterval is greater than zero a janitor goroutine removes expired entries
+// at that interval until Close is called.
+func NewTTLMap[K comparable, V any](opts TTLOptions) TTLMap[K, V] {
+	return internal.NewTTLMap[K, V](opts)
+}
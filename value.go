@@ -1,6 +1,8 @@
 package mutex
 
 import (
+	"context"
+
 	"github.com/thetechpanda/mutex/internal"
 )
 
@@ -27,7 +29,8 @@ type Value[V any] interface {
 	//
 	// Returns true if the swap was performed.
 	//
-	// ! this function uses reflect.DeepEqual to compare the values.
+	// Values are compared with the function set by WithEqual, by default with == if V holds no pointer,
+	// interface, map, slice, channel or function, and with reflect.DeepEqual otherwise.
 	CompareAndSwap(old, new V) bool
 	// return true if the value is a zero value (not set)
 	IsZero() bool
@@ -38,16 +41,92 @@ type Value[V any] interface {
 	//
 	// ! Do not invoke any Value or Numeric functions within 'f' to prevent a deadlock.
 	Exclusive(f func(v V, ok bool) V) V
+	// StoreContext is the same as Store but returns ctx.Err(), without acquiring the lock, if ctx is done before the lock is acquired.
+	//
+	// The Context methods queue for the lock like the methods without a context, new readers wait behind them.
+	// While the lock is busy a single goroutine per value waits for it on behalf of the callers, a caller giving up leaves nothing behind.
+	StoreContext(ctx context.Context, value V) error
+	// LoadOrStoreContext is the same as LoadOrStore but returns ctx.Err() if ctx is done before the lock is acquired.
+	LoadOrStoreContext(ctx context.Context, value V) (actual V, loaded bool, err error)
+	// ExclusiveContext is the same as Exclusive but returns ctx.Err() if ctx is done before the lock is acquired.
+	//
+	// ! Do not invoke any Value or Numeric functions within 'f' to prevent a deadlock.
+	ExclusiveContext(ctx context.Context, f func(v V, ok bool) V) (V, error)
+	// TryStore is the same as Store but returns false immediately, without storing value, if the value is locked.
+	TryStore(value V) bool
+	// TryExclusive is the same as Exclusive but returns immediately, without calling f, if the value is locked.
+	// ok reports whether f was called.
+	//
+	// ! Do not invoke any Value or Numeric functions within 'f' to prevent a deadlock.
+	TryExclusive(f func(v V, ok bool) V) (updated V, ok bool)
 	// Clear removes the value from the store.
 	Clear()
+	// String returns the JSON encoding of the value, null if it is not set, and for a Numeric the value as a
+	// JSON number, 0 if it is not set. It implements expvar.Var, see PublishValue and PublishNumeric.
+	String() string
+	// Stats returns the lock activity of the value since its creation, it returns zero unless the value
+	// was created with WithStats.
+	Stats() Stats
+}
+
+// Options configures a Map or a Value, see WithEqual, WithCopy and WithStats.
+type Options[V any] internal.Options[V]
+
+// Option is a function that configures a Map or a Value.
+type Option[V any] func(*Options[V])
+
+// option returns opt as an Option.
+func option[V any](opt internal.Option[V]) Option[V] {
+	return func(o *Options[V]) {
+		opt((*internal.Options[V])(o))
+	}
+}
+
+// options returns opts as options of the internal package.
+func options[V any](opts []Option[V]) []internal.Option[V] {
+	converted := make([]internal.Option[V], len(opts))
+	for i, opt := range opts {
+		converted[i] = func(o *internal.Options[V]) {
+			opt((*Options[V])(o))
+		}
+	}
+	return converted
+}
+
+// WithEqual sets the function used by CompareAndSwap and CompareAndDelete to compare values,
+// for instance time.Time.Equal or a comparison ignoring cache fields.
+func WithEqual[V any](equal func(a, b V) bool) Option[V] {
+	return option(internal.WithEqual(equal))
+}
+
+// WithCopy sets the function used by Map.Snapshot and Map.Clone to copy values, so that the copies do not share
+// memory with the values still stored in the map, for instance slices.Clone for slice values or maps.Clone for map values.
+// By default values are copied by assignment.
+func WithCopy[V any](copyValue func(V) V) Option[V] {
+	return option(internal.WithCopy(copyValue))
+}
+
+// Stats reports the lock activity of a Map, Value or Numeric created with WithStats: acquisition counts,
+// time spent waiting for and holding the lock, and the longest write hold.
+type Stats = internal.Stats
+
+// WithStats records the lock activity returned by Stats. Without WithStats locking does not read the clock
+// and Stats returns zero, with WithStats uncontended acquisitions read the clock twice.
+func WithStats[V any]() Option[V] {
+	return option(internal.WithStats[V]())
 }
 
 // NewValue returns a new Value.
-func NewValue[V any]() Value[V] {
-	return internal.NewValue[V]()
+func NewValue[V any](opts ...Option[V]) Value[V] {
+	return internal.NewValue(options(opts)...)
 }
 
 // NewWithValue returns a new Value, set to the specified value.
-func NewWithValue[V any](v V) Value[V] {
-	return internal.NewWithValue(v)
+func NewWithValue[V any](v V, opts ...Option[V]) Value[V] {
+	return internal.NewWithValue(v, options(opts)...)
+}
+
+// NewComparableValue returns a new Value whose values must be comparable and are compared with == by CompareAndSwap.
+func NewComparableValue[V comparable]() Value[V] {
+	return internal.NewComparableValue[V]()
 }
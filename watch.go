@@ -0,0 +1,78 @@
+package mutex
+
+import (
+	"context"
+
+	"github.com/thetechpanda/mutex/internal"
+)
+
+// Op is the operation that changed a key of a Map, it is reported by Event.
+type Op = internal.Op
+
+const (
+	OpStore          = internal.OpStore          // the key was set by Store or LoadOrStore.
+	OpSwap           = internal.OpSwap           // the key was set by Swap.
+	OpCompareAndSwap = internal.OpCompareAndSwap // the key was set by CompareAndSwap.
+	OpUpdate         = internal.OpUpdate         // the key was set by Update.
+	OpUpdateRange    = internal.OpUpdateRange    // the key was set by UpdateRange.
+	OpDelete         = internal.OpDelete         // the key was removed by Delete, LoadAndDelete or CompareAndDelete.
+	OpClear          = internal.OpClear          // the key was removed by Clear.
+	OpEvict          = internal.OpEvict          // the key was removed by the map itself, for instance by an eviction policy.
+	OpExclusive      = internal.OpExclusive      // the key was set or removed within Exclusive.
+	OpCompute        = internal.OpCompute        // the key was set or removed by ComputeIfAbsent, ComputeIfPresent or Compute.
+	OpMerge          = internal.OpMerge          // the key was set by Merge.
+)
+
+// Event describes a change to a key of a Map, as received from Watch and WatchAll.
+//
+// Old is the value before the change and is valid only if Loaded is true, New is the value after
+// the change and is valid only if Deleted is false.
+type Event[K comparable, V any] struct {
+	Op      Op
+	Key     K
+	Old     V
+	Loaded  bool
+	New     V
+	Deleted bool
+}
+
+// WatchPolicy defines what happens to the events of a subscription whose channel is full.
+type WatchPolicy = internal.WatchPolicy
+
+const (
+	// WatchDrop discards the events that do not fit in the channel buffer, writers are never blocked.
+	WatchDrop = internal.WatchDrop
+	// WatchBlock blocks the writer, while it holds the map lock, until the event is received or the subscription is cancelled.
+	// Events are delivered while the map is write locked, so a slow subscriber stalls every writer of the map,
+	// and the readers queued behind them, until it receives.
+	//
+	// ! Do not invoke any Map functions while receiving from a blocking subscription to prevent a deadlock.
+	WatchBlock = internal.WatchBlock
+	// WatchCoalesce queues the events that do not fit in the channel buffer, merging the events of the same key:
+	// the merged event keeps the oldest Old value and the latest Op and New value. Events are sent unmerged while
+	// the buffer has room and no queued event waits to be sent, the order of the events is kept. Writers are never blocked.
+	WatchCoalesce = internal.WatchCoalesce
+)
+
+// WatchOption configures a subscription created by Watch or WatchAll.
+type WatchOption = internal.WatchOption
+
+// WithWatchBuffer sets the capacity of the subscription channel, the default is 16.
+func WithWatchBuffer(n int) WatchOption {
+	return internal.WithWatchBuffer(n)
+}
+
+// WithWatchPolicy sets the policy applied when the subscription channel is full, the default is WatchDrop.
+func WithWatchPolicy(policy WatchPolicy) WatchOption {
+	return internal.WithWatchPolicy(policy)
+}
+
+// event converts an event of the internal package.
+func event[K comparable, V any](e internal.Event[K, V]) Event[K, V] {
+	return Event[K, V](e)
+}
+
+// watch implements Watch and WatchAll for the maps of the internal package, which cannot refer to Event.
+func watch[K comparable, V any](w internal.Watcher[K, V], ctx context.Context, key K, all bool, opts []WatchOption) <-chan Event[K, V] {
+	return internal.WatchAs(w, ctx, key, all, event[K, V], opts...)
+}